@@ -19,6 +19,7 @@
 package gonvme
 
 import (
+	"context"
 	"time"
 
 	"github.com/dell/gonvme/internal/logger"
@@ -32,39 +33,139 @@ type Logger = logger.Logger
 type Tracer = tracer.Tracer
 
 // NVMEinterface is the interface that provides the NVMe client functionality
+//
+// Every operation has a WithContext variant which bounds the underlying nvme-cli
+// invocation by ctx: the child process is killed when ctx is canceled, and an
+// expired deadline is reported as ErrTimeout.
 type NVMEinterface interface {
 	// DiscoverNVMeTCPTargets discovers the targets exposed via a given portal
 	// returns an array of NVMeTCP Target instances
+	// with login, it connects to them and returns them with an error if any failed to connect
 	DiscoverNVMeTCPTargets(address string, login bool) ([]NVMeTarget, error)
+	DiscoverNVMeTCPTargetsWithContext(ctx context.Context, address string, login bool) ([]NVMeTarget, error)
 
 	// DiscoverNVMeFCTargets discovers the targets exposed via a given portal
 	// returns an array of NVMeFC Target instances
+	// with login, it connects to them and returns them with an error if any failed to connect
 	DiscoverNVMeFCTargets(address string, login bool) ([]NVMeTarget, error)
+	DiscoverNVMeFCTargetsWithContext(ctx context.Context, address string, login bool) ([]NVMeTarget, error)
+
+	// DiscoverNVMeRDMATargets discovers the targets exposed via a given portal
+	// returns an array of NVMeRDMA Target instances
+	// with login, it connects to them and returns them with an error if any failed to connect
+	DiscoverNVMeRDMATargets(address string, login bool) ([]NVMeTarget, error)
+	DiscoverNVMeRDMATargetsWithContext(ctx context.Context, address string, login bool) ([]NVMeTarget, error)
+
+	// WatchDiscovery reports the changes of the discovery log of a persistent discovery controller
+	WatchDiscovery(ctx context.Context, options DiscoveryWatchOptions) (<-chan DiscoveryChange, error)
 
 	// GetInitiators get a list of NVMe initiators defined in a specified file
 	// To use the system default file of "/etc/nvme/hostnqn", provide a filename of ""
 	GetInitiators(filename string) ([]string, error)
+	GetInitiatorsWithContext(ctx context.Context, filename string) ([]string, error)
 
 	// NVMeTCPConnect connects into a specified NVMeTCP target
 	NVMeTCPConnect(target NVMeTarget, duplicateConnect bool) error
+	NVMeTCPConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error
+	// NVMeTCPConnectWithOptions connects into a specified NVMeTCP target with the given controller settings
+	// and reports the settings it used
+	NVMeTCPConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error)
 
 	// NVMeFCConnect connects into a specified NVMeFC target
 	NVMeFCConnect(target NVMeTarget, duplicateConnect bool) error
+	NVMeFCConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error
+	// NVMeFCConnectWithOptions connects into a specified NVMeFC target with the given controller settings
+	// and reports the settings it used
+	NVMeFCConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error)
+
+	// NVMeRDMAConnect connects into a specified NVMeRDMA target
+	NVMeRDMAConnect(target NVMeTarget, duplicateConnect bool) error
+	NVMeRDMAConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error
+	// NVMeRDMAConnectWithOptions connects into a specified NVMeRDMA target with the given controller settings
+	// and reports the settings it used
+	NVMeRDMAConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error)
+
+	// ConnectAll connects to the targets with bounded concurrency and reports the outcome per target
+	ConnectAll(ctx context.Context, targets []NVMeTarget, options ConnectAllOptions) ([]TargetConnectResult, error)
 
 	// NVMeDisconnect disconnect from the specified NVMe target
 	NVMeDisconnect(target NVMeTarget) error
+	NVMeDisconnectWithContext(ctx context.Context, target NVMeTarget) error
 
 	// ListNVMeDeviceAndNamespace returns the NVME Device Paths and Namespace of each of the NVME device
 	ListNVMeDeviceAndNamespace() ([]DevicePathAndNamespace, error)
+	ListNVMeDeviceAndNamespaceWithContext(ctx context.Context) ([]DevicePathAndNamespace, error)
 
 	// ListNVMeNamespaceID returns the namespace IDs for each NVME device path
 	ListNVMeNamespaceID(NVMeDeviceNamespace []DevicePathAndNamespace) (map[DevicePathAndNamespace][]string, error)
+	ListNVMeNamespaceIDWithContext(ctx context.Context, NVMeDeviceNamespace []DevicePathAndNamespace) (map[DevicePathAndNamespace][]string, error)
 
 	// GetNVMeDeviceData returns the information (nguid and namespace) of an NVME device path
 	GetNVMeDeviceData(path string) (string, string, error)
+	GetNVMeDeviceDataWithContext(ctx context.Context, path string) (string, string, error)
+
+	// GetNamespaceInfo returns the Identify Namespace data of an NVMe namespace device
+	GetNamespaceInfo(path string) (NamespaceInfo, error)
+	GetNamespaceInfoWithContext(ctx context.Context, path string) (NamespaceInfo, error)
+
+	// GetControllerInfo returns the Identify Controller data of an NVMe controller
+	GetControllerInfo(ctrl string) (ControllerInfo, error)
+	GetControllerInfoWithContext(ctx context.Context, ctrl string) (ControllerInfo, error)
 
 	// GetSessions queries information about NVMe sessions
 	GetSessions() ([]NVMESession, error)
+	GetSessionsWithContext(ctx context.Context) ([]NVMESession, error)
+
+	// GetNamespacePaths returns the namespaces of the NVMe subsystems with the ANA state of each path
+	GetNamespacePaths() ([]NVMeNamespacePaths, error)
+	GetNamespacePathsWithContext(ctx context.Context) ([]NVMeNamespacePaths, error)
+
+	// GetTopology returns the host with its NVMe subsystems, their controllers and namespaces
+	GetTopology() (Topology, error)
+	GetTopologyWithContext(ctx context.Context) (Topology, error)
+
+	// FindDevicesByNamespaceID returns the head and path devices of the namespace with an NGUID, UUID, EUI64 or wwid
+	FindDevicesByNamespaceID(id string) ([]NamespaceDevice, error)
+	FindDevicesByNamespaceIDWithContext(ctx context.Context, id string) ([]NamespaceDevice, error)
+
+	// WaitForNamespace waits until the block device of a namespace appears and returns the namespace
+	WaitForNamespace(ctx context.Context, identifier NamespaceIdentifier) (NVMeNamespace, error)
+
+	// GetHostIdentity returns the host NQN and host ID configured on the local system
+	GetHostIdentity() (HostIdentity, error)
+	GetHostIdentityWithContext(ctx context.Context) (HostIdentity, error)
+
+	// EnsureHostIdentity generates and writes the parts of the host identity which are missing or inconsistent
+	EnsureHostIdentity(fromDMI bool) (HostIdentity, error)
+	EnsureHostIdentityWithContext(ctx context.Context, fromDMI bool) (HostIdentity, error)
+
+	// SetHostIdentity writes the host NQN and host ID of the local system
+	SetHostIdentity(identity HostIdentity) error
+	SetHostIdentityWithContext(ctx context.Context, identity HostIdentity) error
+
+	// GetDiscoveryConf returns the discovery controllers of /etc/nvme/discovery.conf
+	GetDiscoveryConf() ([]NVMeTarget, error)
+	GetDiscoveryConfWithContext(ctx context.Context) ([]NVMeTarget, error)
+
+	// SetDiscoveryConf writes the discovery controllers of /etc/nvme/discovery.conf
+	SetDiscoveryConf(targets []NVMeTarget) error
+	SetDiscoveryConfWithContext(ctx context.Context, targets []NVMeTarget) error
+
+	// GetFabricsConfig returns the libnvme configuration of /etc/nvme/config.json
+	GetFabricsConfig() (FabricsConfig, error)
+	GetFabricsConfigWithContext(ctx context.Context) (FabricsConfig, error)
+
+	// SetFabricsConfig writes the libnvme configuration of /etc/nvme/config.json
+	SetFabricsConfig(config FabricsConfig) error
+	SetFabricsConfigWithContext(ctx context.Context, config FabricsConfig) error
+
+	// ExportSessions returns the current NVMe sessions as libnvme configuration
+	ExportSessions() (FabricsConfig, error)
+	ExportSessionsWithContext(ctx context.Context) (FabricsConfig, error)
+
+	// GetNVMeCLICapabilities returns the version of the installed nvme-cli and the features it supports
+	GetNVMeCLICapabilities() (Capabilities, error)
+	GetNVMeCLICapabilitiesWithContext(ctx context.Context) (Capabilities, error)
 
 	// generic implementations
 	isMock() bool
@@ -72,6 +173,7 @@ type NVMEinterface interface {
 
 	// DeviceRescan rescan the NVMe controller device
 	DeviceRescan(device string) error
+	DeviceRescanWithContext(ctx context.Context, device string) error
 }
 
 // NVMeType is the base structure for each platform implementation
@@ -0,0 +1,198 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+// ANAState is the asymmetric namespace access state of a path to a namespace
+type ANAState string
+
+const (
+	// ANAStateOptimized paths give the best performance
+	ANAStateOptimized ANAState = "optimized"
+	// ANAStateNonOptimized paths work with lower performance
+	ANAStateNonOptimized ANAState = "non-optimized"
+	// ANAStateInaccessible paths cannot be used for now
+	ANAStateInaccessible ANAState = "inaccessible"
+	// ANAStatePersistentLoss paths cannot be used any more
+	ANAStatePersistentLoss ANAState = "persistent-loss"
+	// ANAStateChange paths are changing their state
+	ANAStateChange ANAState = "change"
+)
+
+// NVMePath is the path to a namespace through one controller of its subsystem
+type NVMePath struct {
+	Name        string // path device, e.g. nvme0c1n1, or the namespace device without native multipath
+	Controller  string // controller name, e.g. nvme1
+	NamespaceID uint32
+	ANAGroupID  uint32           // 0 if the subsystem does not report ANA
+	ANAState    ANAState         // "" if the subsystem does not report ANA
+	State       NVMESessionState // state of the controller
+}
+
+// Optimized reports whether I/O can use the path at full performance
+func (p NVMePath) Optimized() bool {
+	return p.State == NVMESessionStateLive && p.ANAState == ANAStateOptimized
+}
+
+// NVMeNamespacePaths lists the paths to a namespace
+type NVMeNamespacePaths struct {
+	Device       string // namespace device, e.g. nvme0n1
+	SubsystemNQN string
+	NamespaceID  uint32
+	Paths        []NVMePath
+	// OptimizedPaths counts the live paths in the optimized ANA state
+	OptimizedPaths int
+}
+
+var (
+	sysfsPathRegexp      = regexp.MustCompile(`^nvme([0-9]+)c[0-9]+n([0-9]+)$`)
+	sysfsNamespaceRegexp = regexp.MustCompile(`^nvme[0-9]+n[0-9]+$`)
+)
+
+// GetNamespacePaths returns the namespaces of the NVMe subsystems with their paths and ANA states
+func (nvme *NVMe) GetNamespacePaths() ([]NVMeNamespacePaths, error) {
+	return nvme.GetNamespacePathsWithContext(context.Background())
+}
+
+// GetNamespacePathsWithContext returns the namespaces of the NVMe subsystems with their paths
+// and ANA states, read from /sys/class/nvme/nvmeY/nvmeXcYnZ/ana_state, in the order of the
+// subsystems and namespace instances
+func (nvme *NVMe) GetNamespacePathsWithContext(ctx context.Context) ([]NVMeNamespacePaths, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetNamespacePaths")()
+	if err := ctx.Err(); err != nil {
+		return []NVMeNamespacePaths{}, contextError(ctx, err)
+	}
+	return nvme.getNamespacePaths(ctx)
+}
+
+func (nvme *NVMe) getNamespacePaths(ctx context.Context) ([]NVMeNamespacePaths, error) {
+	subsystems, err := filepath.Glob(nvme.sysfsPath(sysfsNVMeSubsystemClass, "nvme-subsys*"))
+	if err != nil {
+		logger.Error(ctx, "Error gathering nvme subsystems: %v", err)
+		return []NVMeNamespacePaths{}, err
+	}
+	sortSysfsNames(subsystems)
+
+	namespaces := make([]NVMeNamespacePaths, 0)
+	for _, subsystem := range subsystems {
+		controllers, err := sysfsSubsystemControllers(subsystem)
+		if err != nil {
+			logger.Error(ctx, "Error reading nvme subsystem %s: %v", subsystem, err)
+			continue
+		}
+		subsysNQN := readSysfsAttribute(filepath.Join(subsystem, "subsysnqn"))
+		namespaces = append(namespaces, nvme.subsystemNamespacePaths(ctx, subsysNQN, controllers)...)
+	}
+	return namespaces, nil
+}
+
+// sysfsSubsystemControllers returns the names of the controllers of a subsystem directory in sysfs
+func sysfsSubsystemControllers(subsystem string) ([]string, error) {
+	entries, err := os.ReadDir(subsystem)
+	if err != nil {
+		return nil, err
+	}
+	var controllers []string
+	for _, entry := range entries {
+		if sysfsControllerRegexp.MatchString(entry.Name()) {
+			controllers = append(controllers, entry.Name())
+		}
+	}
+	sortSysfsNames(controllers)
+	return controllers, nil
+}
+
+// subsystemNamespacePaths returns the namespaces reached through the controllers of a subsystem
+func (nvme *NVMe) subsystemNamespacePaths(ctx context.Context, subsysNQN string, controllers []string) []NVMeNamespacePaths {
+	byDevice := make(map[string]*NVMeNamespacePaths)
+	var devices []string
+	for _, controller := range controllers {
+		for _, path := range nvme.controllerPaths(ctx, controller) {
+			ns, ok := byDevice[path.device]
+			if !ok {
+				ns = &NVMeNamespacePaths{Device: path.device, SubsystemNQN: subsysNQN, NamespaceID: path.NamespaceID}
+				byDevice[path.device] = ns
+				devices = append(devices, path.device)
+			}
+			ns.Paths = append(ns.Paths, path.NVMePath)
+			if path.Optimized() {
+				ns.OptimizedPaths++
+			}
+		}
+	}
+	sortSysfsNames(devices)
+	namespaces := make([]NVMeNamespacePaths, 0, len(devices))
+	for _, device := range devices {
+		namespaces = append(namespaces, *byDevice[device])
+	}
+	return namespaces
+}
+
+// controllerPath is a path through a controller and the namespace device it leads to
+type controllerPath struct {
+	NVMePath
+	device string
+}
+
+// controllerPaths returns the paths through a controller: its nvmeXcYnZ path devices with
+// native multipath, its nvmeYnZ namespace devices without
+func (nvme *NVMe) controllerPaths(ctx context.Context, controller string) []controllerPath {
+	dir := nvme.sysfsPath(sysfsNVMeClass, controller)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Error(ctx, "Error reading nvme controller %s: %v", controller, err)
+		return nil
+	}
+	state := NVMESessionState(readSysfsAttribute(filepath.Join(dir, "state")))
+	var paths []controllerPath
+	for _, entry := range entries {
+		name := entry.Name()
+		device := name
+		if m := sysfsPathRegexp.FindStringSubmatch(name); m != nil {
+			device = fmt.Sprintf("nvme%sn%s", m[1], m[2])
+		} else if !sysfsNamespaceRegexp.MatchString(name) {
+			continue
+		}
+		path := NVMePath{
+			Name:        name,
+			Controller:  controller,
+			NamespaceID: parseSysfsUint32(readSysfsAttribute(filepath.Join(dir, name, "nsid"))),
+			ANAGroupID:  parseSysfsUint32(readSysfsAttribute(filepath.Join(dir, name, "ana_grpid"))),
+			ANAState:    ANAState(readSysfsAttribute(filepath.Join(dir, name, "ana_state"))),
+			State:       state,
+		}
+		paths = append(paths, controllerPath{NVMePath: path, device: device})
+	}
+	return paths
+}
+
+// parseSysfsUint32 parses a decimal sysfs attribute, 0 if it is missing or malformed
+func parseSysfsUint32(s string) uint32 {
+	v, _ := strconv.ParseUint(s, 10, 32)
+	return uint32(v) // #nosec G115
+}
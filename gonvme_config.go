@@ -0,0 +1,446 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+const (
+	// DefaultDiscoveryConfFile lists the discovery controllers nvme connect-all uses, one per line
+	DefaultDiscoveryConfFile = "/etc/nvme/discovery.conf"
+
+	// DefaultFabricsConfigFile is the libnvme configuration of hosts, subsystems and ports
+	DefaultFabricsConfigFile = "/etc/nvme/config.json"
+
+	configFileMode = 0o600 // the configuration may hold DH-HMAC-CHAP keys and TLS PSKs
+)
+
+// FabricsConfig is the libnvme configuration of the hosts, the subsystems they connect to and their ports
+type FabricsConfig []ConfigHost
+
+// ConfigHost is a host of the libnvme configuration
+type ConfigHost struct {
+	HostNQN    string            `json:"hostnqn"`
+	HostID     string            `json:"hostid,omitempty"`
+	DHCHAPKey  string            `json:"dhchap_key,omitempty"`
+	Subsystems []ConfigSubsystem `json:"subsystems,omitempty"`
+}
+
+// ConfigSubsystem is a subsystem of the libnvme configuration
+type ConfigSubsystem struct {
+	NQN   string       `json:"nqn"`
+	Ports []ConfigPort `json:"ports,omitempty"`
+}
+
+// ConfigPort is a port of a subsystem of the libnvme configuration
+type ConfigPort struct {
+	Transport        string `json:"transport"`
+	TrAddr           string `json:"traddr,omitempty"`
+	HostTrAddr       string `json:"host_traddr,omitempty"`
+	HostIface        string `json:"host_iface,omitempty"`
+	TrSvcID          string `json:"trsvcid,omitempty"`
+	DHCHAPKey        string `json:"dhchap_key,omitempty"`
+	DHCHAPCtrlKey    string `json:"dhchap_ctrl_key,omitempty"`
+	Keyring          string `json:"keyring,omitempty"`
+	TLSKey           string `json:"tls_key,omitempty"`
+	NrIOQueues       int    `json:"nr_io_queues,omitempty"`
+	NrWriteQueues    int    `json:"nr_write_queues,omitempty"`
+	NrPollQueues     int    `json:"nr_poll_queues,omitempty"`
+	QueueSize        int    `json:"queue_size,omitempty"`
+	KeepAliveTmo     int    `json:"keep_alive_tmo,omitempty"`
+	ReconnectDelay   int    `json:"reconnect_delay,omitempty"`
+	CtrlLossTmo      *int   `json:"ctrl_loss_tmo,omitempty"`
+	FastIOFailTmo    *int   `json:"fast_io_fail_tmo,omitempty"`
+	DuplicateConnect bool   `json:"duplicate_connect,omitempty"`
+	TLS              bool   `json:"tls,omitempty"`
+	Persistent       bool   `json:"persistent,omitempty"`
+	Discovery        bool   `json:"discovery,omitempty"`
+}
+
+// ParseFabricsConfig parses a libnvme configuration
+func ParseFabricsConfig(data []byte) (FabricsConfig, error) {
+	var config FabricsConfig
+	if len(bytes.TrimSpace(data)) == 0 {
+		return config, nil
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse libnvme configuration: %w", err)
+	}
+	return config, nil
+}
+
+// Format returns the configuration in the format of libnvme
+func (config FabricsConfig) Format() ([]byte, error) {
+	if config == nil {
+		config = FabricsConfig{}
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Targets returns a target for every port of every subsystem of the configuration
+func (config FabricsConfig) Targets() []NVMeTarget {
+	targets := make([]NVMeTarget, 0)
+	for _, host := range config {
+		for _, subsystem := range host.Subsystems {
+			for _, port := range subsystem.Ports {
+				target := NVMeTarget{
+					Portal:           port.TrAddr,
+					TargetNqn:        subsystem.NQN,
+					TrType:           port.Transport,
+					TargetType:       port.Transport,
+					TrsvcID:          port.TrSvcID,
+					HostAdr:          port.HostTrAddr,
+					DHCHAPSecret:     port.DHCHAPKey,
+					DHCHAPCtrlSecret: port.DHCHAPCtrlKey,
+					TLS:              port.TLS,
+					TLSKey:           port.TLSKey,
+				}
+				if target.DHCHAPSecret == "" {
+					target.DHCHAPSecret = host.DHCHAPKey
+				}
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// NewFabricsConfig returns the libnvme configuration of a host connecting to targets
+func NewFabricsConfig(identity HostIdentity, targets []NVMeTarget) FabricsConfig {
+	host := ConfigHost{HostNQN: identity.HostNQN, HostID: identity.HostID}
+	subsystems := make(map[string]int)
+	for _, target := range targets {
+		port := newConfigPort(target)
+		i, ok := subsystems[target.TargetNqn]
+		if !ok {
+			i = len(host.Subsystems)
+			subsystems[target.TargetNqn] = i
+			host.Subsystems = append(host.Subsystems, ConfigSubsystem{NQN: target.TargetNqn})
+		}
+		if !containsPort(host.Subsystems[i].Ports, port) {
+			host.Subsystems[i].Ports = append(host.Subsystems[i].Ports, port)
+		}
+	}
+	return FabricsConfig{host}
+}
+
+func newConfigPort(target NVMeTarget) ConfigPort {
+	port := ConfigPort{
+		Transport:     targetTransport(target),
+		TrAddr:        target.Portal,
+		HostTrAddr:    target.HostAdr,
+		DHCHAPKey:     target.DHCHAPSecret,
+		DHCHAPCtrlKey: target.DHCHAPCtrlSecret,
+		TLS:           target.TLS,
+		TLSKey:        target.TLSKey,
+	}
+	if port.Transport != NVMeTransportTypeFC {
+		if host, trsvcid, err := net.SplitHostPort(target.Portal); err == nil {
+			port.TrAddr, port.TrSvcID = host, trsvcid
+		} else {
+			port.TrAddr = strings.TrimSuffix(strings.TrimPrefix(target.Portal, "["), "]")
+		}
+	}
+	if target.TrsvcID != "" {
+		port.TrSvcID = target.TrsvcID
+	}
+	return port
+}
+
+func containsPort(ports []ConfigPort, port ConfigPort) bool {
+	for _, p := range ports {
+		if p.Transport == port.Transport && p.TrAddr == port.TrAddr && p.TrSvcID == port.TrSvcID && p.HostTrAddr == port.HostTrAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// discoveryConfFlags are the nvme discover options without a value
+var discoveryConfFlags = map[string]bool{
+	"-p": true, "--persistent": true,
+	"-D": true, "--duplicate-connect": true,
+	"-d": true, "--disable-sqflow": true,
+	"-g": true, "--hdr-digest": true,
+	"-G": true, "--data-digest": true,
+	"--tls": true, "--concat": true,
+}
+
+// ParseDiscoveryConf parses the lines of a discovery.conf, each holding the nvme discover
+// options of a discovery controller, into a target per discovery controller
+func ParseDiscoveryConf(data []byte) ([]NVMeTarget, error) {
+	targets := make([]NVMeTarget, 0)
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		target, err := parseDiscoveryConfLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("discovery.conf line %d: %w", n+1, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func parseDiscoveryConfLine(line string) (NVMeTarget, error) {
+	var target NVMeTarget
+	args := strings.Fields(line)
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !strings.HasPrefix(name, "-") {
+			return NVMeTarget{}, fmt.Errorf("unexpected argument %q", args[i])
+		}
+		if name == "--tls" {
+			target.TLS = true
+			continue
+		}
+		if discoveryConfFlags[name] {
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) || strings.HasPrefix(args[i+1], "-") {
+				return NVMeTarget{}, fmt.Errorf("option %s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "-t", "--transport":
+			target.TrType, target.TargetType = value, value
+		case "-a", "--traddr":
+			target.Portal = value
+		case "-s", "--trsvcid":
+			target.TrsvcID = value
+		case "-w", "--host-traddr":
+			target.HostAdr = value
+		case "-n", "--nqn":
+			target.TargetNqn = value
+		case "-S", "--dhchap-secret":
+			target.DHCHAPSecret = value
+		case "-C", "--dhchap-ctrl-secret":
+			target.DHCHAPCtrlSecret = value
+		case "--tls_key":
+			target.TLSKey = value
+		}
+	}
+	if target.TrType == "" || target.Portal == "" {
+		return NVMeTarget{}, errors.New("expected --transport and --traddr")
+	}
+	return target, nil
+}
+
+// FormatDiscoveryConf returns a discovery.conf with a line for each discovery controller of targets
+func FormatDiscoveryConf(targets []NVMeTarget) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Used for extracting default parameters for discovery\n")
+	for _, target := range targets {
+		port := newConfigPort(target)
+		args := []string{"--transport=" + port.Transport, "--traddr=" + port.TrAddr}
+		for _, option := range []struct{ name, value string }{
+			{"--trsvcid", port.TrSvcID},
+			{"--host-traddr", port.HostTrAddr},
+			{"--nqn", target.TargetNqn},
+			{"--dhchap-secret", port.DHCHAPKey},
+			{"--dhchap-ctrl-secret", port.DHCHAPCtrlKey},
+			{"--tls_key", port.TLSKey},
+		} {
+			if option.value != "" {
+				args = append(args, option.name+"="+option.value)
+			}
+		}
+		if port.TLS {
+			args = append(args, "--tls")
+		}
+		buf.WriteString(strings.Join(args, " ") + "\n")
+	}
+	return buf.Bytes()
+}
+
+// GetDiscoveryConf returns the discovery controllers of the discovery.conf of the local system
+func (nvme *NVMe) GetDiscoveryConf() ([]NVMeTarget, error) {
+	return nvme.GetDiscoveryConfWithContext(context.Background())
+}
+
+// GetDiscoveryConfWithContext returns the discovery controllers of the discovery.conf of the
+// local system, none if it has none
+func (nvme *NVMe) GetDiscoveryConfWithContext(ctx context.Context) ([]NVMeTarget, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetDiscoveryConf")()
+	data, err := nvme.readConfigFile(ctx, DefaultDiscoveryConfFile)
+	if err != nil {
+		return []NVMeTarget{}, err
+	}
+	return ParseDiscoveryConf(data)
+}
+
+// SetDiscoveryConf writes the discovery controllers targets to the discovery.conf of the local system
+func (nvme *NVMe) SetDiscoveryConf(targets []NVMeTarget) error {
+	return nvme.SetDiscoveryConfWithContext(context.Background(), targets)
+}
+
+// SetDiscoveryConfWithContext writes the discovery controllers targets to the discovery.conf of the local system
+func (nvme *NVMe) SetDiscoveryConfWithContext(ctx context.Context, targets []NVMeTarget) error {
+	defer tracer.TraceFuncCall(ctx, "gonvme.SetDiscoveryConf")()
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+	if err := validateConfigTargets(targets); err != nil {
+		return err
+	}
+	return writeFileAtomic(nvme.hostFile(DefaultDiscoveryConfFile), FormatDiscoveryConf(targets), configFileMode)
+}
+
+// GetFabricsConfig returns the libnvme configuration of the local system
+func (nvme *NVMe) GetFabricsConfig() (FabricsConfig, error) {
+	return nvme.GetFabricsConfigWithContext(context.Background())
+}
+
+// GetFabricsConfigWithContext returns the libnvme configuration of the local system, nil if it has none
+func (nvme *NVMe) GetFabricsConfigWithContext(ctx context.Context) (FabricsConfig, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetFabricsConfig")()
+	data, err := nvme.readConfigFile(ctx, DefaultFabricsConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFabricsConfig(data)
+}
+
+// SetFabricsConfig writes the libnvme configuration of the local system
+func (nvme *NVMe) SetFabricsConfig(config FabricsConfig) error {
+	return nvme.SetFabricsConfigWithContext(context.Background(), config)
+}
+
+// SetFabricsConfigWithContext writes the libnvme configuration of the local system
+func (nvme *NVMe) SetFabricsConfigWithContext(ctx context.Context, config FabricsConfig) error {
+	defer tracer.TraceFuncCall(ctx, "gonvme.SetFabricsConfig")()
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	data, err := config.Format()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(nvme.hostFile(DefaultFabricsConfigFile), data, configFileMode)
+}
+
+// ExportSessions returns the current NVMe sessions as libnvme configuration
+func (nvme *NVMe) ExportSessions() (FabricsConfig, error) {
+	return nvme.ExportSessionsWithContext(context.Background())
+}
+
+// ExportSessionsWithContext returns the current NVMe sessions as libnvme configuration, which
+// SetFabricsConfig persists so that nvme connect-all restores the sessions at boot
+func (nvme *NVMe) ExportSessionsWithContext(ctx context.Context) (FabricsConfig, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.ExportSessions")()
+	sessions, err := nvme.GetSessionsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := nvme.readHostIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewFabricsConfig(identity, sessionTargets(sessions)), nil
+}
+
+// validate checks the host NQNs and the ports of the configuration
+func (config FabricsConfig) validate() error {
+	for _, host := range config {
+		if err := ValidateNQN(host.HostNQN); err != nil {
+			return err
+		}
+	}
+	return validateConfigTargets(config.Targets())
+}
+
+// validateConfigTargets checks that targets have an address and valid keys
+func validateConfigTargets(targets []NVMeTarget) error {
+	for _, target := range targets {
+		if targetTransport(target) == "" || target.Portal == "" {
+			return fmt.Errorf("target %s has no transport or address", target.TargetNqn)
+		}
+		if err := validateDHCHAPSecrets(target.DHCHAPSecret, target.DHCHAPCtrlSecret); err != nil {
+			return err
+		}
+		if target.TLSKey != "" {
+			if _, err := ParseTLSKey(target.TLSKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sessionTargets returns the targets the sessions are connected to, except those being deleted
+func sessionTargets(sessions []NVMESession) []NVMeTarget {
+	targets := make([]NVMeTarget, 0, len(sessions))
+	for _, session := range sessions {
+		if session.NVMESessionState == NVMESessionStateDeleting {
+			continue
+		}
+		fields := parseAddressFields(session.Address)
+		target := NVMeTarget{
+			Portal:     fields["traddr"],
+			TargetNqn:  session.Target,
+			TrType:     string(session.NVMETransportName),
+			TargetType: string(session.NVMETransportName),
+			TrsvcID:    fields["trsvcid"],
+			HostAdr:    fields["host_traddr"],
+		}
+		if target.Portal == "" {
+			target.Portal = session.Portal
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// readConfigFile returns the content of a configuration file below the ChrootDirectory, nothing if it does not exist
+func (nvme *NVMe) readConfigFile(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+	data, err := os.ReadFile(filepath.Clean(nvme.hostFile(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error(ctx, "Error reading %s: %v", name, err)
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,282 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Options of NewNVMe holding the defaults of the ConnectOptions fields with the same names
+const (
+	ConnectCtrlLossTmo    = "ctrlLossTmo"
+	ConnectReconnectDelay = "reconnectDelay"
+	ConnectKeepAliveTmo   = "keepAliveTmo"
+	ConnectFastIOFailTmo  = "fastIOFailTmo"
+	ConnectNrIOQueues     = "nrIOQueues"
+	ConnectNrWriteQueues  = "nrWriteQueues"
+	ConnectNrPollQueues   = "nrPollQueues"
+	ConnectQueueSize      = "queueSize"
+	ConnectHostNQN        = "hostNQN"
+	ConnectHostID         = "hostID"
+	ConnectHostIface      = "hostIface"
+)
+
+const (
+	// DefaultCtrlLossTmo makes the kernel try to reconnect a lost controller for ever
+	DefaultCtrlLossTmo = -1
+
+	minQueueSize  = 16
+	maxQueueSize  = 1024
+	maxIfaceBytes = 15
+)
+
+// ConnectOptions holds the controller settings of a connect. Zero values leave a setting to
+// the options of NewNVMe, and to the kernel if those do not set it either.
+type ConnectOptions struct {
+	// CtrlLossTmo is how long, in seconds, to try reconnecting a lost controller, -1 for ever.
+	// nil selects DefaultCtrlLossTmo.
+	CtrlLossTmo *int
+	// ReconnectDelay is the delay, in seconds, between reconnect attempts
+	ReconnectDelay int
+	// KeepAliveTmo is the keep alive timeout, in seconds
+	KeepAliveTmo int
+	// FastIOFailTmo is how long, in seconds, I/O is held when the controller is lost, -1 until
+	// CtrlLossTmo expires
+	FastIOFailTmo *int
+	NrIOQueues    int
+	NrWriteQueues int
+	NrPollQueues  int
+	// QueueSize is the number of entries of the I/O queues, 16 to 1024
+	QueueSize int
+	// HostNQN and HostID identify the host, instead of /etc/nvme/hostnqn and /etc/nvme/hostid
+	HostNQN string
+	HostID  string
+	// HostIface is the network interface NVMe/TCP connects through
+	HostIface string
+	// HostTraddr is the local address the connection originates from, host_traddr of the target if not set
+	HostTraddr string
+	// DuplicateConnect allows more than one connection between a host address and a subsystem port
+	DuplicateConnect bool
+}
+
+// ConnectResult reports the outcome of a connect
+type ConnectResult struct {
+	// Options are the settings the connect used, including those taken from defaults
+	Options ConnectOptions
+	// AlreadyConnected is set when the controller existed before the connect
+	AlreadyConnected bool
+}
+
+// resolveConnectOptions fills the unset fields of options from the options of NewNVMe and
+// checks them for a connect over transport
+func resolveConnectOptions(defaults map[string]string, transport string, options ConnectOptions) (ConnectOptions, error) {
+	intDefaults := []struct {
+		key   string
+		value *int
+	}{
+		{ConnectReconnectDelay, &options.ReconnectDelay},
+		{ConnectKeepAliveTmo, &options.KeepAliveTmo},
+		{ConnectNrIOQueues, &options.NrIOQueues},
+		{ConnectNrWriteQueues, &options.NrWriteQueues},
+		{ConnectNrPollQueues, &options.NrPollQueues},
+		{ConnectQueueSize, &options.QueueSize},
+	}
+	for _, d := range intDefaults {
+		if *d.value != 0 || defaults[d.key] == "" {
+			continue
+		}
+		v, err := strconv.Atoi(defaults[d.key])
+		if err != nil {
+			return ConnectOptions{}, fmt.Errorf("invalid %s option %q", d.key, defaults[d.key])
+		}
+		*d.value = v
+	}
+	for _, d := range []struct {
+		key   string
+		value **int
+	}{
+		{ConnectCtrlLossTmo, &options.CtrlLossTmo},
+		{ConnectFastIOFailTmo, &options.FastIOFailTmo},
+	} {
+		if *d.value != nil || defaults[d.key] == "" {
+			continue
+		}
+		v, err := strconv.Atoi(defaults[d.key])
+		if err != nil {
+			return ConnectOptions{}, fmt.Errorf("invalid %s option %q", d.key, defaults[d.key])
+		}
+		*d.value = &v
+	}
+	if options.CtrlLossTmo == nil {
+		v := DefaultCtrlLossTmo
+		options.CtrlLossTmo = &v
+	}
+	for _, d := range []struct {
+		key   string
+		value *string
+	}{
+		{ConnectHostNQN, &options.HostNQN},
+		{ConnectHostID, &options.HostID},
+		{ConnectHostIface, &options.HostIface},
+	} {
+		if *d.value == "" {
+			*d.value = defaults[d.key]
+		}
+	}
+	return options, options.validate(transport)
+}
+
+// validate checks that options are in the ranges the kernel accepts for transport
+func (options ConnectOptions) validate(transport string) error {
+	if options.CtrlLossTmo != nil && *options.CtrlLossTmo < -1 {
+		return fmt.Errorf("invalid ctrl-loss-tmo %d: expected -1 or more", *options.CtrlLossTmo)
+	}
+	if options.FastIOFailTmo != nil && *options.FastIOFailTmo < -1 {
+		return fmt.Errorf("invalid fast_io_fail_tmo %d: expected -1 or more", *options.FastIOFailTmo)
+	}
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"reconnect-delay", options.ReconnectDelay},
+		{"keep-alive-tmo", options.KeepAliveTmo},
+		{"nr-io-queues", options.NrIOQueues},
+		{"nr-write-queues", options.NrWriteQueues},
+		{"nr-poll-queues", options.NrPollQueues},
+	} {
+		if v.value < 0 {
+			return fmt.Errorf("invalid %s %d: expected 0 or more", v.name, v.value)
+		}
+	}
+	if options.QueueSize != 0 && (options.QueueSize < minQueueSize || options.QueueSize > maxQueueSize) {
+		return fmt.Errorf("invalid queue-size %d: expected %d to %d", options.QueueSize, minQueueSize, maxQueueSize)
+	}
+	if options.HostNQN != "" {
+		if err := ValidateNQN(options.HostNQN); err != nil {
+			return err
+		}
+	}
+	if options.HostID != "" {
+		if _, err := parseUUID(options.HostID); err != nil {
+			return fmt.Errorf("invalid host ID %q: %w", options.HostID, err)
+		}
+	}
+	if options.HostIface != "" {
+		if transport != NVMeTransportTypeTCP {
+			return fmt.Errorf("host-iface is not supported by NVMe/%s", strings.ToUpper(transport))
+		}
+		if len(options.HostIface) > maxIfaceBytes || strings.ContainsAny(options.HostIface, "/ ,") {
+			return fmt.Errorf("invalid host-iface %q", options.HostIface)
+		}
+	}
+	return nil
+}
+
+// args returns the nvme connect arguments for options, except the host address
+func (options ConnectOptions) args() []string {
+	var args []string
+	if options.CtrlLossTmo != nil {
+		args = append(args, fmt.Sprintf("--ctrl-loss-tmo=%d", *options.CtrlLossTmo))
+	}
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"--reconnect-delay", options.ReconnectDelay},
+		{"--keep-alive-tmo", options.KeepAliveTmo},
+	} {
+		if v.value != 0 {
+			args = append(args, fmt.Sprintf("%s=%d", v.name, v.value))
+		}
+	}
+	if options.FastIOFailTmo != nil {
+		args = append(args, fmt.Sprintf("--fast_io_fail_tmo=%d", *options.FastIOFailTmo))
+	}
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"--nr-io-queues", options.NrIOQueues},
+		{"--nr-write-queues", options.NrWriteQueues},
+		{"--nr-poll-queues", options.NrPollQueues},
+		{"--queue-size", options.QueueSize},
+	} {
+		if v.value != 0 {
+			args = append(args, fmt.Sprintf("%s=%d", v.name, v.value))
+		}
+	}
+	for _, v := range []struct {
+		name  string
+		value string
+	}{
+		{"--hostnqn", options.HostNQN},
+		{"--hostid", options.HostID},
+		{"--host-iface", options.HostIface},
+	} {
+		if v.value != "" {
+			args = append(args, v.name+"="+v.value)
+		}
+	}
+	if options.DuplicateConnect {
+		args = append(args, "-D")
+	}
+	return args
+}
+
+// fabricsOptions returns the fabrics device options for options, except the host identity and address
+func (options ConnectOptions) fabricsOptions() []string {
+	var fabrics []string
+	if options.CtrlLossTmo != nil {
+		fabrics = append(fabrics, fmt.Sprintf("ctrl_loss_tmo=%d", *options.CtrlLossTmo))
+	}
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"reconnect_delay", options.ReconnectDelay},
+		{"keep_alive_tmo", options.KeepAliveTmo},
+	} {
+		if v.value != 0 {
+			fabrics = append(fabrics, fmt.Sprintf("%s=%d", v.name, v.value))
+		}
+	}
+	if options.FastIOFailTmo != nil {
+		fabrics = append(fabrics, fmt.Sprintf("fast_io_fail_tmo=%d", *options.FastIOFailTmo))
+	}
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"nr_io_queues", options.NrIOQueues},
+		{"nr_write_queues", options.NrWriteQueues},
+		{"nr_poll_queues", options.NrPollQueues},
+		{"queue_size", options.QueueSize},
+	} {
+		if v.value != 0 {
+			fabrics = append(fabrics, fmt.Sprintf("%s=%d", v.name, v.value))
+		}
+	}
+	if options.HostIface != "" {
+		fabrics = append(fabrics, "host_iface="+options.HostIface)
+	}
+	if options.DuplicateConnect {
+		fabrics = append(fabrics, "duplicate_connect")
+	}
+	return fabrics
+}
@@ -0,0 +1,153 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+// DefaultConnectConcurrency is how many connects ConnectAll runs at a time when
+// ConnectAllOptions does not say otherwise
+const DefaultConnectConcurrency = 4
+
+// ConnectAllOptions controls a ConnectAll
+type ConnectAllOptions struct {
+	// Options are the controller settings of every connect
+	Options ConnectOptions
+	// Concurrency is how many connects run at a time, DefaultConnectConcurrency if not set
+	Concurrency int
+	// StopOnFailure stops starting connects once one failed; the targets not connected
+	// fail with ErrConnectSkipped
+	StopOnFailure bool
+}
+
+// TargetConnectResult reports the outcome of the connect to one target of a ConnectAll
+type TargetConnectResult struct {
+	Target NVMeTarget
+	ConnectResult
+	// Err is nil if the connect succeeded or the target was already connected
+	Err error
+	// Duration is how long the connect took
+	Duration time.Duration
+}
+
+// connectFunc connects to one target
+type connectFunc func(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error)
+
+// ConnectAll connects to the targets, NVMe/TCP, NVMe/FC or NVMe/RDMA ones as their transport
+// says, with bounded concurrency. It returns a result per target in the order of targets,
+// and an error joining those of the targets which failed to connect.
+func (nvme *NVMe) ConnectAll(ctx context.Context, targets []NVMeTarget, options ConnectAllOptions) ([]TargetConnectResult, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.ConnectAll")()
+	return connectAll(ctx, targets, options, nvme.connectTarget)
+}
+
+// connectTarget connects to target over its transport
+func (nvme *NVMe) connectTarget(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	switch transport := targetTransport(target); transport {
+	case NVMeTransportTypeTCP:
+		return nvme.nvmeTCPConnectWithOptions(ctx, target, options)
+	case NVMeTransportTypeFC:
+		return nvme.nvmeFCConnectWithOptions(ctx, target, options)
+	case NVMeTransportTypeRDMA:
+		return nvme.nvmeRDMAConnectWithOptions(ctx, target, options)
+	default:
+		return ConnectResult{}, fmt.Errorf("unknown transport %q", transport)
+	}
+}
+
+// targetTransport returns the transport of target, as discovery or the caller set it
+func targetTransport(target NVMeTarget) string {
+	if target.TargetType != "" {
+		return target.TargetType
+	}
+	return target.TrType
+}
+
+// connectAll runs connect for each target with at most options.Concurrency at a time
+func connectAll(ctx context.Context, targets []NVMeTarget, options ConnectAllOptions, connect connectFunc) ([]TargetConnectResult, error) {
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConnectConcurrency
+	}
+	results := make([]TargetConnectResult, len(targets))
+	for i, target := range targets {
+		results[i].Target = target
+	}
+
+	var mu sync.Mutex
+	failed := false
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, len(targets)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				start := time.Now()
+				result, err := connect(ctx, targets[i], options.Options)
+				results[i].ConnectResult, results[i].Err, results[i].Duration = result, err, time.Since(start)
+				if err != nil {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	// the targets from started on are not connected when ctx is done or a failure stops the connects
+	started := 0
+	var skipped error
+	for ; started < len(targets); started++ {
+		if err := ctx.Err(); err != nil {
+			skipped = contextError(ctx, err)
+			break
+		}
+		mu.Lock()
+		stop := failed && options.StopOnFailure
+		mu.Unlock()
+		if stop {
+			skipped = ErrConnectSkipped
+			break
+		}
+		next <- started
+	}
+	close(next)
+	wg.Wait()
+	for i := started; i < len(targets); i++ {
+		results[i].Err = skipped
+	}
+
+	var errs []error
+	connected := 0
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("connect %s at %s: %w", result.Target.TargetNqn, result.Target.Portal, result.Err))
+		} else {
+			connected++
+		}
+	}
+	logger.Info(ctx, "connected %d of %d NVMe targets", connected, len(targets))
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,230 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DHCHAPHostSecret is the option holding the host key used for DH-HMAC-CHAP
+	// in-band authentication by discovery, and by connects to targets without their own
+	DHCHAPHostSecret = "dhchapSecret"
+
+	// DHCHAPControllerSecret is the option holding the controller key for bidirectional
+	// authentication, used like DHCHAPHostSecret
+	DHCHAPControllerSecret = "dhchapCtrlSecret"
+
+	dhchapKeyPrefix = "DHHC-1"
+)
+
+// DHCHAPHash is the hash function a DH-HMAC-CHAP key is transformed with
+type DHCHAPHash int
+
+// Hash functions of DH-HMAC-CHAP keys, as in the DHHC-1:<hash>:... key format
+const (
+	DHCHAPHashNone   DHCHAPHash = 0
+	DHCHAPHashSHA256 DHCHAPHash = 1
+	DHCHAPHashSHA384 DHCHAPHash = 2
+	DHCHAPHashSHA512 DHCHAPHash = 3
+)
+
+// keyLength returns the length of keys transformed with h, 0 if they are not
+func (h DHCHAPHash) keyLength() int {
+	switch h {
+	case DHCHAPHashSHA256:
+		return sha256.Size
+	case DHCHAPHashSHA384:
+		return sha512.Size384
+	case DHCHAPHashSHA512:
+		return sha512.Size
+	}
+	return 0
+}
+
+func (h DHCHAPHash) new() func() hash.Hash {
+	switch h {
+	case DHCHAPHashSHA256:
+		return sha256.New
+	case DHCHAPHashSHA384:
+		return sha512.New384
+	}
+	return sha512.New
+}
+
+// ValidateDHCHAPKey checks that key is a DH-HMAC-CHAP key in the DHHC-1:<hash>:<base64>: format
+// nvme gen-dhchap-key generates: a known hash, a key of 32, 48 or 64 bytes matching the hash,
+// followed by its CRC-32.
+func ValidateDHCHAPKey(key string) error {
+	fields := strings.Split(key, ":")
+	if len(fields) != 4 || fields[0] != dhchapKeyPrefix || fields[3] != "" {
+		return errors.New("invalid DH-HMAC-CHAP key: expected DHHC-1:<hash>:<key>:")
+	}
+	id, err := strconv.ParseUint(fields[1], 16, 8)
+	if err != nil || len(fields[1]) != 2 || id > uint64(DHCHAPHashSHA512) {
+		return fmt.Errorf("invalid DH-HMAC-CHAP key: unknown hash %q", fields[1])
+	}
+	data, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return errors.New("invalid DH-HMAC-CHAP key: malformed base64")
+	}
+	secret := data[:max(len(data)-crc32.Size, 0)]
+	switch len(secret) {
+	case 32, 48, 64:
+	default:
+		return fmt.Errorf("invalid DH-HMAC-CHAP key: unexpected key length %d", len(secret))
+	}
+	if length := DHCHAPHash(id).keyLength(); length != 0 && length != len(secret) {
+		return fmt.Errorf("invalid DH-HMAC-CHAP key: key length %d does not match hash %s", len(secret), fields[1])
+	}
+	if binary.LittleEndian.Uint32(data[len(secret):]) != crc32.ChecksumIEEE(secret) {
+		return errors.New("invalid DH-HMAC-CHAP key: CRC mismatch")
+	}
+	return nil
+}
+
+// GenerateDHCHAPKey generates a random host key like nvme gen-dhchap-key. A key transformed
+// with a hash is bound to hostNQN and its length is that of the hash; keyLength, 32, 48 or 64,
+// is only used without one, where 0 selects 32 bytes.
+func GenerateDHCHAPKey(h DHCHAPHash, keyLength int, hostNQN string) (string, error) {
+	if h < DHCHAPHashNone || h > DHCHAPHashSHA512 {
+		return "", fmt.Errorf("unknown DH-HMAC-CHAP hash %d", h)
+	}
+	if length := h.keyLength(); length != 0 {
+		if keyLength != 0 && keyLength != length {
+			return "", fmt.Errorf("key length %d does not match DH-HMAC-CHAP hash %d", keyLength, h)
+		}
+		if hostNQN == "" {
+			return "", errors.New("a host NQN is required to transform a DH-HMAC-CHAP key")
+		}
+		keyLength = length
+	}
+	switch keyLength {
+	case 0:
+		keyLength = 32
+	case 32, 48, 64:
+	default:
+		return "", fmt.Errorf("invalid DH-HMAC-CHAP key length %d", keyLength)
+	}
+
+	secret := make([]byte, keyLength)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	if h != DHCHAPHashNone {
+		mac := hmac.New(h.new(), secret)
+		mac.Write([]byte(hostNQN))
+		mac.Write([]byte("NVMe-over-Fabrics"))
+		secret = mac.Sum(nil)
+	}
+	data := binary.LittleEndian.AppendUint32(secret, crc32.ChecksumIEEE(secret))
+	return fmt.Sprintf("%s:%02x:%s:", dhchapKeyPrefix, int(h), base64.StdEncoding.EncodeToString(data)), nil
+}
+
+var secretRegexp = regexp.MustCompile(`((?:DHHC-1|NVMeTLSkey-1):[0-9a-fA-F]{2}:)[^:\s,]*:?`)
+
+// RedactSecrets replaces the DH-HMAC-CHAP keys and TLS PSKs in s, e.g. a command line or
+// its output, so that s can be logged
+func RedactSecrets(s string) string {
+	return secretRegexp.ReplaceAllString(s, "${1}<redacted>:")
+}
+
+// redactedError hides the secrets in the message of the error it wraps
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return RedactSecrets(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError returns err with the secrets in its message hidden
+func redactError(err error) error {
+	if err == nil || !secretRegexp.MatchString(err.Error()) {
+		return err
+	}
+	return &redactedError{err: err}
+}
+
+// dhchapSecrets returns the host and controller keys used for target, its own or those of the options
+func (nvme *NVMe) dhchapSecrets(target NVMeTarget) (string, string) {
+	if target.DHCHAPSecret != "" || target.DHCHAPCtrlSecret != "" {
+		return target.DHCHAPSecret, target.DHCHAPCtrlSecret
+	}
+	return nvme.options[DHCHAPHostSecret], nvme.options[DHCHAPControllerSecret]
+}
+
+// validateDHCHAPSecrets checks the host and controller keys, either of which may be empty.
+// Bidirectional authentication needs both keys.
+func validateDHCHAPSecrets(hostSecret, ctrlSecret string) error {
+	if ctrlSecret != "" && hostSecret == "" {
+		return errors.New("a DH-HMAC-CHAP controller key requires a host key")
+	}
+	for _, key := range []string{hostSecret, ctrlSecret} {
+		if key == "" {
+			continue
+		}
+		if err := ValidateDHCHAPKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dhchapArgs returns the nvme connect and nvme discover arguments authenticating target,
+// none when it has no keys
+func (nvme *NVMe) dhchapArgs(ctx context.Context, target NVMeTarget) ([]string, error) {
+	hostSecret, ctrlSecret := nvme.dhchapSecrets(target)
+	if hostSecret == "" && ctrlSecret == "" {
+		return nil, nil
+	}
+	if err := validateDHCHAPSecrets(hostSecret, ctrlSecret); err != nil {
+		return nil, err
+	}
+	if err := nvme.requireCapability(ctx, FeatureDHCHAPSecret); err != nil {
+		return nil, err
+	}
+	args := []string{"--dhchap-secret=" + hostSecret}
+	if ctrlSecret != "" {
+		args = append(args, "--dhchap-ctrl-secret="+ctrlSecret)
+	}
+	return args, nil
+}
+
+// isAuthFailure reports whether nvme-cli failed because the controller rejected the keys
+func isAuthFailure(output string) bool {
+	return strings.Contains(output, "Permission denied") ||
+		strings.Contains(output, "Key was rejected") ||
+		strings.Contains(output, "authentication failed")
+}
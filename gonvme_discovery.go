@@ -0,0 +1,254 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/nvmetcp"
+)
+
+// runNVMeDiscover runs nvme discover with args and returns the discovery log it reports,
+// asking for JSON output if the installed nvme-cli supports it. When its version is not
+// known, nvme discover is run again without JSON output if it rejects it.
+func (nvme *NVMe) runNVMeDiscover(ctx context.Context, args []string) (DiscoveryLog, error) {
+	auth, err := nvme.dhchapArgs(ctx, NVMeTarget{})
+	if err != nil {
+		return DiscoveryLog{}, err
+	}
+	exe := append(append([]string{NVMeCommand, "discover"}, args...), auth...)
+	capabilities, capErr := nvme.getCapabilities(ctx)
+	if capErr == nil && !capabilities.DiscoverJSON {
+		result, err := nvme.runNVMeCommand(ctx, exe)
+		if err != nil {
+			return DiscoveryLog{}, discoverError(auth, result, err)
+		}
+		return parseDiscoveryLogText(result.Stdout), nil
+	}
+	result, err := nvme.runNVMeCommand(ctx, append(exe, "-o", "json"))
+	if err != nil && ctx.Err() == nil && capErr != nil && isUnsupportedOutputFormat(result) {
+		logger.Debug(ctx, "nvme discover does not support JSON output, retrying without it")
+		result, err = nvme.runNVMeCommand(ctx, exe)
+	}
+	if err != nil {
+		return DiscoveryLog{}, discoverError(auth, result, err)
+	}
+	return parseDiscoveryLog(result.Stdout)
+}
+
+// discoverError returns ErrAuthFailed for an authenticated discovery the controller rejected, err otherwise
+func discoverError(auth []string, result CommandResult, err error) error {
+	if output := RedactSecrets(lastLine(result.Stderr)); len(auth) > 0 && isAuthFailure(output) {
+		return withKind(err, ErrAuthFailed)
+	}
+	return err
+}
+
+// isUnsupportedOutputFormat reports whether nvme-cli rejected the -o option
+func isUnsupportedOutputFormat(result CommandResult) bool {
+	stderr := string(result.Stderr)
+	return strings.Contains(stderr, "unrecognized option") ||
+		strings.Contains(stderr, "invalid option") ||
+		strings.Contains(stderr, "Invalid output format")
+}
+
+// parseDiscoveryLog parses the output of nvme discover, either JSON or text
+func parseDiscoveryLog(out []byte) (DiscoveryLog, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(out), []byte("{")) {
+		return parseDiscoveryLogJSON(out)
+	}
+	return parseDiscoveryLogText(out), nil
+}
+
+// discoveryLogJSON is the output of nvme discover -o json. nvme-cli 1.x reports neither
+// numrec, cntlid nor asqsz, and versions differ in whether eflags is a number or a string.
+type discoveryLogJSON struct {
+	GenCtr  uint64  `json:"genctr"`
+	NumRec  *uint64 `json:"numrec"`
+	Records []struct {
+		TrType  string          `json:"trtype"`
+		AdrFam  string          `json:"adrfam"`
+		SubType string          `json:"subtype"`
+		Treq    string          `json:"treq"`
+		PortID  uint16          `json:"portid"`
+		TrSvcID string          `json:"trsvcid"`
+		SubNQN  string          `json:"subnqn"`
+		TrAddr  string          `json:"traddr"`
+		EFlags  json.RawMessage `json:"eflags"`
+		CntlID  uint16          `json:"cntlid"`
+		AsqSz   uint16          `json:"asqsz"`
+		SecType string          `json:"sectype"`
+	} `json:"records"`
+}
+
+func parseDiscoveryLogJSON(out []byte) (DiscoveryLog, error) {
+	var response discoveryLogJSON
+	if err := json.Unmarshal(out, &response); err != nil {
+		return DiscoveryLog{}, fmt.Errorf("failed to parse discovery log: %w", err)
+	}
+	log := DiscoveryLog{GenCtr: response.GenCtr, NumRec: uint64(len(response.Records))}
+	if response.NumRec != nil {
+		log.NumRec = *response.NumRec
+	}
+	for _, record := range response.Records {
+		log.Entries = append(log.Entries, DiscoveryLogEntry{
+			TrType:  record.TrType,
+			AdrFam:  record.AdrFam,
+			SubType: record.SubType,
+			Treq:    record.Treq,
+			PortID:  record.PortID,
+			CntlID:  record.CntlID,
+			AsqSz:   record.AsqSz,
+			EFlags:  parseEFlagsJSON(record.EFlags),
+			TrSvcID: record.TrSvcID,
+			SubNQN:  record.SubNQN,
+			TrAddr:  record.TrAddr,
+			SecType: record.SecType,
+		})
+	}
+	return log, nil
+}
+
+func parseEFlagsJSON(raw json.RawMessage) string {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return name
+	}
+	var flags uint16
+	if err := json.Unmarshal(raw, &flags); err == nil {
+		return nvmetcp.EFlagsName(flags)
+	}
+	return ""
+}
+
+// parseDiscoveryLogText parses the text output of nvme discover, which looks like:
+//
+//	Discovery Log Number of Records 2, Generation counter 2
+//	=====Discovery Log Entry 0======
+//	trtype:  fc
+//	adrfam:  fibre-channel
+//	subtype: nvme subsystem
+//	treq:    not specified
+//	portid:  0
+//	trsvcid: none
+//	subnqn:  nqn.1111-11.com.dell:powerstore:00:a1a1a1a111a1111a111a
+//	traddr:  nn-0x11aaa111a1111a11:aa-0x11aaa11111111a11
+//	=====Discovery Log Entry 1======
+//	trtype:  tcp
+//	adrfam:  ipv4
+//	subtype: nvme subsystem
+//	treq:    not specified
+//	portid:  2304
+//	trsvcid: 4420
+//	subnqn:  nqn.1111-11.com.dell:powerstore:00:a1a1a1a111a1111a111a
+//	traddr:  1.1.1.1
+//	eflags:  none
+//	sectype: none
+//
+// eflags is reported by nvme-cli 2.x only.
+func parseDiscoveryLogText(out []byte) DiscoveryLog {
+	var log DiscoveryLog
+	var entry *DiscoveryLogEntry
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Discovery Log Number of Records") {
+			_, _ = fmt.Sscanf(line, "Discovery Log Number of Records %d, Generation counter %d", &log.NumRec, &log.GenCtr)
+			continue
+		}
+		if strings.HasPrefix(line, "=====Discovery Log Entry") {
+			log.Entries = append(log.Entries, DiscoveryLogEntry{})
+			entry = &log.Entries[len(log.Entries)-1]
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found || entry == nil {
+			continue
+		}
+		value = strings.Join(strings.Fields(value), " ")
+		switch key {
+		case "trtype":
+			entry.TrType = value
+		case "adrfam":
+			entry.AdrFam = value
+		case "subtype":
+			entry.SubType = value
+		case "treq":
+			entry.Treq = value
+		case "portid":
+			entry.PortID = parseUint16(value)
+		case "cntlid":
+			entry.CntlID = parseUint16(value)
+		case "asqsz":
+			entry.AsqSz = parseUint16(value)
+		case "eflags":
+			entry.EFlags = value
+		case "trsvcid":
+			entry.TrSvcID = value
+		case "subnqn":
+			entry.SubNQN = value
+		case "traddr":
+			entry.TrAddr = value
+		case "sectype":
+			entry.SecType = value
+		}
+	}
+	return log
+}
+
+func parseUint16(s string) uint16 {
+	v, _ := strconv.ParseUint(s, 0, 16)
+	return uint16(v) // #nosec G115
+}
+
+// targets returns the entries of the discovery log for the given transport
+func (log DiscoveryLog) targets(transport string) []NVMeTarget {
+	targets := make([]NVMeTarget, 0)
+	for _, entry := range log.Entries {
+		if entry.TrType != transport {
+			continue
+		}
+		target := NVMeTarget{
+			Portal:     entry.TrAddr,
+			TargetNqn:  entry.SubNQN,
+			TrType:     entry.TrType,
+			AdrFam:     entry.AdrFam,
+			SubType:    entry.SubType,
+			Treq:       entry.Treq,
+			PortID:     strconv.Itoa(int(entry.PortID)),
+			TrsvcID:    entry.TrSvcID,
+			SecType:    entry.SecType,
+			TargetType: entry.TrType,
+			EFlags:     entry.EFlags,
+			GenCtr:     log.GenCtr,
+			NumRec:     log.NumRec,
+		}
+		if entry.CntlID != 0 {
+			target.CntlID = strconv.Itoa(int(entry.CntlID))
+		}
+		if entry.AsqSz != 0 {
+			target.AsqSz = strconv.Itoa(int(entry.AsqSz))
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
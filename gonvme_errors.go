@@ -0,0 +1,183 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// ErrTimeout is returned when an operation did not complete before the deadline of its context
+var ErrTimeout = errors.New("gonvme: operation timed out")
+
+// ErrAuthFailed is returned when a controller rejects the DH-HMAC-CHAP keys of the host
+var ErrAuthFailed = errors.New("gonvme: in-band authentication failed")
+
+// ErrAlreadyConnected is matched by the errors of nvme-cli commands reporting that the controller
+// they create exists. Connects to a target the host is connected to do not fail: they return
+// no error and set ConnectResult.AlreadyConnected. They return this error only when nvme-cli
+// reports the connection in a way its version does not, e.g. exit code 114 from nvme-cli 2.x.
+var ErrAlreadyConnected = errors.New("gonvme: already connected")
+
+// ErrNoObjectsFound is matched by the errors of nvme-cli commands which found nothing to work on,
+// e.g. no subsystems, sessions or namespaces
+var ErrNoObjectsFound = errors.New("gonvme: no objects found")
+
+// ErrTargetUnreachable is matched by the errors of discoveries and connects which could not
+// reach the target
+var ErrTargetUnreachable = errors.New("gonvme: target unreachable")
+
+// ErrNoFCHosts is returned by NVMe/FC operations on hosts without Fibre Channel ports
+var ErrNoFCHosts = errors.New("gonvme: no FC hosts found")
+
+// ErrConnectSkipped is the error of the targets ConnectAll did not connect after a failure
+// stopped it
+var ErrConnectSkipped = errors.New("gonvme: connect skipped after a failure")
+
+// ErrNotSupported is matched by the errors of features the installed nvme-cli does not support
+var ErrNotSupported = errors.New("gonvme: not supported by installed nvme-cli")
+
+// NotSupportedError reports a feature the installed nvme-cli does not support
+type NotSupportedError struct {
+	Feature string
+	Version Version
+}
+
+func (e *NotSupportedError) Error() string {
+	return fmt.Sprintf("gonvme: %s is not supported by installed nvme-cli %s", e.Feature, e.Version)
+}
+
+// Is makes errors.Is(err, ErrNotSupported) true for a NotSupportedError
+func (e *NotSupportedError) Is(target error) bool {
+	return target == ErrNotSupported
+}
+
+// CommandError is the failure of an nvme-cli command. errors.Is matches it with its Kind,
+// one of the sentinel errors of gonvme, when nvme-cli reported a known failure.
+type CommandError struct {
+	// Command is the command line, with its secrets redacted
+	Command []string
+	// ExitCode is the exit status of the command, -1 if it could not be run
+	ExitCode int
+	// Stderr is the error output of the command, with its secrets redacted
+	Stderr string
+	// Kind classifies the failure, nil if it is not known
+	Kind error
+
+	err error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s: %v", strings.Join(e.Command, " "), e.err)
+	if line := lastLine([]byte(e.Stderr)); line != "" {
+		msg += ": " + line
+	}
+	if e.Kind != nil {
+		msg = fmt.Sprintf("%v: %s", e.Kind, msg)
+	}
+	return RedactSecrets(msg)
+}
+
+// Unwrap returns the kind of the failure and the error of running the command
+func (e *CommandError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.err}
+	}
+	return []error{e.Kind, e.err}
+}
+
+// newCommandError returns the CommandError of cmd, which failed with err
+func newCommandError(cmd []string, result CommandResult, err error) *CommandError {
+	command := make([]string, len(cmd))
+	for i, arg := range cmd {
+		command[i] = RedactSecrets(arg)
+	}
+	stderr := RedactSecrets(strings.TrimSpace(string(result.Stderr)))
+	return &CommandError{
+		Command:  command,
+		ExitCode: result.ExitCode,
+		Stderr:   stderr,
+		Kind:     classifyExitCode(result.ExitCode, stderr),
+		err:      err,
+	}
+}
+
+// classifyExitCode returns the kind of failure an nvme-cli exit status and error output
+// report, nil if it is not known. nvme-cli 1.x exits with the errno of the failure,
+// nvme-cli 2.x with 1 and a message.
+func classifyExitCode(exitCode int, stderr string) error {
+	switch {
+	case exitCode == NVMeNoObjsFoundExitCode:
+		return ErrNoObjectsFound
+	case strings.Contains(stderr, NVMEAlreadyConnected), strings.Contains(stderr, "Operation already in progress"):
+		return ErrAlreadyConnected
+	case exitCode > 0 && exitCode < 256:
+		if kind := errnoKind(syscall.Errno(exitCode)); kind != nil { // #nosec G115
+			return kind
+		}
+	}
+	// nvme-cli and libnvme spell the errno messages with either case
+	for _, msg := range []string{"connection refused", "no route to host", "network is unreachable", "connection timed out", "failed to connect"} {
+		if strings.Contains(strings.ToLower(stderr), msg) {
+			return ErrTargetUnreachable
+		}
+	}
+	return nil
+}
+
+// errnoKind returns the kind of failure a connect or discovery failing with errno reports, nil if it is not known
+func errnoKind(errno syscall.Errno) error {
+	switch errno {
+	case syscall.EALREADY:
+		return ErrAlreadyConnected
+	case syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.EHOSTUNREACH, syscall.ENETUNREACH, syscall.ETIMEDOUT:
+		return ErrTargetUnreachable
+	case syscall.EKEYREJECTED:
+		return ErrAuthFailed
+	}
+	return nil
+}
+
+// withKind returns err classified as kind, which takes precedence over the kind nvme-cli reported
+func withKind(err error, kind error) error {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		cmdErr.Kind = kind
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// contextError converts the error of an operation interrupted by ctx into one the caller can
+// tell apart: ErrTimeout for an expired deadline, context.Canceled for a cancellation.
+// err is returned unchanged when it is nil or ctx is still live.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch ctx.Err() {
+	case nil:
+		return err
+	case context.DeadlineExceeded:
+		return fmt.Errorf("%w: %w", ErrTimeout, context.DeadlineExceeded)
+	default:
+		return fmt.Errorf("gonvme: operation canceled: %w", ctx.Err())
+	}
+}
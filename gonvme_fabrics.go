@@ -0,0 +1,267 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/dell/gonvme/internal/logger"
+)
+
+const (
+	// ConnectBackend selects how NVMe connects to and disconnects from targets,
+	// either BackendNVMeCLI (the default) or BackendFabrics
+	ConnectBackend = "connectBackend"
+
+	// BackendFabrics talks to the kernel through the fabrics device and sysfs, without nvme-cli
+	BackendFabrics = "fabrics"
+
+	// FabricsDevice overrides the path of the fabrics device used by BackendFabrics
+	FabricsDevice = "fabricsDevice"
+
+	// DefaultFabricsDevice is the character device the kernel exposes for fabrics connects
+	DefaultFabricsDevice = "/dev/nvme-fabrics"
+
+	// DefaultHostIDFile is the default file which contains the host identifier
+	DefaultHostIDFile = "/etc/nvme/hostid"
+)
+
+// openFabricsDevice opens the fabrics device for a single connect request
+func openFabricsDevice(path string) (io.ReadWriteCloser, error) {
+	return os.OpenFile(filepath.Clean(path), os.O_RDWR, 0) // #nosec G304
+}
+
+func (nvme *NVMe) getFabricsDevice() string {
+	device := nvme.options[FabricsDevice]
+	if device == "" {
+		device = DefaultFabricsDevice
+	}
+	return filepath.Join(nvme.getChrootDirectory(), device)
+}
+
+// getHostIdentity returns the host NQN and host ID nvme-cli would use, "" for those not configured
+func (nvme *NVMe) getHostIdentity(ctx context.Context) (string, string) {
+	var hostNQN string
+	if nqns, err := nvme.getInitiators(ctx, ""); err == nil && len(nqns) > 0 {
+		hostNQN = nqns[0]
+	}
+	return hostNQN, readSysfsAttribute(filepath.Join(nvme.getChrootDirectory(), DefaultHostIDFile))
+}
+
+// fabricsConnectOptions builds the option string the kernel expects on the fabrics device,
+// with the same defaults nvme connect uses
+func (nvme *NVMe) fabricsConnectOptions(ctx context.Context, transport string, target NVMeTarget, connectOptions ConnectOptions) (string, error) {
+	options := []string{
+		"nqn=" + target.TargetNqn,
+		"transport=" + transport,
+	}
+	switch transport {
+	case NVMeTransportTypeTCP, NVMeTransportTypeRDMA:
+		address, port, err := targetAddress(target)
+		if err != nil {
+			return "", err
+		}
+		options = append(options, "traddr="+address, "trsvcid="+port)
+		if target.HostAdr != "" {
+			options = append(options, "host_traddr="+target.HostAdr)
+		}
+	case NVMeTransportTypeFC:
+		options = append(options, "traddr="+target.Portal, "host_traddr="+target.HostAdr)
+	}
+	hostNQN, hostID := nvme.getHostIdentity(ctx)
+	if connectOptions.HostNQN != "" {
+		hostNQN = connectOptions.HostNQN
+	}
+	if connectOptions.HostID != "" {
+		hostID = connectOptions.HostID
+	}
+	if hostNQN != "" {
+		options = append(options, "hostnqn="+hostNQN)
+	}
+	if hostID != "" {
+		options = append(options, "hostid="+hostID)
+	}
+	hostSecret, ctrlSecret := nvme.dhchapSecrets(target)
+	if err := validateDHCHAPSecrets(hostSecret, ctrlSecret); err != nil {
+		return "", err
+	}
+	if hostSecret != "" {
+		options = append(options, "dhchap_secret="+hostSecret)
+	}
+	if ctrlSecret != "" {
+		options = append(options, "dhchap_ctrl_secret="+ctrlSecret)
+	}
+	if transport == NVMeTransportTypeTCP && useTLS(target) {
+		// the kernel takes the serial numbers of keys, not their names or contents,
+		// so the PSK is left to the lookup in the default keyring
+		if target.TLSKey != "" || nvme.options[TLSKeyring] != "" {
+			return "", errors.New("the fabrics backend supports TLS with the PSKs of the default keyring only")
+		}
+		options = append(options, "tls")
+	}
+	options = append(options, connectOptions.fabricsOptions()...)
+	return strings.Join(options, ","), nil
+}
+
+// fabricsConnect connects to target by writing its options to the fabrics device and reports
+// whether a controller already existed for the target, which is not treated as a failure.
+func (nvme *NVMe) fabricsConnect(ctx context.Context, transport string, target NVMeTarget, connectOptions ConnectOptions) (bool, error) {
+	options, err := nvme.fabricsConnectOptions(ctx, transport, target, connectOptions)
+	if err != nil {
+		logger.Error(ctx, "Error during NVMe/%s connect %s at %s: %v", transport, target.TargetNqn, target.Portal, err)
+		return false, err
+	}
+	device := nvme.getFabricsDevice()
+
+	done := make(chan fabricsResult, 1)
+	go func() {
+		response, err := writeFabricsDevice(nvme.openFabrics, device, options)
+		done <- fabricsResult{response, err}
+	}()
+
+	var result fabricsResult
+	select {
+	case <-ctx.Done():
+		// the kernel does not abort a pending connect, the request finishes in the background
+		err := contextError(ctx, ctx.Err())
+		logger.Error(ctx, "Error during NVMe/%s connect %s at %s: %v", transport, target.TargetNqn, target.Portal, err)
+		go nvme.deleteAbandonedController(context.WithoutCancel(ctx), target, done)
+		return false, err
+	case result = <-done:
+	}
+
+	if errors.Is(result.err, syscall.EALREADY) {
+		logger.Info(ctx, "NVMe connection already exists")
+		return true, nil
+	}
+	if result.err != nil {
+		// the kernel rejects the connect with EKEYREJECTED when authentication fails, and with
+		// the errno of the transport when the target cannot be reached
+		var errno syscall.Errno
+		if errors.As(result.err, &errno) {
+			if kind := errnoKind(errno); kind != nil {
+				result.err = fmt.Errorf("%w: %w", kind, result.err)
+			}
+		}
+		logger.Error(ctx, "Error during NVMe/%s connect %s at %s: %v", transport, target.TargetNqn, target.Portal, result.err)
+		return false, result.err
+	}
+
+	instance, cntlid, err := parseFabricsResponse(result.response)
+	if err != nil {
+		logger.Error(ctx, "Error during NVMe/%s connect %s at %s: %v", transport, target.TargetNqn, target.Portal, err)
+		return false, err
+	}
+	logger.Info(ctx, "NVMe/%s connect successful: %s as nvme%d (cntlid %d)", transport, target.TargetNqn, instance, cntlid)
+	return false, nil
+}
+
+// fabricsResult is the outcome of a connect request written to the fabrics device
+type fabricsResult struct {
+	response string
+	err      error
+}
+
+// deleteAbandonedController waits for a connect the caller gave up on, and deletes the
+// controller the kernel created after all since the caller took the connect for failed
+func (nvme *NVMe) deleteAbandonedController(ctx context.Context, target NVMeTarget, done <-chan fabricsResult) {
+	result := <-done
+	if result.err != nil {
+		return
+	}
+	instance, _, err := parseFabricsResponse(result.response)
+	if err != nil {
+		logger.Error(ctx, "Error during abandoned NVMe connect %s at %s: %v", target.TargetNqn, target.Portal, err)
+		return
+	}
+	name := fmt.Sprintf("nvme%d", instance)
+	logger.Info(ctx, "deleting %s, connected to %s at %s after the connect was abandoned", name, target.TargetNqn, target.Portal)
+	err = os.WriteFile(nvme.sysfsPath(sysfsNVMeClass, name, "delete_controller"), []byte("1"), 0o200) // #nosec G306
+	if err != nil {
+		logger.Error(ctx, "Error deleting %s: %v", name, err)
+	}
+}
+
+func writeFabricsDevice(open func(string) (io.ReadWriteCloser, error), device, options string) (string, error) {
+	f, err := open(device)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err = f.Write([]byte(options)); err != nil {
+		return "", fmt.Errorf("failed to write to %s: %w", device, err)
+	}
+	buf := make([]byte, 4096)
+	n, err := f.Read(buf)
+	if err != nil && !(errors.Is(err, io.EOF) && n > 0) {
+		return "", fmt.Errorf("failed to read from %s: %w", device, err)
+	}
+	return string(buf[:n]), nil
+}
+
+// parseFabricsResponse parses the "instance=N,cntlid=M" reply of the fabrics device
+func parseFabricsResponse(response string) (int, int, error) {
+	instance, cntlid := -1, -1
+	for _, item := range strings.Split(strings.TrimSpace(response), ",") {
+		key, value, _ := strings.Cut(item, "=")
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "instance":
+			instance = n
+		case "cntlid":
+			cntlid = n
+		}
+	}
+	if instance < 0 {
+		return -1, -1, fmt.Errorf("unexpected response from fabrics device: %q", response)
+	}
+	return instance, cntlid, nil
+}
+
+// fabricsDisconnect deletes every controller connected to the subsystem of target
+func (nvme *NVMe) fabricsDisconnect(ctx context.Context, target NVMeTarget) error {
+	controllers, err := filepath.Glob(nvme.sysfsPath(sysfsNVMeClass, "nvme*"))
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for _, controller := range controllers {
+		if readSysfsAttribute(filepath.Join(controller, "subsysnqn")) != target.TargetNqn {
+			continue
+		}
+		err = os.WriteFile(filepath.Join(controller, "delete_controller"), []byte("1"), 0o200) // #nosec G306
+		if err != nil {
+			logger.Error(ctx, "Error during NVMe disconnect %s at %s: %v", target.TargetNqn, target.Portal, err)
+			return err
+		}
+		deleted++
+	}
+	logger.Info(ctx, "nvme disconnect successful: %s, disconnected %d controller(s)", target.TargetNqn, deleted)
+	return nil
+}
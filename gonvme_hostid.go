@@ -0,0 +1,299 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+const (
+	// UUIDHostNQNPrefix starts the host NQNs derived from a UUID
+	UUIDHostNQNPrefix = "nqn.2014-08.org.nvmexpress:uuid:"
+
+	// MaxNQNLength is the longest NQN the NVMe specification allows, in bytes
+	MaxNQNLength = 223
+
+	sysfsDMIProductUUID = "/sys/class/dmi/id/product_uuid"
+
+	hostFileMode = 0o644 // nvme-cli reads the host identity as any user
+)
+
+// HostIdentity identifies the host to NVMe targets
+type HostIdentity struct {
+	HostNQN string
+	HostID  string
+	// DuplicateNQNs lists the host NQNs the host NQN file holds more than once
+	DuplicateNQNs []string
+}
+
+// Consistent reports whether the host ID is the UUID of a host NQN derived from one.
+// Other host NQNs are consistent with any host ID.
+func (identity HostIdentity) Consistent() bool {
+	uuid, ok := strings.CutPrefix(identity.HostNQN, UUIDHostNQNPrefix)
+	return !ok || strings.EqualFold(uuid, identity.HostID)
+}
+
+// nqnRegexp matches nqn.<yyyy-mm>.<reverse domain name of the naming authority>[:<unique name>]
+var nqnRegexp = regexp.MustCompile(`^nqn\.[0-9]{4}-(0[1-9]|1[0-2])\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*(:.+)?$`)
+
+// ValidateNQN checks the syntax of an NVMe qualified name: its length and either the naming
+// authority form or the UUID form
+func ValidateNQN(nqn string) error {
+	if len(nqn) > MaxNQNLength {
+		return fmt.Errorf("invalid NQN %q: longer than %d bytes", nqn, MaxNQNLength)
+	}
+	if uuid, ok := strings.CutPrefix(nqn, UUIDHostNQNPrefix); ok {
+		if _, err := parseUUID(uuid); err != nil {
+			return fmt.Errorf("invalid NQN %q: %w", nqn, err)
+		}
+		return nil
+	}
+	if !nqnRegexp.MatchString(nqn) {
+		return fmt.Errorf("invalid NQN %q: expected nqn.yyyy-mm.<reverse domain name>:<name>", nqn)
+	}
+	return nil
+}
+
+// GenerateHostNQN returns a host NQN derived from a random UUID, and that UUID as host ID
+func GenerateHostNQN() (string, string, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return "", "", err
+	}
+	hostID := formatUUID(uuid)
+	return UUIDHostNQNPrefix + hostID, hostID, nil
+}
+
+// GetHostIdentity returns the host NQN and host ID configured on the local system
+func (nvme *NVMe) GetHostIdentity() (HostIdentity, error) {
+	return nvme.GetHostIdentityWithContext(context.Background())
+}
+
+// GetHostIdentityWithContext returns the host NQN and host ID configured on the local system.
+// Either is "" when it is not configured.
+func (nvme *NVMe) GetHostIdentityWithContext(ctx context.Context) (HostIdentity, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetHostIdentity")()
+	if err := ctx.Err(); err != nil {
+		return HostIdentity{}, contextError(ctx, err)
+	}
+	return nvme.readHostIdentity(ctx)
+}
+
+func (nvme *NVMe) readHostIdentity(ctx context.Context) (HostIdentity, error) {
+	var identity HostIdentity
+	nqns, duplicates, err := readHostNQNs(nvme.hostFile(DefaultInitiatorNameFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return HostIdentity{}, err
+	}
+	if len(nqns) > 0 {
+		identity.HostNQN = nqns[0]
+	}
+	if len(duplicates) > 0 {
+		logger.Info(ctx, "%s holds the host NQNs %v more than once", DefaultInitiatorNameFile, duplicates)
+		identity.DuplicateNQNs = duplicates
+	}
+	identity.HostID = readSysfsAttribute(nvme.hostFile(DefaultHostIDFile))
+	return identity, nil
+}
+
+// EnsureHostIdentity returns the host identity, generating and writing the host NQN or host ID
+// when one is missing, or the host ID when it does not match the UUID of the host NQN
+func (nvme *NVMe) EnsureHostIdentity(fromDMI bool) (HostIdentity, error) {
+	return nvme.EnsureHostIdentityWithContext(context.Background(), fromDMI)
+}
+
+// EnsureHostIdentityWithContext returns the host identity, generating and writing the host NQN
+// or host ID when one is missing, or the host ID when it does not match the UUID of the host NQN.
+// A generated host NQN is derived from the DMI product UUID if fromDMI is set and the system has
+// a usable one, like nvme gen-hostnqn does, from a random UUID otherwise. Duplicates in the host
+// NQN file are removed.
+func (nvme *NVMe) EnsureHostIdentityWithContext(ctx context.Context, fromDMI bool) (HostIdentity, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.EnsureHostIdentity")()
+	if err := ctx.Err(); err != nil {
+		return HostIdentity{}, contextError(ctx, err)
+	}
+	identity, err := nvme.readHostIdentity(ctx)
+	if err != nil {
+		return HostIdentity{}, err
+	}
+	current := identity
+
+	if identity.HostNQN == "" {
+		if _, err = parseUUID(identity.HostID); err != nil {
+			identity.HostID = ""
+			if fromDMI {
+				identity.HostID = nvme.dmiProductUUID()
+			}
+		}
+		if identity.HostID == "" {
+			if _, identity.HostID, err = GenerateHostNQN(); err != nil {
+				return HostIdentity{}, err
+			}
+		}
+		identity.HostNQN = UUIDHostNQNPrefix + identity.HostID
+	} else if err = ValidateNQN(identity.HostNQN); err != nil {
+		return HostIdentity{}, err
+	}
+	if uuid, ok := strings.CutPrefix(identity.HostNQN, UUIDHostNQNPrefix); ok {
+		identity.HostID = strings.ToLower(uuid)
+	} else if _, err = parseUUID(identity.HostID); err != nil {
+		if _, identity.HostID, err = GenerateHostNQN(); err != nil {
+			return HostIdentity{}, err
+		}
+	}
+
+	if identity.HostNQN != current.HostNQN || len(current.DuplicateNQNs) > 0 {
+		// the other host NQNs of the file are kept, once each and in order
+		nqns, _, err := readHostNQNs(nvme.hostFile(DefaultInitiatorNameFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return HostIdentity{}, err
+		}
+		content := identity.HostNQN + "\n"
+		for _, nqn := range nqns {
+			if nqn != identity.HostNQN {
+				content += nqn + "\n"
+			}
+		}
+		logger.Info(ctx, "writing host NQN %s", identity.HostNQN)
+		if err = writeFileAtomic(nvme.hostFile(DefaultInitiatorNameFile), []byte(content), hostFileMode); err != nil {
+			return HostIdentity{}, err
+		}
+	}
+	if identity.HostID != current.HostID {
+		logger.Info(ctx, "writing host ID %s", identity.HostID)
+		if err = writeFileAtomic(nvme.hostFile(DefaultHostIDFile), []byte(identity.HostID+"\n"), hostFileMode); err != nil {
+			return HostIdentity{}, err
+		}
+	}
+	identity.DuplicateNQNs = current.DuplicateNQNs
+	return identity, nil
+}
+
+// SetHostIdentity writes the host NQN and host ID of the local system
+func (nvme *NVMe) SetHostIdentity(identity HostIdentity) error {
+	return nvme.SetHostIdentityWithContext(context.Background(), identity)
+}
+
+// SetHostIdentityWithContext writes the host NQN and host ID of the local system, after checking
+// that they are valid and consistent with each other
+func (nvme *NVMe) SetHostIdentityWithContext(ctx context.Context, identity HostIdentity) error {
+	defer tracer.TraceFuncCall(ctx, "gonvme.SetHostIdentity")()
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+	if err := validateHostIdentity(identity); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(nvme.hostFile(DefaultInitiatorNameFile), []byte(identity.HostNQN+"\n"), hostFileMode); err != nil {
+		return err
+	}
+	return writeFileAtomic(nvme.hostFile(DefaultHostIDFile), []byte(identity.HostID+"\n"), hostFileMode)
+}
+
+func validateHostIdentity(identity HostIdentity) error {
+	if err := ValidateNQN(identity.HostNQN); err != nil {
+		return err
+	}
+	if _, err := parseUUID(identity.HostID); err != nil {
+		return fmt.Errorf("invalid host ID: %w", err)
+	}
+	if !identity.Consistent() {
+		return fmt.Errorf("host ID %s does not match host NQN %s", identity.HostID, identity.HostNQN)
+	}
+	return nil
+}
+
+// hostFile returns the path of a host configuration file below the ChrootDirectory
+func (nvme *NVMe) hostFile(name string) string {
+	return filepath.Join(nvme.getChrootDirectory(), name)
+}
+
+// dmiProductUUID returns the product UUID of the system, or "" if it cannot be read or is one
+// of the placeholders firmware reports when it has none
+func (nvme *NVMe) dmiProductUUID() string {
+	uuid := strings.ToLower(readSysfsAttribute(nvme.sysfsPath(sysfsDMIProductUUID)))
+	if _, err := parseUUID(uuid); err != nil {
+		return ""
+	}
+	switch uuid {
+	case "00000000-0000-0000-0000-000000000000",
+		"ffffffff-ffff-ffff-ffff-ffffffffffff",
+		"03000200-0400-0500-0006-000700080009":
+		return ""
+	}
+	return uuid
+}
+
+// readHostNQNs returns the host NQNs of a host NQN file in order, once each, and those it holds more than once
+func readHostNQNs(path string) ([]string, []string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, nil, err
+	}
+	var nqns, duplicates []string
+	seen := make(map[string]int)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		seen[line]++
+		switch seen[line] {
+		case 1:
+			nqns = append(nqns, line)
+		case 2:
+			duplicates = append(duplicates, line)
+		}
+	}
+	return nqns, duplicates, nil
+}
+
+// writeFileAtomic replaces the content of path with a file of mode perm, creating its directory
+// if needed, so that readers see either the old or the new content
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(content); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,457 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+// NamespaceInfo is the Identify Namespace data of a namespace
+type NamespaceInfo struct {
+	NamespaceID uint32
+	// SizeBlocks, CapacityBlocks and UtilizationBlocks are the size, capacity and utilization
+	// of the namespace in logical blocks, the Bytes fields the same in bytes
+	SizeBlocks        uint64
+	CapacityBlocks    uint64
+	UtilizationBlocks uint64
+	SizeBytes         uint64
+	CapacityBytes     uint64
+	UtilizationBytes  uint64
+	// LBAFormat is the index of the active LBA format, BlockSize its logical block size in bytes
+	LBAFormat int
+	BlockSize uint32
+	// MetadataSize is the metadata of a logical block in bytes, MetadataExtended is set when
+	// it is transferred at the end of the data instead of in a separate buffer
+	MetadataSize     uint16
+	MetadataExtended bool
+	// ProtectionType is the end-to-end data protection type, 0 if protection is disabled, and
+	// ProtectionFirst is set when the protection information comes first in the metadata
+	ProtectionType  int
+	ProtectionFirst bool
+	// Shared is set when the namespace may be attached to more than one controller
+	Shared     bool
+	ANAGroupID uint32
+	// AtomicWriteUnit and AtomicWriteUnitPowerFail are the sizes of the writes the namespace
+	// performs atomically in logical blocks, 0 when those of the controller apply
+	AtomicWriteUnit          uint32
+	AtomicWriteUnitPowerFail uint32
+	NGUID                    string
+	EUI64                    string
+	// UUID is the UUID of the namespace identification descriptors, "" if there is none
+	UUID string
+}
+
+// idNamespace is the output of nvme id-ns -o json, and the fields of its text output
+type idNamespace struct {
+	Nsze     uint64      `json:"nsze"`
+	Ncap     uint64      `json:"ncap"`
+	Nuse     uint64      `json:"nuse"`
+	Nsfeat   uint64      `json:"nsfeat"`
+	Flbas    uint64      `json:"flbas"`
+	Dps      uint64      `json:"dps"`
+	Nmic     uint64      `json:"nmic"`
+	Nawun    uint64      `json:"nawun"`
+	Nawupf   uint64      `json:"nawupf"`
+	Anagrpid uint64      `json:"anagrpid"`
+	NGUID    string      `json:"nguid"`
+	EUI64    string      `json:"eui64"`
+	LBAFs    []lbaFormat `json:"lbafs"`
+}
+
+// lbaFormat is an LBA format of the Identify Namespace data, with the metadata size in bytes
+// and the logical block size as a power of two
+type lbaFormat struct {
+	MS uint64 `json:"ms"`
+	DS uint64 `json:"ds"`
+}
+
+// namespaceDescriptors is the output of nvme ns-descs -o json, and the fields of its text output
+type namespaceDescriptors struct {
+	UUID string `json:"uuid"`
+}
+
+// GetNamespaceInfo returns the Identify Namespace data of an NVMe namespace device
+func (nvme *NVMe) GetNamespaceInfo(path string) (NamespaceInfo, error) {
+	return nvme.GetNamespaceInfoWithContext(context.Background(), path)
+}
+
+// GetNamespaceInfoWithContext returns the Identify Namespace data of an NVMe namespace device,
+// from nvme id-ns and the UUID of nvme ns-descs, giving up when ctx is done
+func (nvme *NVMe) GetNamespaceInfoWithContext(ctx context.Context, path string) (NamespaceInfo, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetNamespaceInfo")()
+	return nvme.getNamespaceInfo(ctx, path)
+}
+
+func (nvme *NVMe) getNamespaceInfo(ctx context.Context, path string) (NamespaceInfo, error) {
+	out, err := nvme.runNVMeIdentify(ctx, "id-ns", path)
+	if err != nil {
+		logger.Error(ctx, "Error identifying namespace %s: %v", path, err)
+		return NamespaceInfo{}, err
+	}
+	var id idNamespace
+	var nsid uint32
+	if isJSONOutput(out) {
+		if err = json.Unmarshal(out, &id); err != nil {
+			err = fmt.Errorf("failed to parse identify namespace data of %s: %w", path, err)
+			logger.Error(ctx, "Error identifying namespace %s: %v", path, err)
+			return NamespaceInfo{}, err
+		}
+		// the JSON output does not name the namespace
+		nsid = nvme.namespaceID(ctx, path)
+	} else {
+		id, nsid = parseIDNamespaceText(out)
+	}
+	info := id.info()
+	info.NamespaceID = nsid
+
+	out, err = nvme.runNVMeIdentify(ctx, "ns-descs", path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return NamespaceInfo{}, err
+		}
+		// controllers before NVMe 1.3 have no namespace identification descriptors
+		logger.Debug(ctx, "Error reading the namespace identification descriptors of %s: %v", path, err)
+		return info, nil
+	}
+	var descriptors namespaceDescriptors
+	if isJSONOutput(out) {
+		_ = json.Unmarshal(out, &descriptors)
+	} else {
+		descriptors.UUID = identifyTextFields(out)["uuid"]
+	}
+	info.UUID = descriptors.UUID
+	return info, nil
+}
+
+// namespaceIDString returns a namespace ID in decimal, "" if it is not known
+func namespaceIDString(nsid uint32) string {
+	if nsid == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(nsid), 10)
+}
+
+// runNVMeIdentify runs nvme <command> <device> -o json, or without -o json if nvme-cli rejects
+// it, and returns the output
+func (nvme *NVMe) runNVMeIdentify(ctx context.Context, command, device string) ([]byte, error) {
+	exe := []string{NVMeCommand, command, device}
+	result, err := nvme.runNVMeCommand(ctx, append(exe, "-o", "json"))
+	if err != nil && ctx.Err() == nil && isUnsupportedOutputFormat(result) {
+		logger.Debug(ctx, "nvme %s does not support JSON output, retrying without it", command)
+		result, err = nvme.runNVMeCommand(ctx, exe)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.Stdout, nil
+}
+
+// isJSONOutput reports whether out is a JSON object rather than text
+func isJSONOutput(out []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(out), []byte("{"))
+}
+
+// namespaceID returns the ID of the namespace of device from sysfs, or nvme get-ns-id if sysfs
+// does not have it, 0 if neither does
+func (nvme *NVMe) namespaceID(ctx context.Context, device string) uint32 {
+	if nsid := parseSysfsUint32(readSysfsAttribute(nvme.sysfsPath(sysfsBlockClass, filepath.Base(device), "nsid"))); nsid != 0 {
+		return nsid
+	}
+	// nvme get-ns-id /dev/nvme0n1
+	// /dev/nvme0n1: namespace-id:149
+	result, err := nvme.runNVMeCommand(ctx, []string{NVMeCommand, "get-ns-id", device})
+	if err != nil {
+		logger.Debug(ctx, "Error reading the namespace ID of %s: %v", device, err)
+		return 0
+	}
+	_, value, _ := strings.Cut(lastLine(result.Stdout), "namespace-id:")
+	return parseSysfsUint32(strings.TrimSpace(value))
+}
+
+// info returns the namespace information of the Identify Namespace data
+func (id idNamespace) info() NamespaceInfo {
+	// the format index is in bits 3:0 of flbas, extended by bits 6:5 with more than 16 formats
+	format := int(id.Flbas&0xf | (id.Flbas>>5&0x3)<<4)
+	info := NamespaceInfo{
+		SizeBlocks:        id.Nsze,
+		CapacityBlocks:    id.Ncap,
+		UtilizationBlocks: id.Nuse,
+		LBAFormat:         format,
+		MetadataExtended:  id.Flbas&0x10 != 0,
+		ProtectionType:    int(id.Dps & 0x7),
+		ProtectionFirst:   id.Dps&0x8 != 0,
+		Shared:            id.Nmic&0x1 != 0,
+		ANAGroupID:        uint32(id.Anagrpid), // #nosec G115
+		NGUID:             id.NGUID,
+		EUI64:             id.EUI64,
+	}
+	if format < len(id.LBAFs) && id.LBAFs[format].DS < 32 {
+		info.BlockSize = 1 << id.LBAFs[format].DS
+		info.MetadataSize = uint16(id.LBAFs[format].MS) // #nosec G115
+	}
+	info.SizeBytes = info.SizeBlocks * uint64(info.BlockSize)
+	info.CapacityBytes = info.CapacityBlocks * uint64(info.BlockSize)
+	info.UtilizationBytes = info.UtilizationBlocks * uint64(info.BlockSize)
+	// the atomic write units are 0's based and apply when bit 1 of nsfeat is set
+	if id.Nsfeat&0x2 != 0 {
+		info.AtomicWriteUnit = uint32(id.Nawun) + 1           // #nosec G115
+		info.AtomicWriteUnitPowerFail = uint32(id.Nawupf) + 1 // #nosec G115
+	}
+	return info
+}
+
+// identifyTextFields returns the "name : value" fields of the text output of an nvme identify command
+func identifyTextFields(out []byte) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		fields[strings.Join(strings.Fields(key), " ")] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
+// parseIdentifyUint parses a decimal or 0x prefixed hexadecimal field, 0 if it is malformed
+func parseIdentifyUint(s string) uint64 {
+	v, _ := strconv.ParseUint(strings.TrimSpace(s), 0, 64)
+	return v
+}
+
+// parseIDNamespaceText parses the text output of nvme id-ns and returns the data and the
+// namespace ID of its header. The output looks like:
+//
+//	NVME Identify Namespace 149:
+//	nsze    : 0x1000000
+//	ncap    : 0x1000000
+//	nuse    : 0x223b8
+//	nsfeat  : 0xb
+//	nlbaf   : 0
+//	flbas   : 0
+//	...
+//	anagrpid: 2
+//	nguid   : 507911ecda65a2498ccf0968009a5d07
+//	eui64   : 0000000000000000
+//	lbaf  0 : ms:0   lbads:9  rp:0 (in use)
+func parseIDNamespaceText(out []byte) (idNamespace, uint32) {
+	var nsid uint32
+	if header, _, found := strings.Cut(string(out), ":"); found && strings.Contains(header, "Identify Namespace") {
+		fields := strings.Fields(header)
+		nsid = uint32(parseIdentifyUint(fields[len(fields)-1])) // #nosec G115
+	}
+	fields := identifyTextFields(out)
+	id := idNamespace{
+		Nsze:     parseIdentifyUint(fields["nsze"]),
+		Ncap:     parseIdentifyUint(fields["ncap"]),
+		Nuse:     parseIdentifyUint(fields["nuse"]),
+		Nsfeat:   parseIdentifyUint(fields["nsfeat"]),
+		Flbas:    parseIdentifyUint(fields["flbas"]),
+		Dps:      parseIdentifyUint(fields["dps"]),
+		Nmic:     parseIdentifyUint(fields["nmic"]),
+		Nawun:    parseIdentifyUint(fields["nawun"]),
+		Nawupf:   parseIdentifyUint(fields["nawupf"]),
+		Anagrpid: parseIdentifyUint(fields["anagrpid"]),
+		NGUID:    fields["nguid"],
+		EUI64:    fields["eui64"],
+	}
+	// lbaf  0 : ms:0   lbads:9  rp:0 (in use)
+	for i := 0; ; i++ {
+		format, ok := fields[fmt.Sprintf("lbaf %d", i)]
+		if !ok {
+			break
+		}
+		id.LBAFs = append(id.LBAFs, lbaFormat{})
+		for _, field := range strings.Fields(format) {
+			name, value, _ := strings.Cut(field, ":")
+			switch name {
+			case "ms":
+				id.LBAFs[i].MS = parseIdentifyUint(value)
+			case "lbads":
+				id.LBAFs[i].DS = parseIdentifyUint(value)
+			}
+		}
+	}
+	return id, nsid
+}
+
+// minMemoryPageSize is the minimum memory page size MDTS is in units of, 4 KiB for nearly
+// all controllers
+const minMemoryPageSize = 4096
+
+// ControllerInfo is the Identify Controller data of a controller
+type ControllerInfo struct {
+	Model    string
+	Serial   string
+	Firmware string
+	CntlID   uint16
+	// VendorID and SubsystemVendorID are the PCI vendor IDs of the controller and the subsystem
+	VendorID          uint16
+	SubsystemVendorID uint16
+	SubsystemNQN      string
+	// MDTS is the maximum data transfer size as a power of two in units of the minimum memory
+	// page size, MaxDataTransferBytes the same in bytes for a 4 KiB page; both are 0 if there
+	// is no limit
+	MDTS                 uint8
+	MaxDataTransferBytes uint64
+	// ANASupported is set when the controller reports asymmetric namespace access,
+	// ANAGroupMax is the largest ANA group ID it supports
+	ANASupported bool
+	ANAGroupMax  uint32
+	// KeepAliveSupported is set when the controller supports keep alive, KeepAliveGranularity
+	// is the granularity of its keep alive timer
+	KeepAliveSupported   bool
+	KeepAliveGranularity time.Duration
+	// SGLSupported is set when the controller supports scatter gather lists for I/O
+	SGLSupported bool
+	LogPages     ControllerLogPages
+}
+
+// ControllerLogPages lists the optional log pages a controller supports
+type ControllerLogPages struct {
+	// SMARTPerNamespace is set when the SMART / health log is kept per namespace
+	SMARTPerNamespace bool
+	CommandEffects    bool
+	Telemetry         bool
+	PersistentEvent   bool
+	// ANA is set for the asymmetric namespace access log of controllers which report ANA
+	ANA bool
+}
+
+// idController is the output of nvme id-ctrl -o json, and the fields of its text output
+type idController struct {
+	Vid       uint64 `json:"vid"`
+	Ssvid     uint64 `json:"ssvid"`
+	Sn        string `json:"sn"`
+	Mn        string `json:"mn"`
+	Fr        string `json:"fr"`
+	Cmic      uint64 `json:"cmic"`
+	Mdts      uint64 `json:"mdts"`
+	Cntlid    uint64 `json:"cntlid"`
+	Lpa       uint64 `json:"lpa"`
+	Kas       uint64 `json:"kas"`
+	Anagrpmax uint64 `json:"anagrpmax"`
+	Sgls      uint64 `json:"sgls"`
+	Subnqn    string `json:"subnqn"`
+}
+
+// GetControllerInfo returns the Identify Controller data of an NVMe controller, named like
+// nvme0 or by its device /dev/nvme0
+func (nvme *NVMe) GetControllerInfo(ctrl string) (ControllerInfo, error) {
+	return nvme.GetControllerInfoWithContext(context.Background(), ctrl)
+}
+
+// GetControllerInfoWithContext returns the Identify Controller data of an NVMe controller,
+// named like nvme0 or by its device /dev/nvme0, from nvme id-ctrl, giving up when ctx is done
+func (nvme *NVMe) GetControllerInfoWithContext(ctx context.Context, ctrl string) (ControllerInfo, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetControllerInfo")()
+	return nvme.getControllerInfo(ctx, ctrl)
+}
+
+func (nvme *NVMe) getControllerInfo(ctx context.Context, ctrl string) (ControllerInfo, error) {
+	device := ctrl
+	if !strings.HasPrefix(device, "/") {
+		device = "/dev/" + device
+	}
+	out, err := nvme.runNVMeIdentify(ctx, "id-ctrl", device)
+	if err != nil {
+		logger.Error(ctx, "Error identifying controller %s: %v", ctrl, err)
+		return ControllerInfo{}, err
+	}
+	info, err := parseIDController(out)
+	if err != nil {
+		logger.Error(ctx, "Error identifying controller %s: %v", ctrl, err)
+		return ControllerInfo{}, err
+	}
+	return info, nil
+}
+
+// parseIDController parses the output of nvme id-ctrl, either JSON or text
+func parseIDController(out []byte) (ControllerInfo, error) {
+	var id idController
+	if isJSONOutput(out) {
+		if err := json.Unmarshal(out, &id); err != nil {
+			return ControllerInfo{}, fmt.Errorf("failed to parse identify controller data: %w", err)
+		}
+		return id.info(), nil
+	}
+	fields := identifyTextFields(out)
+	id = idController{
+		Vid:       parseIdentifyUint(fields["vid"]),
+		Ssvid:     parseIdentifyUint(fields["ssvid"]),
+		Sn:        fields["sn"],
+		Mn:        fields["mn"],
+		Fr:        fields["fr"],
+		Cmic:      parseIdentifyUint(fields["cmic"]),
+		Mdts:      parseIdentifyUint(fields["mdts"]),
+		Cntlid:    parseIdentifyUint(fields["cntlid"]),
+		Lpa:       parseIdentifyUint(fields["lpa"]),
+		Kas:       parseIdentifyUint(fields["kas"]),
+		Anagrpmax: parseIdentifyUint(fields["anagrpmax"]),
+		Sgls:      parseIdentifyUint(fields["sgls"]),
+		Subnqn:    fields["subnqn"],
+	}
+	if id.Subnqn == "" && id.Sn == "" {
+		return ControllerInfo{}, fmt.Errorf("failed to parse identify controller data: %q", lastLine(out))
+	}
+	return id.info(), nil
+}
+
+// info returns the controller information of the Identify Controller data
+func (id idController) info() ControllerInfo {
+	info := ControllerInfo{
+		Model:             strings.TrimSpace(id.Mn),
+		Serial:            strings.TrimSpace(id.Sn),
+		Firmware:          strings.TrimSpace(id.Fr),
+		CntlID:            uint16(id.Cntlid), // #nosec G115
+		VendorID:          uint16(id.Vid),    // #nosec G115
+		SubsystemVendorID: uint16(id.Ssvid),  // #nosec G115
+		SubsystemNQN:      strings.TrimSpace(id.Subnqn),
+		MDTS:              uint8(id.Mdts), // #nosec G115
+		// bit 3 of cmic reports ANA
+		ANASupported: id.Cmic&0x8 != 0,
+		// kas is in units of 100 ms, 0 without keep alive support
+		KeepAliveSupported:   id.Kas != 0,
+		KeepAliveGranularity: time.Duration(id.Kas) * 100 * time.Millisecond,
+		// bits 1:0 of sgls are 0 without SGL support
+		SGLSupported: id.Sgls&0x3 != 0,
+		LogPages: ControllerLogPages{
+			SMARTPerNamespace: id.Lpa&0x1 != 0,
+			CommandEffects:    id.Lpa&0x2 != 0,
+			Telemetry:         id.Lpa&0x8 != 0,
+			PersistentEvent:   id.Lpa&0x10 != 0,
+			ANA:               id.Cmic&0x8 != 0,
+		},
+	}
+	if info.ANASupported {
+		info.ANAGroupMax = uint32(id.Anagrpmax) // #nosec G115
+	}
+	if id.Mdts != 0 && id.Mdts < 52 {
+		info.MaxDataTransferBytes = minMemoryPageSize << id.Mdts
+	}
+	return info
+}
@@ -17,9 +17,14 @@
 package gonvme
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -29,23 +34,69 @@ const (
 	MockNumberOfTCPTargets = "numberOfTCPTargets"
 	// MockNumberOfFCTargets controls the number of NVMeFC targets found in mock mode
 	MockNumberOfFCTargets = "numberOfFCTargets"
+	// MockNumberOfRDMATargets controls the number of NVMeRDMA targets found in mock mode
+	MockNumberOfRDMATargets = "numberOfRDMATargets"
 	// MockNumberOfSessions controls the number of  NVMe sessions found in mock mode
 	MockNumberOfSessions = "numberOfSession"
 	// MockNumberOfNamespaceDevices controls the number of  NVMe Namespace Devices found in mock mode
 	MockNumberOfNamespaceDevices = "numberOfNamespaceDevices"
+	// MockNVMeCLIVersion controls the nvme-cli version reported in mock mode, 2.8 by default
+	MockNVMeCLIVersion = "nvmeCLIVersion"
+	// MockIdentifyControllerFile names a file with the nvme id-ctrl output, JSON or text, of the
+	// controllers in mock mode, a PowerStore controller by default
+	MockIdentifyControllerFile = "identifyControllerFile"
 )
 
+// mockIdentifyController is the nvme id-ctrl output of the mock controllers by default,
+// trimmed to the fields GetControllerInfo reports
+const mockIdentifyController = `{
+  "vid":4571,
+  "ssvid":4571,
+  "sn":"FP08RZ2             ",
+  "mn":"dellemc-powerstore                      ",
+  "fr":"3.0.0.0 ",
+  "cmic":15,
+  "mdts":5,
+  "cntlid":1,
+  "lpa":14,
+  "kas":100,
+  "anagrpmax":64,
+  "sgls":1048577,
+  "subnqn":"nqn.1988-11.com.dell:powerstore:00:e6e2d5b871f1403E169D"
+}`
+
 // GONVMEMock is a struct controlling induced errors
 var GONVMEMock struct {
 	InduceDiscoveryError               bool
 	InduceInitiatorError               bool
 	InduceTCPLoginError                bool
 	InduceFCLoginError                 bool
+	InduceRDMALoginError               bool
 	InduceLogoutError                  bool
 	InduceGetSessionsError             bool
 	InducedNVMeDeviceAndNamespaceError bool
 	InducedNVMeNamespaceIDError        bool
 	InducedNVMeDeviceDataError         bool
+	InduceIdentifyControllerError      bool
+	InduceVersionError                 bool
+	// InduceConfigError makes reading and writing the NVMe configuration files fail
+	InduceConfigError bool
+	// InduceAuthError makes the controllers reject the DH-HMAC-CHAP keys of the host
+	InduceAuthError bool
+	// InducedCommandDelay makes every mock operation take this long, or until its context is done
+	InducedCommandDelay time.Duration
+}
+
+// inducedError returns the error of an induced failure of op, classified as kind like the
+// failures of nvme-cli are
+func inducedError(op string, kind error) error {
+	return &CommandError{
+		Command:  []string{NVMeCommand},
+		ExitCode: 1,
+		Stderr:   op + " induced error",
+		Kind:     kind,
+		err:      errors.New("exit status 1"),
+	}
 }
 
 // MockNVMe provides a mock implementation of an NVMe client
@@ -65,14 +116,50 @@ func NewMockNVMe(opts map[string]string) *MockNVMe {
 	return &nvme
 }
 
+// authenticate models the DH-HMAC-CHAP authentication of the host by the controller of target
+func (nvme *MockNVMe) authenticate(target NVMeTarget) error {
+	hostSecret, ctrlSecret := target.DHCHAPSecret, target.DHCHAPCtrlSecret
+	if hostSecret == "" && ctrlSecret == "" {
+		hostSecret, ctrlSecret = nvme.options[DHCHAPHostSecret], nvme.options[DHCHAPControllerSecret]
+	}
+	if err := validateDHCHAPSecrets(hostSecret, ctrlSecret); err != nil {
+		return err
+	}
+	if GONVMEMock.InduceAuthError {
+		return inducedError("authentication", ErrAuthFailed)
+	}
+	return nil
+}
+
 func getOptionAsInt(opts map[string]string, key string) int64 {
 	v, _ := strconv.ParseInt(opts[key], 10, 64)
 	return v
 }
 
-func (nvme *MockNVMe) discoverNVMeTCPTargets(address string, _ bool) ([]NVMeTarget, error) {
+// mockWait simulates the run time of an nvme-cli invocation and honors cancellation of ctx
+func mockWait(ctx context.Context) error {
+	if GONVMEMock.InducedCommandDelay == 0 {
+		return contextError(ctx, ctx.Err())
+	}
+	timer := time.NewTimer(GONVMEMock.InducedCommandDelay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return contextError(ctx, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (nvme *MockNVMe) discoverNVMeTCPTargets(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	if err := mockWait(ctx); err != nil {
+		return []NVMeTarget{}, err
+	}
+	if err := nvme.authenticate(NVMeTarget{}); err != nil {
+		return []NVMeTarget{}, err
+	}
 	if GONVMEMock.InduceDiscoveryError {
-		return []NVMeTarget{}, errors.New("discoverTargets induced error")
+		return []NVMeTarget{}, inducedError("discover", ErrTargetUnreachable)
 	}
 	mockedTargets := make([]NVMeTarget, 0)
 	count := getOptionAsInt(nvme.options, MockNumberOfTCPTargets)
@@ -98,13 +185,25 @@ func (nvme *MockNVMe) discoverNVMeTCPTargets(address string, _ bool) ([]NVMeTarg
 			})
 	}
 
+	// log into the targets if asked
+	if login {
+		_, err := connectAll(ctx, mockedTargets, ConnectAllOptions{}, nvme.connectTarget)
+		return mockedTargets, err
+	}
+
 	// send back a slice of targets
 	return mockedTargets, nil
 }
 
-func (nvme *MockNVMe) discoverNVMeFCTargets(address string, _ bool) ([]NVMeTarget, error) {
+func (nvme *MockNVMe) discoverNVMeFCTargets(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	if err := mockWait(ctx); err != nil {
+		return []NVMeTarget{}, err
+	}
+	if err := nvme.authenticate(NVMeTarget{}); err != nil {
+		return []NVMeTarget{}, err
+	}
 	if GONVMEMock.InduceDiscoveryError {
-		return []NVMeTarget{}, errors.New("discoverTargets induced error")
+		return []NVMeTarget{}, inducedError("discover", ErrTargetUnreachable)
 	}
 	mockedTargets := make([]NVMeTarget, 0)
 	count := getOptionAsInt(nvme.options, MockNumberOfFCTargets)
@@ -131,13 +230,66 @@ func (nvme *MockNVMe) discoverNVMeFCTargets(address string, _ bool) ([]NVMeTarge
 			})
 	}
 
+	// log into the targets if asked
+	if login {
+		_, err := connectAll(ctx, mockedTargets, ConnectAllOptions{}, nvme.connectTarget)
+		return mockedTargets, err
+	}
+
 	// send back a slice of targets
 	return mockedTargets, nil
 }
 
-func (nvme *MockNVMe) getInitiators(_ string) ([]string, error) {
+func (nvme *MockNVMe) discoverNVMeRDMATargets(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	if err := mockWait(ctx); err != nil {
+		return []NVMeTarget{}, err
+	}
+	if err := nvme.authenticate(NVMeTarget{}); err != nil {
+		return []NVMeTarget{}, err
+	}
+	if GONVMEMock.InduceDiscoveryError {
+		return []NVMeTarget{}, inducedError("discover", ErrTargetUnreachable)
+	}
+	mockedTargets := make([]NVMeTarget, 0)
+	count := getOptionAsInt(nvme.options, MockNumberOfRDMATargets)
+
+	if count == 0 {
+		count = 1
+	}
+
+	for idx := 0; idx < int(count); idx++ {
+		tgt := fmt.Sprintf("%05d", idx)
+		mockedTargets = append(mockedTargets,
+			NVMeTarget{
+				Portal:     address,
+				TargetNqn:  "nqn.1988-11.com.dell.mock:e6e2d5b871f1403E169D" + tgt,
+				TrType:     "rdma",
+				AdrFam:     "ipv4",
+				SubType:    "nvme subsystem",
+				Treq:       "not specified",
+				PortID:     "0",
+				TrsvcID:    "4420",
+				TargetType: "rdma",
+				HostAdr:    "192.168.1.100",
+			})
+	}
+
+	// log into the targets if asked
+	if login {
+		_, err := connectAll(ctx, mockedTargets, ConnectAllOptions{}, nvme.connectTarget)
+		return mockedTargets, err
+	}
+
+	// send back a slice of targets
+	return mockedTargets, nil
+}
+
+func (nvme *MockNVMe) getInitiators(ctx context.Context, _ string) ([]string, error) {
+	if err := mockWait(ctx); err != nil {
+		return []string{}, err
+	}
 	if GONVMEMock.InduceInitiatorError {
-		return []string{}, errors.New("getInitiators induced error")
+		return []string{}, inducedError("getInitiators", ErrNoObjectsFound)
 	}
 
 	mockedInitiators := make([]string, 0)
@@ -154,46 +306,160 @@ func (nvme *MockNVMe) getInitiators(_ string) ([]string, error) {
 	return mockedInitiators, nil
 }
 
-func (nvme *MockNVMe) nvmeTCPConnect(_ NVMeTarget, _ bool) error {
+func (nvme *MockNVMe) nvmeTCPConnect(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	_, err := nvme.nvmeTCPConnectWithOptions(ctx, target, ConnectOptions{DuplicateConnect: duplicateConnect})
+	return err
+}
+
+func (nvme *MockNVMe) nvmeTCPConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	if err := mockWait(ctx); err != nil {
+		return ConnectResult{}, err
+	}
+	options, err := resolveConnectOptions(nvme.options, NVMeTransportTypeTCP, options)
+	if err != nil {
+		return ConnectResult{}, err
+	}
+	if options.HostTraddr == "" {
+		options.HostTraddr = target.HostAdr
+	}
+	if err := nvme.authenticate(target); err != nil {
+		return ConnectResult{}, err
+	}
+	if target.TLSKey != "" {
+		if _, err := ParseTLSKey(target.TLSKey); err != nil {
+			return ConnectResult{}, err
+		}
+	}
 	if GONVMEMock.InduceTCPLoginError {
-		return errors.New("NVMeTCP Login induced error")
+		return ConnectResult{}, inducedError("NVMeTCP Login", ErrTargetUnreachable)
 	}
 
-	return nil
+	return ConnectResult{Options: options}, nil
+}
+
+func (nvme *MockNVMe) nvmeFCConnect(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	_, err := nvme.nvmeFCConnectWithOptions(ctx, target, ConnectOptions{DuplicateConnect: duplicateConnect})
+	return err
 }
 
-func (nvme *MockNVMe) nvmeFCConnect(_ NVMeTarget, _ bool) error {
+func (nvme *MockNVMe) nvmeFCConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	if err := mockWait(ctx); err != nil {
+		return ConnectResult{}, err
+	}
+	options, err := resolveConnectOptions(nvme.options, NVMeTransportTypeFC, options)
+	if err != nil {
+		return ConnectResult{}, err
+	}
+	if options.HostTraddr == "" {
+		options.HostTraddr = target.HostAdr
+	}
+	if err := nvme.authenticate(target); err != nil {
+		return ConnectResult{}, err
+	}
 	if GONVMEMock.InduceFCLoginError {
-		return errors.New("NVMeFC Login induced error")
+		return ConnectResult{}, inducedError("NVMeFC Login", ErrTargetUnreachable)
 	}
 
-	return nil
+	return ConnectResult{Options: options}, nil
+}
+
+func (nvme *MockNVMe) nvmeRDMAConnect(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	_, err := nvme.nvmeRDMAConnectWithOptions(ctx, target, ConnectOptions{DuplicateConnect: duplicateConnect})
+	return err
+}
+
+func (nvme *MockNVMe) nvmeRDMAConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	if err := mockWait(ctx); err != nil {
+		return ConnectResult{}, err
+	}
+	options, err := resolveConnectOptions(nvme.options, NVMeTransportTypeRDMA, options)
+	if err != nil {
+		return ConnectResult{}, err
+	}
+	if options.HostTraddr == "" {
+		options.HostTraddr = target.HostAdr
+	}
+	if err := nvme.authenticate(target); err != nil {
+		return ConnectResult{}, err
+	}
+	if GONVMEMock.InduceRDMALoginError {
+		return ConnectResult{}, inducedError("NVMeRDMA Login", ErrTargetUnreachable)
+	}
+
+	return ConnectResult{Options: options}, nil
 }
 
-func (nvme *MockNVMe) nvmeDisconnect(_ NVMeTarget) error {
+func (nvme *MockNVMe) nvmeDisconnect(ctx context.Context, _ NVMeTarget) error {
+	if err := mockWait(ctx); err != nil {
+		return err
+	}
 	if GONVMEMock.InduceLogoutError {
-		return errors.New("NVMe Logout induced error")
+		return inducedError("NVMe Logout", ErrNoObjectsFound)
 	}
 
 	return nil
 }
 
 // GetNVMeDeviceData returns the information (nguid and namespace) of an NVME device path
-func (nvme *MockNVMe) GetNVMeDeviceData(_ string) (string, string, error) {
-	if GONVMEMock.InducedNVMeDeviceDataError {
-		return "", "", errors.New("NVMe Namespace Data Induced Error")
+func (nvme *MockNVMe) GetNVMeDeviceData(path string) (string, string, error) {
+	return nvme.GetNVMeDeviceDataWithContext(context.Background(), path)
+}
+
+// GetNVMeDeviceDataWithContext returns the information (nguid and namespace) of an NVME device path
+func (nvme *MockNVMe) GetNVMeDeviceDataWithContext(ctx context.Context, path string) (string, string, error) {
+	info, err := nvme.GetNamespaceInfoWithContext(ctx, path)
+	if err != nil {
+		return "", "", err
 	}
+	return info.NGUID, namespaceIDString(info.NamespaceID), nil
+}
 
-	nguid := "1a111a1111aa11111aaa1111111111a1"
-	namespace := "11"
+// GetNamespaceInfo returns the Identify Namespace data of a mock namespace
+func (nvme *MockNVMe) GetNamespaceInfo(path string) (NamespaceInfo, error) {
+	return nvme.GetNamespaceInfoWithContext(context.Background(), path)
+}
 
-	return nguid, namespace, nil
+// GetNamespaceInfoWithContext returns the Identify Namespace data of a mock namespace, a
+// shared 8 GiB namespace of 512 byte blocks
+func (nvme *MockNVMe) GetNamespaceInfoWithContext(ctx context.Context, _ string) (NamespaceInfo, error) {
+	if err := mockWait(ctx); err != nil {
+		return NamespaceInfo{}, err
+	}
+	if GONVMEMock.InducedNVMeDeviceDataError {
+		return NamespaceInfo{}, inducedError("NVMe Namespace Data", ErrNoObjectsFound)
+	}
+
+	return NamespaceInfo{
+		NamespaceID:              11,
+		SizeBlocks:               16777216,
+		CapacityBlocks:           16777216,
+		UtilizationBlocks:        140216,
+		SizeBytes:                16777216 * 512,
+		CapacityBytes:            16777216 * 512,
+		UtilizationBytes:         140216 * 512,
+		BlockSize:                512,
+		Shared:                   true,
+		ANAGroupID:               2,
+		AtomicWriteUnit:          2048,
+		AtomicWriteUnitPowerFail: 2048,
+		NGUID:                    "1a111a1111aa11111aaa1111111111a1",
+		EUI64:                    "0000000000000000",
+		UUID:                     "1a111a11-11aa-1111-1aaa-1111111111a1",
+	}, nil
 }
 
 // ListNVMeNamespaceID returns the namespace IDs for each NVME device path
-func (nvme *MockNVMe) ListNVMeNamespaceID(_ []DevicePathAndNamespace) (map[DevicePathAndNamespace][]string, error) {
+func (nvme *MockNVMe) ListNVMeNamespaceID(devices []DevicePathAndNamespace) (map[DevicePathAndNamespace][]string, error) {
+	return nvme.ListNVMeNamespaceIDWithContext(context.Background(), devices)
+}
+
+// ListNVMeNamespaceIDWithContext returns the namespace IDs for each NVME device path
+func (nvme *MockNVMe) ListNVMeNamespaceIDWithContext(ctx context.Context, _ []DevicePathAndNamespace) (map[DevicePathAndNamespace][]string, error) {
+	if err := mockWait(ctx); err != nil {
+		return map[DevicePathAndNamespace][]string{}, err
+	}
 	if GONVMEMock.InducedNVMeNamespaceIDError {
-		return map[DevicePathAndNamespace][]string{}, errors.New("listNamespaceID induced error")
+		return map[DevicePathAndNamespace][]string{}, inducedError("listNamespaceID", ErrNoObjectsFound)
 	}
 
 	mockedNamespaceIDs := make(map[DevicePathAndNamespace][]string)
@@ -218,8 +484,16 @@ func (nvme *MockNVMe) ListNVMeNamespaceID(_ []DevicePathAndNamespace) (map[Devic
 
 // ListNVMeDeviceAndNamespace returns the Device Paths and Namespace of each NVMe device and each output content
 func (nvme *MockNVMe) ListNVMeDeviceAndNamespace() ([]DevicePathAndNamespace, error) {
+	return nvme.ListNVMeDeviceAndNamespaceWithContext(context.Background())
+}
+
+// ListNVMeDeviceAndNamespaceWithContext returns the Device Paths and Namespace of each NVMe device and each output content
+func (nvme *MockNVMe) ListNVMeDeviceAndNamespaceWithContext(ctx context.Context) ([]DevicePathAndNamespace, error) {
+	if err := mockWait(ctx); err != nil {
+		return []DevicePathAndNamespace{}, err
+	}
 	if GONVMEMock.InducedNVMeDeviceAndNamespaceError {
-		return []DevicePathAndNamespace{}, errors.New("listNamespaceDevices induced error")
+		return []DevicePathAndNamespace{}, inducedError("listNamespaceDevices", ErrNoObjectsFound)
 	}
 
 	var mockedDeviceAndNamespaces []DevicePathAndNamespace
@@ -240,9 +514,12 @@ func (nvme *MockNVMe) ListNVMeDeviceAndNamespace() ([]DevicePathAndNamespace, er
 	return mockedDeviceAndNamespaces, nil
 }
 
-func (nvme *MockNVMe) getSessions() ([]NVMESession, error) {
+func (nvme *MockNVMe) getSessions(ctx context.Context) ([]NVMESession, error) {
+	if err := mockWait(ctx); err != nil {
+		return []NVMESession{}, err
+	}
 	if GONVMEMock.InduceGetSessionsError {
-		return []NVMESession{}, errors.New("getSessions induced error")
+		return []NVMESession{}, inducedError("getSessions", nil)
 	}
 
 	var sessions []NVMESession
@@ -268,47 +545,485 @@ func (nvme *MockNVMe) getSessions() ([]NVMESession, error) {
 
 // DiscoverNVMeTCPTargets runs an NVMe discovery and returns a list of targets.
 func (nvme *MockNVMe) DiscoverNVMeTCPTargets(address string, login bool) ([]NVMeTarget, error) {
-	return nvme.discoverNVMeTCPTargets(address, login)
+	return nvme.discoverNVMeTCPTargets(context.Background(), address, login)
+}
+
+// DiscoverNVMeTCPTargetsWithContext runs an NVMe discovery and returns a list of targets.
+func (nvme *MockNVMe) DiscoverNVMeTCPTargetsWithContext(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	return nvme.discoverNVMeTCPTargets(ctx, address, login)
 }
 
 // DiscoverNVMeFCTargets runs an NVMe discovery and returns a list of targets.
 func (nvme *MockNVMe) DiscoverNVMeFCTargets(address string, login bool) ([]NVMeTarget, error) {
-	return nvme.discoverNVMeFCTargets(address, login)
+	return nvme.discoverNVMeFCTargets(context.Background(), address, login)
+}
+
+// DiscoverNVMeFCTargetsWithContext runs an NVMe discovery and returns a list of targets.
+func (nvme *MockNVMe) DiscoverNVMeFCTargetsWithContext(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	return nvme.discoverNVMeFCTargets(ctx, address, login)
+}
+
+// DiscoverNVMeRDMATargets runs an NVMe discovery and returns a list of targets.
+func (nvme *MockNVMe) DiscoverNVMeRDMATargets(address string, login bool) ([]NVMeTarget, error) {
+	return nvme.discoverNVMeRDMATargets(context.Background(), address, login)
+}
+
+// DiscoverNVMeRDMATargetsWithContext runs an NVMe discovery and returns a list of targets.
+func (nvme *MockNVMe) DiscoverNVMeRDMATargetsWithContext(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	return nvme.discoverNVMeRDMATargets(ctx, address, login)
 }
 
 // GetInitiators returns a list of NVMe initiators on the local system.
 func (nvme *MockNVMe) GetInitiators(filename string) ([]string, error) {
-	return nvme.getInitiators(filename)
+	return nvme.getInitiators(context.Background(), filename)
+}
+
+// GetInitiatorsWithContext returns a list of NVMe initiators on the local system.
+func (nvme *MockNVMe) GetInitiatorsWithContext(ctx context.Context, filename string) ([]string, error) {
+	return nvme.getInitiators(ctx, filename)
 }
 
 // NVMeTCPConnect will attempt to log into an NVMe target
 func (nvme *MockNVMe) NVMeTCPConnect(target NVMeTarget, duplicateConnect bool) error {
-	return nvme.nvmeTCPConnect(target, duplicateConnect)
+	return nvme.nvmeTCPConnect(context.Background(), target, duplicateConnect)
+}
+
+// NVMeTCPConnectWithContext will attempt to log into an NVMe target
+func (nvme *MockNVMe) NVMeTCPConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	return nvme.nvmeTCPConnect(ctx, target, duplicateConnect)
 }
 
 // NVMeFCConnect will attempt to log into an NVMe target
 func (nvme *MockNVMe) NVMeFCConnect(target NVMeTarget, duplicateConnect bool) error {
-	return nvme.nvmeFCConnect(target, duplicateConnect)
+	return nvme.nvmeFCConnect(context.Background(), target, duplicateConnect)
+}
+
+// NVMeFCConnectWithContext will attempt to log into an NVMe target
+func (nvme *MockNVMe) NVMeFCConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	return nvme.nvmeFCConnect(ctx, target, duplicateConnect)
+}
+
+// NVMeRDMAConnect will attempt to log into an NVMe target
+func (nvme *MockNVMe) NVMeRDMAConnect(target NVMeTarget, duplicateConnect bool) error {
+	return nvme.nvmeRDMAConnect(context.Background(), target, duplicateConnect)
+}
+
+// NVMeRDMAConnectWithContext will attempt to log into an NVMe target
+func (nvme *MockNVMe) NVMeRDMAConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	return nvme.nvmeRDMAConnect(ctx, target, duplicateConnect)
 }
 
 // NVMeDisconnect will attempt to log out of an NVMe target
 func (nvme *MockNVMe) NVMeDisconnect(target NVMeTarget) error {
-	return nvme.nvmeDisconnect(target)
+	return nvme.nvmeDisconnect(context.Background(), target)
+}
+
+// NVMeDisconnectWithContext will attempt to log out of an NVMe target
+func (nvme *MockNVMe) NVMeDisconnectWithContext(ctx context.Context, target NVMeTarget) error {
+	return nvme.nvmeDisconnect(ctx, target)
 }
 
 // GetSessions Queries NVMe session info
 func (nvme *MockNVMe) GetSessions() ([]NVMESession, error) {
-	return nvme.getSessions()
+	return nvme.getSessions(context.Background())
+}
+
+// GetSessionsWithContext Queries NVMe session info
+func (nvme *MockNVMe) GetSessionsWithContext(ctx context.Context) ([]NVMESession, error) {
+	return nvme.getSessions(ctx)
 }
 
 // DeviceRescan rescan the NVMe device
 func (nvme *MockNVMe) DeviceRescan(device string) error {
-	return nvme.deviceRescan(device)
+	return nvme.deviceRescan(context.Background(), device)
+}
+
+// DeviceRescanWithContext rescan the NVMe device
+func (nvme *MockNVMe) DeviceRescanWithContext(ctx context.Context, device string) error {
+	return nvme.deviceRescan(ctx, device)
 }
 
-func (nvme *MockNVMe) deviceRescan(_ string) error {
+func (nvme *MockNVMe) deviceRescan(ctx context.Context, _ string) error {
+	if err := mockWait(ctx); err != nil {
+		return err
+	}
 	if GONVMEMock.InduceGetSessionsError {
-		return errors.New("deviceRescan induced error")
+		return inducedError("deviceRescan", nil)
 	}
 	return nil
 }
+
+// GetNVMeCLICapabilities returns what the mock nvme-cli supports
+func (nvme *MockNVMe) GetNVMeCLICapabilities() (Capabilities, error) {
+	return nvme.GetNVMeCLICapabilitiesWithContext(context.Background())
+}
+
+// GetNVMeCLICapabilitiesWithContext returns what the mock nvme-cli supports
+func (nvme *MockNVMe) GetNVMeCLICapabilitiesWithContext(ctx context.Context) (Capabilities, error) {
+	if err := mockWait(ctx); err != nil {
+		return Capabilities{}, err
+	}
+	if GONVMEMock.InduceVersionError {
+		return Capabilities{}, inducedError("getNVMeCLICapabilities", nil)
+	}
+	version := nvme.options[MockNVMeCLIVersion]
+	if version == "" {
+		version = "2.8"
+	}
+	nvmeVersion, libnvme, err := parseNVMeVersion([]byte(fmt.Sprintf("nvme version %s\nlibnvme version 1.8\n", version)))
+	if err != nil {
+		return Capabilities{}, err
+	}
+	if !nvmeVersion.AtLeast(2, 0) {
+		libnvme = Version{}
+	}
+	return newCapabilities(nvmeVersion, libnvme), nil
+}
+
+// NVMeTCPConnectWithOptions will attempt to connect into a given NVMeTCP target with the given controller settings
+func (nvme *MockNVMe) NVMeTCPConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	return nvme.nvmeTCPConnectWithOptions(ctx, target, options)
+}
+
+// NVMeFCConnectWithOptions will attempt to connect into a given NVMeFC target with the given controller settings
+func (nvme *MockNVMe) NVMeFCConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	return nvme.nvmeFCConnectWithOptions(ctx, target, options)
+}
+
+// NVMeRDMAConnectWithOptions will attempt to connect into a given NVMeRDMA target with the given controller settings
+func (nvme *MockNVMe) NVMeRDMAConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	return nvme.nvmeRDMAConnectWithOptions(ctx, target, options)
+}
+
+// mockHostID is the host ID of the mock host identity
+const mockHostID = "02a08600-57d6-4089-8736-bf1f7326990e"
+
+// GetHostIdentity returns the mock host identity
+func (nvme *MockNVMe) GetHostIdentity() (HostIdentity, error) {
+	return nvme.GetHostIdentityWithContext(context.Background())
+}
+
+// GetHostIdentityWithContext returns the mock host identity
+func (nvme *MockNVMe) GetHostIdentityWithContext(ctx context.Context) (HostIdentity, error) {
+	if err := mockWait(ctx); err != nil {
+		return HostIdentity{}, err
+	}
+	if GONVMEMock.InduceInitiatorError {
+		return HostIdentity{}, inducedError("getHostIdentity", nil)
+	}
+	return HostIdentity{HostNQN: UUIDHostNQNPrefix + mockHostID, HostID: mockHostID}, nil
+}
+
+// EnsureHostIdentity returns the mock host identity
+func (nvme *MockNVMe) EnsureHostIdentity(fromDMI bool) (HostIdentity, error) {
+	return nvme.EnsureHostIdentityWithContext(context.Background(), fromDMI)
+}
+
+// EnsureHostIdentityWithContext returns the mock host identity
+func (nvme *MockNVMe) EnsureHostIdentityWithContext(ctx context.Context, _ bool) (HostIdentity, error) {
+	return nvme.GetHostIdentityWithContext(ctx)
+}
+
+// SetHostIdentity checks the host identity to write
+func (nvme *MockNVMe) SetHostIdentity(identity HostIdentity) error {
+	return nvme.SetHostIdentityWithContext(context.Background(), identity)
+}
+
+// SetHostIdentityWithContext checks the host identity to write
+func (nvme *MockNVMe) SetHostIdentityWithContext(ctx context.Context, identity HostIdentity) error {
+	if err := mockWait(ctx); err != nil {
+		return err
+	}
+	if GONVMEMock.InduceInitiatorError {
+		return inducedError("setHostIdentity", nil)
+	}
+	return validateHostIdentity(identity)
+}
+
+// GetDiscoveryConf returns a discovery controller for each mock NVMeTCP target
+func (nvme *MockNVMe) GetDiscoveryConf() ([]NVMeTarget, error) {
+	return nvme.GetDiscoveryConfWithContext(context.Background())
+}
+
+// GetDiscoveryConfWithContext returns a discovery controller for each mock NVMeTCP target
+func (nvme *MockNVMe) GetDiscoveryConfWithContext(ctx context.Context) ([]NVMeTarget, error) {
+	if err := mockWait(ctx); err != nil {
+		return []NVMeTarget{}, err
+	}
+	if GONVMEMock.InduceConfigError {
+		return []NVMeTarget{}, inducedError("getDiscoveryConf", nil)
+	}
+	count := getOptionAsInt(nvme.options, MockNumberOfTCPTargets)
+	if count == 0 {
+		count = 1
+	}
+	targets := make([]NVMeTarget, 0, count)
+	for idx := 0; idx < int(count); idx++ {
+		targets = append(targets, NVMeTarget{
+			Portal:     fmt.Sprintf("1.1.1.%d", idx),
+			TrType:     NVMeTransportTypeTCP,
+			TargetType: NVMeTransportTypeTCP,
+			TrsvcID:    NVMeDiscoveryPort,
+		})
+	}
+	return targets, nil
+}
+
+// SetDiscoveryConf checks the discovery controllers to write
+func (nvme *MockNVMe) SetDiscoveryConf(targets []NVMeTarget) error {
+	return nvme.SetDiscoveryConfWithContext(context.Background(), targets)
+}
+
+// SetDiscoveryConfWithContext checks the discovery controllers to write
+func (nvme *MockNVMe) SetDiscoveryConfWithContext(ctx context.Context, targets []NVMeTarget) error {
+	if err := mockWait(ctx); err != nil {
+		return err
+	}
+	if GONVMEMock.InduceConfigError {
+		return inducedError("setDiscoveryConf", nil)
+	}
+	return validateConfigTargets(targets)
+}
+
+// GetFabricsConfig returns the mock sessions as libnvme configuration
+func (nvme *MockNVMe) GetFabricsConfig() (FabricsConfig, error) {
+	return nvme.GetFabricsConfigWithContext(context.Background())
+}
+
+// GetFabricsConfigWithContext returns the mock sessions as libnvme configuration
+func (nvme *MockNVMe) GetFabricsConfigWithContext(ctx context.Context) (FabricsConfig, error) {
+	if GONVMEMock.InduceConfigError {
+		return nil, inducedError("getFabricsConfig", nil)
+	}
+	return nvme.ExportSessionsWithContext(ctx)
+}
+
+// SetFabricsConfig checks the libnvme configuration to write
+func (nvme *MockNVMe) SetFabricsConfig(config FabricsConfig) error {
+	return nvme.SetFabricsConfigWithContext(context.Background(), config)
+}
+
+// SetFabricsConfigWithContext checks the libnvme configuration to write
+func (nvme *MockNVMe) SetFabricsConfigWithContext(ctx context.Context, config FabricsConfig) error {
+	if err := mockWait(ctx); err != nil {
+		return err
+	}
+	if GONVMEMock.InduceConfigError {
+		return inducedError("setFabricsConfig", nil)
+	}
+	return config.validate()
+}
+
+// ExportSessions returns the mock sessions as libnvme configuration
+func (nvme *MockNVMe) ExportSessions() (FabricsConfig, error) {
+	return nvme.ExportSessionsWithContext(context.Background())
+}
+
+// ExportSessionsWithContext returns the mock sessions as libnvme configuration
+func (nvme *MockNVMe) ExportSessionsWithContext(ctx context.Context) (FabricsConfig, error) {
+	sessions, err := nvme.getSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := nvme.GetHostIdentityWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewFabricsConfig(identity, sessionTargets(sessions)), nil
+}
+
+// WatchDiscovery reports the mock NVMeTCP targets of the discovery controller, which never change
+func (nvme *MockNVMe) WatchDiscovery(ctx context.Context, options DiscoveryWatchOptions) (<-chan DiscoveryChange, error) {
+	if options.Transport != "" && options.Transport != NVMeTransportTypeTCP {
+		return nil, fmt.Errorf("unknown transport %q", options.Transport)
+	}
+	targets, err := nvme.discoverNVMeTCPTargets(ctx, options.Address, false)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(chan DiscoveryChange, 1)
+	changes <- DiscoveryChange{Added: targets}
+	go func() {
+		<-ctx.Done()
+		close(changes)
+	}()
+	return changes, nil
+}
+
+// GetNamespacePaths returns the mock namespaces, each with an optimized and a non-optimized path
+func (nvme *MockNVMe) GetNamespacePaths() ([]NVMeNamespacePaths, error) {
+	return nvme.GetNamespacePathsWithContext(context.Background())
+}
+
+// GetNamespacePathsWithContext returns the mock namespaces, each with an optimized and a non-optimized path
+func (nvme *MockNVMe) GetNamespacePathsWithContext(ctx context.Context) ([]NVMeNamespacePaths, error) {
+	if err := mockWait(ctx); err != nil {
+		return []NVMeNamespacePaths{}, err
+	}
+	if GONVMEMock.InduceGetSessionsError {
+		return []NVMeNamespacePaths{}, inducedError("getNamespacePaths", nil)
+	}
+	count := getOptionAsInt(nvme.options, MockNumberOfNamespaceDevices)
+	if count == 0 {
+		count = 1
+	}
+	namespaces := make([]NVMeNamespacePaths, 0, count)
+	for idx := 1; idx <= int(count); idx++ {
+		nsid := uint32(idx) // #nosec G115
+		namespaces = append(namespaces, NVMeNamespacePaths{
+			Device:       fmt.Sprintf("nvme0n%d", idx),
+			SubsystemNQN: "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D0",
+			NamespaceID:  nsid,
+			Paths: []NVMePath{
+				{Name: fmt.Sprintf("nvme0c0n%d", idx), Controller: "nvme0", NamespaceID: nsid, ANAGroupID: 1, ANAState: ANAStateOptimized, State: NVMESessionStateLive},
+				{Name: fmt.Sprintf("nvme0c1n%d", idx), Controller: "nvme1", NamespaceID: nsid, ANAGroupID: 2, ANAState: ANAStateNonOptimized, State: NVMESessionStateLive},
+			},
+			OptimizedPaths: 1,
+		})
+	}
+	return namespaces, nil
+}
+
+// GetTopology returns the mock host with a subsystem per mock session and the mock namespaces
+func (nvme *MockNVMe) GetTopology() (Topology, error) {
+	return nvme.GetTopologyWithContext(context.Background())
+}
+
+// GetTopologyWithContext returns the mock host with a subsystem per mock session and the
+// mock namespaces in the first
+func (nvme *MockNVMe) GetTopologyWithContext(ctx context.Context) (Topology, error) {
+	sessions, err := nvme.getSessions(ctx)
+	if err != nil {
+		return Topology{}, err
+	}
+	namespaces, err := nvme.GetNamespacePathsWithContext(ctx)
+	if err != nil {
+		return Topology{}, err
+	}
+	topology := Topology{HostNQN: UUIDHostNQNPrefix + mockHostID, HostID: mockHostID}
+	for idx, session := range sessions {
+		subsystem := NVMeSubsystem{
+			Name:     fmt.Sprintf("nvme-subsys%d", idx),
+			NQN:      session.Target,
+			Model:    "dellemc",
+			Serial:   "FP08RZ2",
+			IOPolicy: "round-robin",
+			Controllers: []NVMeController{{
+				Name:      session.Name,
+				CntlID:    strconv.Itoa(idx + 1),
+				Transport: session.NVMETransportName,
+				Address:   "traddr=" + session.Portal + ",trsvcid=" + NVMePort,
+				State:     session.NVMESessionState,
+			}},
+			Namespaces: []NVMeNamespace{},
+		}
+		if idx == 0 {
+			for _, ns := range namespaces {
+				subsystem.Namespaces = append(subsystem.Namespaces, NVMeNamespace{
+					NamespaceID:    ns.NamespaceID,
+					NGUID:          fmt.Sprintf("507911ecda65a2498ccf0968%08x", ns.NamespaceID),
+					Device:         "/dev/" + ns.Device,
+					Paths:          ns.Paths,
+					OptimizedPaths: ns.OptimizedPaths,
+					Size:           5368709120,
+				})
+			}
+		}
+		topology.Subsystems = append(topology.Subsystems, subsystem)
+	}
+	return topology, nil
+}
+
+// ConnectAll connects to the mock targets with bounded concurrency
+func (nvme *MockNVMe) ConnectAll(ctx context.Context, targets []NVMeTarget, options ConnectAllOptions) ([]TargetConnectResult, error) {
+	return connectAll(ctx, targets, options, nvme.connectTarget)
+}
+
+func (nvme *MockNVMe) connectTarget(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	switch transport := targetTransport(target); transport {
+	case NVMeTransportTypeTCP:
+		return nvme.nvmeTCPConnectWithOptions(ctx, target, options)
+	case NVMeTransportTypeFC:
+		return nvme.nvmeFCConnectWithOptions(ctx, target, options)
+	case NVMeTransportTypeRDMA:
+		return nvme.nvmeRDMAConnectWithOptions(ctx, target, options)
+	default:
+		return ConnectResult{}, fmt.Errorf("unknown transport %q", transport)
+	}
+}
+
+// WaitForNamespace returns the mock namespace with the identifier, or waits until ctx is done
+// if there is none
+func (nvme *MockNVMe) WaitForNamespace(ctx context.Context, identifier NamespaceIdentifier) (NVMeNamespace, error) {
+	if err := identifier.validate(); err != nil {
+		return NVMeNamespace{}, err
+	}
+	topology, err := nvme.GetTopologyWithContext(ctx)
+	if err != nil {
+		return NVMeNamespace{}, err
+	}
+	for _, subsystem := range topology.Subsystems {
+		for _, ns := range subsystem.Namespaces {
+			if identifier.matches(subsystem.NQN, ns) {
+				return ns, nil
+			}
+		}
+	}
+	<-ctx.Done()
+	return NVMeNamespace{}, contextError(ctx, ctx.Err())
+}
+
+// FindDevicesByNamespaceID returns the head and path devices of the mock namespace with the identifier
+func (nvme *MockNVMe) FindDevicesByNamespaceID(id string) ([]NamespaceDevice, error) {
+	return nvme.FindDevicesByNamespaceIDWithContext(context.Background(), id)
+}
+
+// FindDevicesByNamespaceIDWithContext returns the head and path devices of the mock namespace
+// with the identifier
+func (nvme *MockNVMe) FindDevicesByNamespaceIDWithContext(ctx context.Context, id string) ([]NamespaceDevice, error) {
+	want := normalizeNamespaceID(id)
+	if want == "" {
+		return []NamespaceDevice{}, fmt.Errorf("invalid namespace identifier %q", id)
+	}
+	topology, err := nvme.GetTopologyWithContext(ctx)
+	if err != nil {
+		return []NamespaceDevice{}, err
+	}
+	devices := make([]NamespaceDevice, 0)
+	for _, subsystem := range topology.Subsystems {
+		for _, ns := range subsystem.Namespaces {
+			if normalizeNamespaceID(ns.NGUID) != want {
+				continue
+			}
+			devices = append(devices, NamespaceDevice{Name: strings.TrimPrefix(ns.Device, "/dev/"), Head: true, NamespaceID: ns.NamespaceID})
+			for _, path := range ns.Paths {
+				devices = append(devices, NamespaceDevice{Name: path.Name, NamespaceID: ns.NamespaceID})
+			}
+		}
+	}
+	return devices, nil
+}
+
+// GetControllerInfo returns the Identify Controller data of the mock controllers
+func (nvme *MockNVMe) GetControllerInfo(ctrl string) (ControllerInfo, error) {
+	return nvme.GetControllerInfoWithContext(context.Background(), ctrl)
+}
+
+// GetControllerInfoWithContext returns the Identify Controller data of the mock controllers,
+// parsed from the file of the MockIdentifyControllerFile option
+func (nvme *MockNVMe) GetControllerInfoWithContext(ctx context.Context, _ string) (ControllerInfo, error) {
+	if err := mockWait(ctx); err != nil {
+		return ControllerInfo{}, err
+	}
+	if GONVMEMock.InduceIdentifyControllerError {
+		return ControllerInfo{}, inducedError("identify controller", ErrNoObjectsFound)
+	}
+	out := []byte(mockIdentifyController)
+	if file := nvme.options[MockIdentifyControllerFile]; file != "" {
+		var err error
+		if out, err = os.ReadFile(filepath.Clean(file)); err != nil {
+			return ControllerInfo{}, err
+		}
+	}
+	return parseIDController(out)
+}
@@ -0,0 +1,234 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+const (
+	// namespacePollInterval is how often WaitForNamespace looks for the namespace in sysfs
+	namespacePollInterval = 500 * time.Millisecond
+	// namespaceRescanInterval is how often WaitForNamespace rescans the controllers while
+	// the namespace is missing
+	namespaceRescanInterval = 10 * time.Second
+)
+
+// NamespaceIdentifier selects a namespace by one of its unique identifiers, or by the NQN of
+// its subsystem and its namespace ID. Identifiers are compared ignoring case and dashes.
+type NamespaceIdentifier struct {
+	NGUID        string
+	UUID         string
+	EUI64        string
+	SubsystemNQN string
+	NamespaceID  uint32
+}
+
+func (id NamespaceIdentifier) validate() error {
+	set := 0
+	for _, s := range []string{id.NGUID, id.UUID, id.EUI64} {
+		if s != "" {
+			set++
+		}
+	}
+	if id.SubsystemNQN != "" || id.NamespaceID != 0 {
+		if id.SubsystemNQN == "" || id.NamespaceID == 0 {
+			return errors.New("a namespace ID selects a namespace together with the NQN of its subsystem")
+		}
+		set++
+	}
+	if set != 1 {
+		return errors.New("a namespace is selected by exactly one of its NGUID, UUID, EUI64, or subsystem NQN and namespace ID")
+	}
+	return nil
+}
+
+// matches reports whether ns of the subsystem with the NQN subsysNQN is the identified namespace
+func (id NamespaceIdentifier) matches(subsysNQN string, ns NVMeNamespace) bool {
+	switch {
+	case id.NGUID != "":
+		return ns.NGUID != "" && normalizeNamespaceID(ns.NGUID) == normalizeNamespaceID(id.NGUID)
+	case id.UUID != "":
+		return ns.UUID != "" && normalizeNamespaceID(ns.UUID) == normalizeNamespaceID(id.UUID)
+	case id.EUI64 != "":
+		return ns.EUI64 != "" && normalizeNamespaceID(ns.EUI64) == normalizeNamespaceID(id.EUI64)
+	default:
+		return subsysNQN == id.SubsystemNQN && ns.NamespaceID == id.NamespaceID
+	}
+}
+
+// NamespaceDevice is a block device of a namespace
+type NamespaceDevice struct {
+	Name string // e.g. nvme0n1, or nvme0c1n1 for a path device
+	// Head is set for the device I/O goes to, /dev/<Name>; path devices have no device node
+	Head        bool
+	NamespaceID uint32
+}
+
+// namespaceIDAttributes are the sysfs attributes of a namespace block device holding its identifiers
+var namespaceIDAttributes = []string{"nguid", "uuid", "eui", "wwid"}
+
+// normalizeNamespaceID returns a namespace identifier in lower case without dashes and without
+// the eui. or uuid. prefix of a wwid, or "" if it is not set
+func normalizeNamespaceID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	for _, prefix := range []string{"eui.", "uuid."} {
+		id = strings.TrimPrefix(id, prefix)
+	}
+	id = strings.ReplaceAll(id, "-", "")
+	// a namespace reports an identifier it does not have as zeros
+	if strings.Trim(id, "0") == "" {
+		return ""
+	}
+	return id
+}
+
+// FindDevicesByNamespaceID returns the head and path devices of the namespace with the NGUID,
+// UUID, EUI64 or wwid id
+func (nvme *NVMe) FindDevicesByNamespaceID(id string) ([]NamespaceDevice, error) {
+	return nvme.FindDevicesByNamespaceIDWithContext(context.Background(), id)
+}
+
+// FindDevicesByNamespaceIDWithContext returns the head and path devices of the namespace with
+// the NGUID, UUID, EUI64 or wwid id, read from /sys/block/nvme*/{nguid,uuid,eui,wwid} in one
+// pass. Identifiers are compared ignoring case, dashes and the eui. and uuid. prefixes of wwids.
+func (nvme *NVMe) FindDevicesByNamespaceIDWithContext(ctx context.Context, id string) ([]NamespaceDevice, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.FindDevicesByNamespaceID")()
+	if err := ctx.Err(); err != nil {
+		return []NamespaceDevice{}, contextError(ctx, err)
+	}
+	return nvme.findDevicesByNamespaceID(ctx, id)
+}
+
+func (nvme *NVMe) findDevicesByNamespaceID(ctx context.Context, id string) ([]NamespaceDevice, error) {
+	want := normalizeNamespaceID(id)
+	if want == "" {
+		err := fmt.Errorf("invalid namespace identifier %q", id)
+		logger.Error(ctx, "Error finding namespace devices: %v", err)
+		return []NamespaceDevice{}, err
+	}
+	blocks, err := filepath.Glob(nvme.sysfsPath(sysfsBlockClass, "nvme*"))
+	if err != nil {
+		logger.Error(ctx, "Error gathering nvme block devices: %v", err)
+		return []NamespaceDevice{}, err
+	}
+	sortSysfsNames(blocks)
+
+	devices := make([]NamespaceDevice, 0)
+	for _, block := range blocks {
+		name := filepath.Base(block)
+		head := sysfsNamespaceRegexp.MatchString(name)
+		if !head && !sysfsPathRegexp.MatchString(name) {
+			continue
+		}
+		for _, attribute := range namespaceIDAttributes {
+			if normalizeNamespaceID(readSysfsAttribute(filepath.Join(block, attribute))) == want {
+				devices = append(devices, NamespaceDevice{
+					Name:        name,
+					Head:        head,
+					NamespaceID: parseSysfsUint32(readSysfsAttribute(filepath.Join(block, "nsid"))),
+				})
+				break
+			}
+		}
+	}
+	return devices, nil
+}
+
+// WaitForNamespace waits until the block device of the identified namespace appears after a
+// connect and returns the namespace with its head device and paths. It looks for the
+// namespace in sysfs, and for its device under /dev, every half second, rescanning the
+// controllers while it is missing. It gives up when ctx is done; an expired deadline is
+// reported as ErrTimeout.
+func (nvme *NVMe) WaitForNamespace(ctx context.Context, identifier NamespaceIdentifier) (NVMeNamespace, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.WaitForNamespace")()
+	return nvme.waitForNamespace(ctx, identifier)
+}
+
+func (nvme *NVMe) waitForNamespace(ctx context.Context, identifier NamespaceIdentifier) (NVMeNamespace, error) {
+	if err := identifier.validate(); err != nil {
+		logger.Error(ctx, "Error waiting for namespace %+v: %v", identifier, err)
+		return NVMeNamespace{}, err
+	}
+	ticker := time.NewTicker(namespacePollInterval)
+	defer ticker.Stop()
+	var rescanned time.Time
+	for {
+		ns, controllers, ok := nvme.findNamespace(ctx, identifier)
+		if ok {
+			if _, err := os.Stat(nvme.hostFile(ns.Device)); err == nil {
+				logger.Info(ctx, "namespace %+v is %s", identifier, ns.Device)
+				return ns, nil
+			}
+			logger.Debug(ctx, "waiting for %s to be created", ns.Device)
+		} else if time.Since(rescanned) >= namespaceRescanInterval {
+			// a namespace the controller did not announce shows up after a rescan
+			for _, controller := range controllers {
+				if err := nvme.DeviceRescanWithContext(ctx, "/dev/"+controller); err != nil {
+					logger.Debug(ctx, "Error rescanning %s: %v", controller, err)
+				}
+			}
+			rescanned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			err := contextError(ctx, ctx.Err())
+			logger.Error(ctx, "Error waiting for namespace %+v: %v", identifier, err)
+			return NVMeNamespace{}, err
+		case <-ticker.C:
+		}
+	}
+}
+
+// findNamespace returns the identified namespace if sysfs has it, or else the controllers
+// which might reach it: those of its subsystem if the identifier names one, all otherwise
+func (nvme *NVMe) findNamespace(ctx context.Context, identifier NamespaceIdentifier) (NVMeNamespace, []string, bool) {
+	subsystems, err := filepath.Glob(nvme.sysfsPath(sysfsNVMeSubsystemClass, "nvme-subsys*"))
+	if err != nil {
+		logger.Error(ctx, "Error gathering nvme subsystems: %v", err)
+		return NVMeNamespace{}, nil, false
+	}
+	sortSysfsNames(subsystems)
+	var candidates []string
+	for _, subsystem := range subsystems {
+		controllers, err := sysfsSubsystemControllers(subsystem)
+		if err != nil {
+			logger.Debug(ctx, "Error reading nvme subsystem %s: %v", subsystem, err)
+			continue
+		}
+		s := nvme.sysfsSubsystem(ctx, subsystem, controllers)
+		for _, ns := range s.Namespaces {
+			if identifier.matches(s.NQN, ns) {
+				return ns, nil, true
+			}
+		}
+		if identifier.SubsystemNQN == "" || identifier.SubsystemNQN == s.NQN {
+			candidates = append(candidates, controllers...)
+		}
+	}
+	return NVMeNamespace{}, candidates, false
+}
@@ -0,0 +1,185 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"sort"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+// sysfsInfinibandClass lists the RDMA devices, for both InfiniBand and RoCE
+const sysfsInfinibandClass = "/sys/class/infiniband"
+
+// interfaceAddrs returns the addresses of the network interface name
+func interfaceAddrs(name string) ([]net.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return iface.Addrs()
+}
+
+// DiscoverNVMeRDMATargets - runs nvme discovery and returns a list of NVMeRDMA targets.
+func (nvme *NVMe) DiscoverNVMeRDMATargets(address string, login bool) ([]NVMeTarget, error) {
+	return nvme.DiscoverNVMeRDMATargetsWithContext(context.Background(), address, login)
+}
+
+// DiscoverNVMeRDMATargetsWithContext - runs nvme discovery bounded by ctx and returns a list of NVMeRDMA targets.
+func (nvme *NVMe) DiscoverNVMeRDMATargetsWithContext(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.DiscoverNVMeRDMATargets")()
+	return nvme.discoverNVMeRDMATargets(ctx, address, login)
+}
+
+func (nvme *NVMe) discoverNVMeRDMATargets(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	// nvme discovery is done via nvme cli
+	// nvme discover -t rdma -a <NVMe interface IP> -s <port> [-w <host IP>]
+	host, ports := splitDiscoveryAddress(address, NVMePort)
+	args := []string{"-t", "rdma", "-a", host, "-s", ports[0]}
+	hostAddress := nvme.selectRDMAHostAddress(ctx, host)
+	if hostAddress != "" {
+		args = append(args, "-w", hostAddress)
+	}
+	log, err := nvme.runNVMeDiscover(ctx, args)
+	if err != nil {
+		logger.Error(ctx, "Error discovering %s: %v", address, err)
+		return []NVMeTarget{}, err
+	}
+
+	targets := log.targets(NVMeTransportTypeRDMA)
+	for i := range targets {
+		targets[i].HostAdr = hostAddress
+	}
+
+	// log into the targets if asked
+	if login {
+		return targets, nvme.loginTargets(ctx, targets)
+	}
+
+	return targets, nil
+}
+
+// NVMeRDMAConnect will attempt to connect into a given NVMeRDMA target
+func (nvme *NVMe) NVMeRDMAConnect(target NVMeTarget, duplicateConnect bool) error {
+	return nvme.NVMeRDMAConnectWithContext(context.Background(), target, duplicateConnect)
+}
+
+// NVMeRDMAConnectWithContext will attempt to connect into a given NVMeRDMA target, giving up when ctx is done
+func (nvme *NVMe) NVMeRDMAConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	defer tracer.TraceFuncCall(ctx, "gonvme.NVMeRDMAConnect")()
+	return nvme.nvmeRDMAConnect(ctx, target, duplicateConnect)
+}
+
+func (nvme *NVMe) nvmeRDMAConnect(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	_, err := nvme.nvmeRDMAConnectWithOptions(ctx, target, ConnectOptions{DuplicateConnect: duplicateConnect})
+	return err
+}
+
+// NVMeRDMAConnectWithOptions will attempt to connect into a given NVMeRDMA target with the given
+// controller settings, giving up when ctx is done
+func (nvme *NVMe) NVMeRDMAConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.NVMeRDMAConnectWithOptions")()
+	return nvme.nvmeRDMAConnectWithOptions(ctx, target, options)
+}
+
+func (nvme *NVMe) nvmeRDMAConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	options, err := resolveConnectOptions(nvme.options, NVMeTransportTypeRDMA, options)
+	if err != nil {
+		logger.Error(ctx, "Error during NVMe/RDMA connect %s: %v", target.TargetNqn, err)
+		return ConnectResult{}, err
+	}
+	address, port, err := targetAddress(target)
+	if err != nil {
+		logger.Error(ctx, "Error during NVMe/RDMA connect %s: %v", target.TargetNqn, err)
+		return ConnectResult{}, err
+	}
+	// the local address the connection originates from, the one on the
+	// subnet of the target unless the options or the target name one
+	if options.HostTraddr == "" {
+		options.HostTraddr = target.HostAdr
+	}
+	if options.HostTraddr == "" {
+		options.HostTraddr = nvme.selectRDMAHostAddress(ctx, address)
+	}
+	target.HostAdr = options.HostTraddr
+	result := ConnectResult{Options: options}
+	if nvme.options[ConnectBackend] == BackendFabrics {
+		result.AlreadyConnected, err = nvme.fabricsConnect(ctx, NVMeTransportTypeRDMA, target, options)
+		return result, err
+	}
+	// nvme connect is done via the nvme cli
+	// nvme connect -t rdma -n <target NQN> -a <NVMe interface IP> -s <target port> [-w <host IP>]
+	// D allows duplicate connections between same transport host and subsystem port
+	exe := []string{NVMeCommand, "connect", "-t", "rdma", "-n", target.TargetNqn, "-a", address, "-s", port}
+	if target.HostAdr != "" {
+		exe = append(exe, "-w", target.HostAdr)
+	}
+	result.AlreadyConnected, err = nvme.runNVMeConnect(ctx, "NVMe/RDMA", target, append(exe, options.args()...))
+	return result, err
+}
+
+// rdmaNetDevices returns the network interfaces backed by an RDMA device
+func (nvme *NVMe) rdmaNetDevices() []string {
+	// /sys/class/infiniband/<device>/ports/<port>/gid_attrs/ndevs/<gid index> holds the interface name
+	files, err := filepath.Glob(nvme.sysfsPath(sysfsInfinibandClass, "*", "ports", "*", "gid_attrs", "ndevs", "*"))
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var devices []string
+	for _, file := range files {
+		name := readSysfsAttribute(file)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		devices = append(devices, name)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// selectRDMAHostAddress returns the address of the RDMA capable interface on the subnet of
+// portal, or "" to let the kernel pick the source address
+func (nvme *NVMe) selectRDMAHostAddress(ctx context.Context, portal string) string {
+	// the zone of a link-local address does not matter for the subnet
+	addr, err := netip.ParseAddr(portal)
+	if err != nil {
+		return ""
+	}
+	ip := net.IP(addr.WithZone("").AsSlice())
+	for _, device := range nvme.rdmaNetDevices() {
+		addrs, err := nvme.interfaceAddrs(device)
+		if err != nil {
+			logger.Debug(ctx, "Error gathering addresses of %s: %v", device, err)
+			continue
+		}
+		for _, addr := range addrs {
+			network, ok := addr.(*net.IPNet)
+			if ok && network.Contains(ip) {
+				logger.Debug(ctx, "using %s of %s to reach %s", network.IP, device, portal)
+				return network.IP.String()
+			}
+		}
+	}
+	return ""
+}
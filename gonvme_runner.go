@@ -0,0 +1,99 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+)
+
+// CommandResult holds the outcome of a command run by a CommandRunner
+type CommandResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// CommandRunner executes the nvme-cli commands issued by an NVMe client.
+// args[0] is the program to run and args[1:] its arguments.
+// Run must return a non-nil error when the command could not be run or exited
+// with a non-zero status; in the latter case ExitCode holds that status.
+type CommandRunner interface {
+	Run(ctx context.Context, args []string) (CommandResult, error)
+}
+
+// Option customizes an NVMe client created by NewNVMe
+type Option func(*NVMe)
+
+// WithCommandRunner makes the NVMe client run its commands through runner,
+// e.g. to route them via nsenter, sudo or an audit wrapper.
+// The runner receives the commands without the ChrootDirectory prefix.
+func WithCommandRunner(runner CommandRunner) Option {
+	return func(nvme *NVMe) {
+		nvme.runner = runner
+	}
+}
+
+// NewExecCommandRunner returns the default CommandRunner, which runs commands with os/exec
+// inside chrootDirectory. An empty chrootDirectory or "/" runs them without chroot.
+func NewExecCommandRunner(chrootDirectory string) CommandRunner {
+	return &execCommandRunner{chrootDirectory: chrootDirectory}
+}
+
+type execCommandRunner struct {
+	chrootDirectory string
+}
+
+func (r *execCommandRunner) Run(ctx context.Context, args []string) (CommandResult, error) {
+	exe := buildChrootCommand(r.chrootDirectory, args)
+	cmd := exec.CommandContext(ctx, exe[0], exe[1:]...) // #nosec G204
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	result := CommandResult{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		ExitCode: -1,
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	return result, err
+}
+
+func buildChrootCommand(chrootDirectory string, cmd []string) []string {
+	if chrootDirectory == "" || chrootDirectory == "/" {
+		return cmd
+	}
+	command := []string{"chroot", chrootDirectory}
+	command = append(command, cmd...)
+	return command
+}
+
+// lastLine returns the last line written to a command's output
+func lastLine(out []byte) string {
+	var line string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line = scanner.Text()
+	}
+	return line
+}
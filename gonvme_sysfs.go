@@ -0,0 +1,126 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dell/gonvme/internal/logger"
+)
+
+const (
+	// SessionsBackend selects how GetSessions enumerates the NVMe sessions,
+	// either BackendNVMeCLI (the default) or BackendSysfs
+	SessionsBackend = "sessionsBackend"
+
+	// BackendNVMeCLI runs nvme-cli to query the kernel
+	BackendNVMeCLI = "nvme-cli"
+
+	// BackendSysfs reads the kernel state from sysfs, below the ChrootDirectory if one is set
+	BackendSysfs = "sysfs"
+
+	// SysfsRoot is the option naming the directory sysfs is read below instead of the
+	// ChrootDirectory, e.g. a fixture tree in tests
+	SysfsRoot = "sysfsRoot"
+
+	sysfsNVMeSubsystemClass = "/sys/class/nvme-subsystem"
+	sysfsNVMeClass          = "/sys/class/nvme"
+	sysfsBlockClass         = "/sys/block"
+)
+
+var sysfsControllerRegexp = regexp.MustCompile(`^nvme[0-9]+$`)
+
+// sysfsPath returns the path of a sysfs file below the SysfsRoot, or the ChrootDirectory if none is set
+func (nvme *NVMe) sysfsPath(elem ...string) string {
+	root := nvme.options[SysfsRoot]
+	if root == "" {
+		root = nvme.getChrootDirectory()
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// readSysfsAttribute returns the trimmed content of a sysfs attribute, or "" if it cannot be read
+func readSysfsAttribute(path string) string {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// getSysfsSessions builds the NVMe sessions from /sys/class/nvme-subsystem and /sys/class/nvme,
+// in the same order nvme list-subsys reports them
+func (nvme *NVMe) getSysfsSessions(ctx context.Context) ([]NVMESession, error) {
+	subsystems, err := filepath.Glob(nvme.sysfsPath(sysfsNVMeSubsystemClass, "nvme-subsys*"))
+	if err != nil {
+		logger.Error(ctx, "Error gathering nvme subsystems: %v", err)
+		return []NVMESession{}, err
+	}
+	sortSysfsNames(subsystems)
+
+	var sessions []NVMESession
+	for _, subsystem := range subsystems {
+		subsysNQN := readSysfsAttribute(filepath.Join(subsystem, "subsysnqn"))
+		controllers, err := sysfsSubsystemControllers(subsystem)
+		if err != nil {
+			logger.Error(ctx, "Error reading nvme subsystem %s: %v", subsystem, err)
+			continue
+		}
+
+		for _, name := range controllers {
+			controller := nvme.sysfsPath(sysfsNVMeClass, name)
+			session, ok := newNVMESession(subsysNQN, name,
+				readSysfsAttribute(filepath.Join(controller, "transport")),
+				readSysfsAttribute(filepath.Join(controller, "address")),
+				readSysfsAttribute(filepath.Join(controller, "state")))
+			if !ok {
+				continue
+			}
+			sessions = append(sessions, session)
+		}
+	}
+	if len(sessions) == 0 {
+		return []NVMESession{}, nil
+	}
+	return sessions, nil
+}
+
+// sortSysfsNames sorts sysfs entries such as nvme2 and nvme10 by their instance number
+func sortSysfsNames(names []string) {
+	instance := func(name string) (string, int) {
+		name = filepath.Base(name)
+		i := strings.LastIndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+		n := 0
+		for _, r := range name[i+1:] {
+			n = n*10 + int(r-'0')
+		}
+		return name[:i+1], n
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, ni := instance(names[i])
+		pj, nj := instance(names[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return ni < nj
+	})
+}
@@ -0,0 +1,133 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/nvmetcp"
+)
+
+const (
+	// DiscoveryBackend selects how DiscoverNVMeTCPTargets fetches the discovery log,
+	// either BackendNVMeCLI (the default) or BackendNative
+	DiscoveryBackend = "discoveryBackend"
+
+	// BackendNative talks NVMe/TCP to the discovery controller itself,
+	// without nvme-cli or the nvme-tcp kernel module
+	BackendNative = "native"
+)
+
+// nativeDiscoverNVMeTCPTargets connects to the discovery controller at address,
+// in host:port form, and returns the NVMe/TCP entries of its discovery log
+func (nvme *NVMe) nativeDiscoverNVMeTCPTargets(ctx context.Context, address string) ([]NVMeTarget, error) {
+	log, err := nvme.nativeDiscoveryLog(ctx, address)
+	if err != nil {
+		return []NVMeTarget{}, err
+	}
+	return log.targets(NVMeTransportTypeTCP), nil
+}
+
+// nativeDiscoveryLog connects to the discovery controller at address, in host:port form,
+// and returns its discovery log
+func (nvme *NVMe) nativeDiscoveryLog(ctx context.Context, address string) (DiscoveryLog, error) {
+	hostNQN, hostID, err := nvme.getNativeHostIdentity(ctx)
+	if err != nil {
+		return DiscoveryLog{}, err
+	}
+	client, err := nvmetcp.Dial(ctx, address, hostNQN, hostID)
+	if err != nil {
+		return DiscoveryLog{}, nativeError(ctx, err)
+	}
+	defer client.Close()
+
+	log, err := client.GetDiscoveryLog()
+	if err != nil {
+		return DiscoveryLog{}, nativeError(ctx, err)
+	}
+	logger.Debug(ctx, "discovery log of %s: %d records, generation counter %d", address, log.NumRec, log.GenCtr)
+
+	return newDiscoveryLog(log), nil
+}
+
+// nativeError returns the error of an exchange with a discovery controller, ErrTimeout when it
+// did not answer within nvmetcp.IOTimeout or before the deadline of ctx, ErrTargetUnreachable
+// when it could not be reached
+func nativeError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return contextError(ctx, err)
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		if kind := errnoKind(errno); kind != nil {
+			return fmt.Errorf("%w: %w", kind, err)
+		}
+	}
+	return err
+}
+
+// getNativeHostIdentity returns the configured host NQN and host ID,
+// generating the ones missing the way nvme-cli does
+func (nvme *NVMe) getNativeHostIdentity(ctx context.Context) (string, [16]byte, error) {
+	hostNQN, id := nvme.getHostIdentity(ctx)
+	hostID, err := parseUUID(id)
+	if err != nil {
+		if hostID, err = newUUID(); err != nil {
+			return "", hostID, err
+		}
+	}
+	if hostNQN == "" {
+		hostNQN = fmt.Sprintf("nqn.2014-08.org.nvmexpress:uuid:%s", formatUUID(hostID))
+	}
+	return hostNQN, hostID, nil
+}
+
+// newDiscoveryLog converts a discovery log page into what nvme discover would print
+func newDiscoveryLog(page nvmetcp.DiscoveryLog) DiscoveryLog {
+	log := DiscoveryLog{GenCtr: page.GenCtr, NumRec: page.NumRec}
+	for _, e := range page.Entries {
+		entry := DiscoveryLogEntry{
+			TrType:  nvmetcp.TrTypeName(e.TrType),
+			AdrFam:  nvmetcp.AdrFamName(e.AdrFam),
+			SubType: nvmetcp.SubTypeName(e.SubType),
+			Treq:    nvmetcp.TreqName(e.Treq),
+			PortID:  e.PortID,
+			CntlID:  e.CntlID,
+			AsqSz:   e.AsqSz,
+			EFlags:  nvmetcp.EFlagsName(e.EFlags),
+			TrSvcID: e.TrSvcID,
+			SubNQN:  e.SubNQN,
+			TrAddr:  e.TrAddr,
+		}
+		if entry.TrSvcID == "" {
+			entry.TrSvcID = "none"
+		}
+		if e.TrType == nvmetcp.TrTypeTCP {
+			entry.SecType = nvmetcp.SecTypeName(e.SecType)
+		}
+		log.Entries = append(log.Entries, entry)
+	}
+	return log
+}
@@ -17,16 +17,21 @@
 package gonvme
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/netip"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"syscall"
+	"sync"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
 )
 
 const (
@@ -42,6 +47,9 @@ const (
 	// NVMePort - port number
 	NVMePort = "4420"
 
+	// NVMeDiscoveryPort is the well-known port of NVMe/TCP discovery controllers
+	NVMeDiscoveryPort = "8009"
+
 	// NVMEAlreadyConnected contains output holder for nvme connect
 	NVMEAlreadyConnected = "already connected"
 
@@ -53,18 +61,30 @@ const (
 // NVMe provides many nvme-specific functions
 type NVMe struct {
 	NVMeType
-	sessionParser NVMeSessionParser
+	runner         CommandRunner
+	openFabrics    func(path string) (io.ReadWriteCloser, error)
+	interfaceAddrs func(name string) ([]net.Addr, error)
+	eventSource    DiscoveryEventSource
+
+	capabilitiesMu sync.Mutex
+	capabilities   *Capabilities
 }
 
 // NewNVMe - returns a new NVMe client
-func NewNVMe(opts map[string]string) *NVMe {
+func NewNVMe(opts map[string]string, options ...Option) *NVMe {
 	nvme := NVMe{
 		NVMeType: NVMeType{
 			mock:    false,
 			options: opts,
 		},
 	}
-	nvme.sessionParser = &sessionParser{}
+	nvme.runner = NewExecCommandRunner(nvme.getChrootDirectory())
+	nvme.openFabrics = openFabricsDevice
+	nvme.interfaceAddrs = interfaceAddrs
+	nvme.eventSource = ueventSource{}
+	for _, option := range options {
+		option(&nvme)
+	}
 	return &nvme
 }
 
@@ -77,23 +97,28 @@ func (nvme *NVMe) getChrootDirectory() string {
 }
 
 func (nvme *NVMe) buildNVMeCommand(cmd []string) []string {
-	if nvme.getChrootDirectory() == "/" {
-		return cmd
+	return buildChrootCommand(nvme.getChrootDirectory(), cmd)
+}
+
+// runNVMeCommand runs cmd through the configured CommandRunner. A failure of the command is
+// returned as a CommandError.
+func (nvme *NVMe) runNVMeCommand(ctx context.Context, cmd []string) (CommandResult, error) {
+	result, err := nvme.runner.Run(ctx, cmd)
+	if err != nil && ctx.Err() == nil {
+		return result, newCommandError(cmd, result, err)
 	}
-	command := []string{"chroot", nvme.getChrootDirectory()}
-	command = append(command, cmd...)
-	return command
+	return result, contextError(ctx, redactError(err))
 }
 
-func (nvme *NVMe) getFCHostInfo() ([]FCHBAInfo, error) {
+func (nvme *NVMe) getFCHostInfo(ctx context.Context) ([]FCHBAInfo, error) {
 	match, err := filepath.Glob("/sys/class/fc_host/host*")
 	if err != nil {
-		log.Errorf("Error gathering fc hosts: %v", err)
+		logger.Error(ctx, "Error gathering fc hosts: %v", err)
 		return []FCHBAInfo{}, err
 	}
 	if len(match) == 0 {
-		log.Errorf("The fc_host path doesn't exist")
-		return []FCHBAInfo{}, err
+		logger.Error(ctx, "The fc_host path doesn't exist")
+		return []FCHBAInfo{}, ErrNoFCHosts
 	}
 
 	var FCHostsInfo []FCHBAInfo
@@ -103,7 +128,7 @@ func (nvme *NVMe) getFCHostInfo() ([]FCHBAInfo, error) {
 		portNamePath := path.Join(m, "port_name")
 		data, err := os.ReadFile(filepath.Clean(portNamePath))
 		if err != nil {
-			log.Errorf("match: %s failed to read port_name file: %s", match, err.Error())
+			logger.Error(ctx, "match: %s failed to read port_name file: %s", match, err.Error())
 			continue
 		}
 		FCHostInfo.PortName = strings.TrimSpace(string(data))
@@ -111,7 +136,7 @@ func (nvme *NVMe) getFCHostInfo() ([]FCHBAInfo, error) {
 		nodeNamePath := path.Join(m, "node_name")
 		data, err = os.ReadFile(filepath.Clean(nodeNamePath))
 		if err != nil {
-			log.Errorf("match: %s failed to read node_name file: %s", match, err.Error())
+			logger.Error(ctx, "match: %s failed to read node_name file: %s", match, err.Error())
 			continue
 		}
 		FCHostInfo.NodeName = strings.TrimSpace(string(data))
@@ -119,278 +144,193 @@ func (nvme *NVMe) getFCHostInfo() ([]FCHBAInfo, error) {
 	}
 
 	if len(FCHostsInfo) == 0 {
-		return []FCHBAInfo{}, err
+		return []FCHBAInfo{}, ErrNoFCHosts
 	}
 	return FCHostsInfo, nil
 }
 
 // DiscoverNVMeTCPTargets - runs nvme discovery and returns a list of NVMeTCP targets.
 func (nvme *NVMe) DiscoverNVMeTCPTargets(address string, login bool) ([]NVMeTarget, error) {
-	return nvme.discoverNVMeTCPTargets(address, login)
+	return nvme.DiscoverNVMeTCPTargetsWithContext(context.Background(), address, login)
 }
 
-func (nvme *NVMe) discoverNVMeTCPTargets(address string, login bool) ([]NVMeTarget, error) {
+// DiscoverNVMeTCPTargetsWithContext - runs nvme discovery bounded by ctx and returns a list of NVMeTCP targets.
+func (nvme *NVMe) DiscoverNVMeTCPTargetsWithContext(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.DiscoverNVMeTCPTargets")()
+	return nvme.discoverNVMeTCPTargets(ctx, address, login)
+}
+
+func (nvme *NVMe) discoverNVMeTCPTargets(ctx context.Context, address string, login bool) ([]NVMeTarget, error) {
+	host, ports := splitDiscoveryAddress(address, NVMeDiscoveryPort, NVMePort)
+	if nvme.options[DiscoveryBackend] == BackendNative {
+		if hostSecret, ctrlSecret := nvme.dhchapSecrets(NVMeTarget{}); hostSecret != "" || ctrlSecret != "" {
+			err := errors.New("the native discovery client does not support DH-HMAC-CHAP")
+			logger.Error(ctx, "Error discovering %s: %v", address, err)
+			return []NVMeTarget{}, err
+		}
+		var targets []NVMeTarget
+		var err error
+		for _, port := range ports {
+			targets, err = nvme.nativeDiscoverNVMeTCPTargets(ctx, net.JoinHostPort(host, port))
+			if !nextDiscoveryPort(ctx, err) {
+				break
+			}
+			logger.Debug(ctx, "discovery of %s on port %s failed: %v", host, port, err)
+		}
+		if err != nil {
+			logger.Error(ctx, "Error discovering %s: %v", address, err)
+			return []NVMeTarget{}, err
+		}
+		if login {
+			return targets, nvme.loginTargets(ctx, targets)
+		}
+		return targets, nil
+	}
+
 	// TODO: add injection check on address
 	// nvme discovery is done via nvme cli
 	// nvme discover -t tcp -a <NVMe interface IP> -s <port>
-	exe := nvme.buildNVMeCommand([]string{NVMeCommand, "discover", "-t", "tcp", "-a", address, "-s", NVMePort})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-
-	out, err := cmd.Output()
+	var log DiscoveryLog
+	var err error
+	for _, port := range ports {
+		log, err = nvme.runNVMeDiscover(ctx, []string{"-t", "tcp", "-a", host, "-s", port})
+		if !nextDiscoveryPort(ctx, err) {
+			break
+		}
+		logger.Debug(ctx, "discovery of %s on port %s failed: %v", host, port, err)
+	}
 	if err != nil {
-		log.Errorf("\nError discovering %s: %v", address, err)
+		logger.Error(ctx, "\nError discovering %s: %v", address, err)
 		return []NVMeTarget{}, err
 	}
+	targets := log.targets(NVMeTransportTypeTCP)
 
-	targets := make([]NVMeTarget, 0)
-	nvmeTarget := NVMeTarget{}
-	entryCount := 0
-	skipIteration := false
-
-	for _, line := range strings.Split(string(out), "\n") {
-		// Output should look like:
-
-		// Discovery Log Number of Records 2, Generation counter 2
-		// =====Discovery Log Entry 0======
-		// trtype:  fc
-		// adrfam:  fibre-channel
-		// subtype: nvme subsystem
-		// treq:    not specified
-		// portid:  0
-		// trsvcid: none
-		// subnqn:  nqn.1111-11.com.dell:powerstore:00:a1a1a1a111a1111a111a
-		// traddr:  nn-0x11aaa111a1111a11:aa-0x11aaa11111111a11
-		//
-		// =====Discovery Log Entry 1======
-		// trtype:  tcp
-		// adrfam:  ipv4
-		// subtype: nvme subsystem
-		// treq:    not specified
-		// portid:  2304
-		// trsvcid: 4420
-		// subnqn:  nqn.1111-11.com.dell:powerstore:00:a1a1a1a111a1111a111a
-		// traddr:  1.1.1.1
-		// sectype: none
-
-		tokens := strings.Fields(line)
-		if len(tokens) < 2 {
-			continue
-		}
-		key := tokens[0]
-		value := strings.Join(tokens[1:], " ")
-		switch key {
-
-		case "=====Discovery":
-			// add to array
-			if entryCount != 0 && !skipIteration {
-				targets = append(targets, nvmeTarget)
-			}
-			nvmeTarget = NVMeTarget{}
-			skipIteration = false
-			entryCount++
-			continue
-
-		case "trtype:":
-			nvmeTarget.TargetType = value
-			if value != NVMeTransportTypeTCP {
-				skipIteration = true
-			}
-			break
-
-		case "traddr:":
-			nvmeTarget.Portal = value
-			break
-
-		case "subnqn:":
-			nvmeTarget.TargetNqn = value
-			break
-
-		case "adrfam:":
-			nvmeTarget.AdrFam = value
-			break
-
-		case "subtype:":
-			nvmeTarget.SubType = value
-			break
-
-		case "treq:":
-			nvmeTarget.Treq = value
-			break
+	// log into the targets if asked
+	if login {
+		return targets, nvme.loginTargets(ctx, targets)
+	}
 
-		case "portid:":
-			nvmeTarget.PortID = value
-			break
+	return targets, nil
+}
 
-		case "trsvcid:":
-			nvmeTarget.TrsvcID = value
-			break
+// splitDiscoveryAddress splits a discovery address, an IP address or host name optionally
+// followed by a port, with IPv6 addresses in brackets when they carry one, into the host
+// and the ports to try in order: the given port, or defaultPorts if there is none
+func splitDiscoveryAddress(address string, defaultPorts ...string) (string, []string) {
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		return host, []string{port}
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), defaultPorts
+}
 
-		case "sectype:":
-			nvmeTarget.SecType = value
-			break
+// nextDiscoveryPort reports whether a discovery failing with err on a port of a discovery
+// controller goes on with its next port, which only helps when the port could not be reached
+func nextDiscoveryPort(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() == nil && errors.Is(err, ErrTargetUnreachable)
+}
 
-		default:
+// targetServiceID returns the port of target, NVMePort if discovery did not report one
+func targetServiceID(target NVMeTarget) string {
+	if _, err := strconv.ParseUint(target.TrsvcID, 10, 16); err != nil {
+		return NVMePort
+	}
+	return target.TrsvcID
+}
 
+// targetAddress returns the address and port to connect to target at. Portal is an IPv4
+// or IPv6 address, the latter with an optional zone ID, which may be in brackets or
+// followed by a port in the form GetSessions reports. A port of the target takes precedence.
+func targetAddress(target NVMeTarget) (string, string, error) {
+	host, port := target.Portal, targetServiceID(target)
+	if h, p, err := net.SplitHostPort(target.Portal); err == nil {
+		host = h
+		if port != target.TrsvcID {
+			port = p
 		}
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
 	}
-	if !skipIteration && nvmeTarget.TargetNqn != "" {
-		targets = append(targets, nvmeTarget)
-	}
-
-	// TODO: Add optional login
-	// log into the target if asked
-	if login {
-		for _, t := range targets {
-			err = nvme.NVMeTCPConnect(t, false)
-			if err != nil {
-				log.Errorf("Error during NVMeTCP connect")
-			}
+	if strings.Contains(host, ":") {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return "", "", fmt.Errorf("invalid IPv6 address %q: %w", target.Portal, err)
 		}
 	}
+	return host, port, nil
+}
 
-	return targets, nil
+// loginTargets connects to discovered targets and returns an error joining those of the
+// targets which failed to connect
+func (nvme *NVMe) loginTargets(ctx context.Context, targets []NVMeTarget) error {
+	_, err := connectAll(ctx, targets, ConnectAllOptions{}, nvme.connectTarget)
+	if err != nil {
+		logger.Error(ctx, "Error logging into discovered targets: %v", err)
+	}
+	return err
 }
 
 // DiscoverNVMeFCTargets - runs nvme discovery and returns a list of NVMeFC targets.
 func (nvme *NVMe) DiscoverNVMeFCTargets(targetAddress string, login bool) ([]NVMeTarget, error) {
-	return nvme.discoverNVMeFCTargets(targetAddress, login)
+	return nvme.DiscoverNVMeFCTargetsWithContext(context.Background(), targetAddress, login)
 }
 
-func (nvme *NVMe) discoverNVMeFCTargets(targetAddress string, login bool) ([]NVMeTarget, error) {
+// DiscoverNVMeFCTargetsWithContext - runs nvme discovery bounded by ctx and returns a list of NVMeFC targets.
+func (nvme *NVMe) DiscoverNVMeFCTargetsWithContext(ctx context.Context, targetAddress string, login bool) ([]NVMeTarget, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.DiscoverNVMeFCTargets")()
+	return nvme.discoverNVMeFCTargets(ctx, targetAddress, login)
+}
+
+func (nvme *NVMe) discoverNVMeFCTargets(ctx context.Context, targetAddress string, login bool) ([]NVMeTarget, error) {
 	// TODO: add injection check on address
 	// nvme discovery is done via nvme cli
 	// nvme discover -t fc -a traddr -w host_traddr
 	// where traddr = nn-<Target_WWNN>:pn-<Target_WWPN> and host_traddr = nn-<Initiator_WWNN>:pn-<Initiator_WWPN>
 
-	var out []byte
-	FCHostsInfo, err := nvme.getFCHostInfo()
+	FCHostsInfo, err := nvme.getFCHostInfo(ctx)
 	if err != nil || len(FCHostsInfo) == 0 {
-		log.Errorf("Error gathering NVMe/FC Hosts on the host side: %v", err)
+		logger.Error(ctx, "Error gathering NVMe/FC Hosts on the host side: %v", err)
 		return []NVMeTarget{}, err
 	}
 
 	targets := make([]NVMeTarget, 0)
+	var errs []error
 	for _, FCHostInfo := range FCHostsInfo {
 
 		// host_traddr = nn-<Initiator_WWNN>:pn-<Initiator_WWPN>
 		initiatorAddress := strings.Replace(fmt.Sprintf("nn-%s:pn-%s", FCHostInfo.NodeName, FCHostInfo.PortName), "\n", "", -1)
-		exe := nvme.buildNVMeCommand([]string{NVMeCommand, "discover", "-t", "fc", "-a", targetAddress, "-w", initiatorAddress})
-		cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-
-		out, err = cmd.Output()
+		var log DiscoveryLog
+		log, err = nvme.runNVMeDiscover(ctx, []string{"-t", "fc", "-a", targetAddress, "-w", initiatorAddress})
 		if err != nil {
+			if ctx.Err() != nil {
+				return []NVMeTarget{}, err
+			}
+			logger.Debug(ctx, "discovery of %s through %s failed: %v", targetAddress, initiatorAddress, err)
+			errs = append(errs, fmt.Errorf("discover through %s: %w", initiatorAddress, err))
 			continue
 		}
 
-		nvmeTarget := NVMeTarget{}
-		entryCount := 0
-		skipIteration := false
-
-		for _, line := range strings.Split(string(out), "\n") {
-
-			// Output should look like:
-
-			// Discovery Log Number of Records 2, Generation counter 2
-			// =====Discovery Log Entry 0======
-			// trtype:  fc
-			// adrfam:  fibre-channel
-			// subtype: nvme subsystem
-			// treq:    not specified
-			// portid:  0
-			// trsvcid: none
-			// subnqn:  nqn.1111-11.com.dell:powerstore:00:a1a1a1a111a1111a111a
-			// traddr:  nn-0x11aaa111a1111a11:aa-0x11aaa11111111a11
-			//
-			// =====Discovery Log Entry 1======
-			// trtype:  tcp
-			// adrfam:  ipv4
-			// subtype: nvme subsystem
-			// treq:    not specified
-			// portid:  2304
-			// trsvcid: 4420
-			// subnqn:  nqn.1111-11.com.dell:powerstore:00:a1a1a1a111a1111a111a
-			// traddr:  1.1.1.1
-			// sectype: none
-
-			tokens := strings.Fields(line)
-			if len(tokens) < 2 {
-				continue
-			}
-			key := tokens[0]
-			value := strings.Join(tokens[1:], "")
-			switch key {
-
-			case "=====Discovery":
-				// add to array
-				if entryCount != 0 && !skipIteration && nvmeTarget.Portal == targetAddress {
-					targets = append(targets, nvmeTarget)
-				}
-				nvmeTarget = NVMeTarget{}
-				nvmeTarget.HostAdr = initiatorAddress
-				skipIteration = false
-				entryCount++
+		for _, target := range log.targets(NVMeTransportTypeFC) {
+			if target.Portal != targetAddress {
 				continue
-
-			case "trtype:":
-				nvmeTarget.TargetType = value
-				if value != NVMeTransportTypeFC {
-					skipIteration = true
-				}
-				break
-
-			case "traddr:":
-				nvmeTarget.Portal = value
-				break
-
-			case "subnqn:":
-				nvmeTarget.TargetNqn = value
-				break
-
-			case "adrfam:":
-				nvmeTarget.AdrFam = value
-				break
-
-			case "subtype:":
-				nvmeTarget.SubType = value
-				break
-
-			case "treq:":
-				nvmeTarget.Treq = value
-				break
-
-			case "portid:":
-				nvmeTarget.PortID = value
-				break
-
-			case "trsvcid:":
-				nvmeTarget.TrsvcID = value
-				break
-
-			case "sectype:":
-				nvmeTarget.SecType = value
-				break
-
 			}
-		}
-		if !skipIteration && nvmeTarget.TargetNqn != "" && nvmeTarget.Portal == targetAddress {
-			targets = append(targets, nvmeTarget)
+			target.HostAdr = initiatorAddress
+			targets = append(targets, target)
 		}
 	}
 
 	if len(targets) == 0 {
-		log.Errorf("Error discovering NVMe/FC targets: %v", err)
-		return []NVMeTarget{}, err
+		if len(errs) > 0 {
+			err = errors.Join(errs...)
+			logger.Error(ctx, "Error discovering NVMe/FC targets: %v", err)
+			return []NVMeTarget{}, err
+		}
+		// the discovery controller reached through the FC hosts does not know targetAddress
+		logger.Info(ctx, "no NVMe/FC targets found at %s", targetAddress)
+		return []NVMeTarget{}, nil
 	}
 
-	// TODO: Add optional login
-	// log into the target if asked
+	// log into the targets if asked
 	if login {
-		for _, t := range targets {
-			err = nvme.NVMeFCConnect(t, false)
-			if err != nil {
-				log.Errorf("Error during NVMeFC connect")
-			}
-		}
+		return targets, nvme.loginTargets(ctx, targets)
 	}
 
 	return targets, nil
@@ -398,10 +338,19 @@ func (nvme *NVMe) discoverNVMeFCTargets(targetAddress string, login bool) ([]NVM
 
 // GetInitiators returns a list of initiators on the local system.
 func (nvme *NVMe) GetInitiators(filename string) ([]string, error) {
-	return nvme.getInitiators(filename)
+	return nvme.GetInitiatorsWithContext(context.Background(), filename)
+}
+
+// GetInitiatorsWithContext returns a list of initiators on the local system.
+func (nvme *NVMe) GetInitiatorsWithContext(ctx context.Context, filename string) ([]string, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetInitiators")()
+	if err := ctx.Err(); err != nil {
+		return []string{}, contextError(ctx, err)
+	}
+	return nvme.getInitiators(ctx, filename)
 }
 
-func (nvme *NVMe) getInitiators(filename string) ([]string, error) {
+func (nvme *NVMe) getInitiators(ctx context.Context, filename string) ([]string, error) {
 	// a slice of filename, which might exist and define the nvme initiators
 	initiatorConfig := []string{}
 	nqns := []string{}
@@ -427,18 +376,15 @@ func (nvme *NVMe) getInitiators(filename string) ([]string, error) {
 			continue
 		}
 
-		// get the contents of the initiator config file
-		out, err := os.ReadFile(filepath.Clean(init))
+		// get the contents of the initiator config file, each NQN once
+		names, duplicates, err := readHostNQNs(init)
 		if err != nil {
-			log.Errorf("Error gathering initiator names: %v", err)
+			logger.Error(ctx, "Error gathering initiator names: %v", err)
 		}
-		lines := strings.Split(string(out), "\n")
-
-		for _, line := range lines {
-			if line != "" {
-				nqns = append(nqns, line)
-			}
+		if len(duplicates) > 0 {
+			logger.Info(ctx, "%s holds the initiator names %v more than once", init, duplicates)
 		}
+		nqns = append(nqns, names...)
 	}
 
 	if len(nqns) == 0 {
@@ -450,157 +396,195 @@ func (nvme *NVMe) getInitiators(filename string) ([]string, error) {
 
 // NVMeTCPConnect will attempt to connect into a given NVMeTCP target
 func (nvme *NVMe) NVMeTCPConnect(target NVMeTarget, duplicateConnect bool) error {
-	return nvme.nvmeTCPConnect(target, duplicateConnect)
+	return nvme.NVMeTCPConnectWithContext(context.Background(), target, duplicateConnect)
+}
+
+// NVMeTCPConnectWithContext will attempt to connect into a given NVMeTCP target, giving up when ctx is done
+func (nvme *NVMe) NVMeTCPConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	defer tracer.TraceFuncCall(ctx, "gonvme.NVMeTCPConnect")()
+	return nvme.nvmeTCPConnect(ctx, target, duplicateConnect)
+}
+
+func (nvme *NVMe) nvmeTCPConnect(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	_, err := nvme.nvmeTCPConnectWithOptions(ctx, target, ConnectOptions{DuplicateConnect: duplicateConnect})
+	return err
 }
 
-func (nvme *NVMe) nvmeTCPConnect(target NVMeTarget, duplicateConnect bool) error {
+// NVMeTCPConnectWithOptions will attempt to connect into a given NVMeTCP target with the given
+// controller settings, giving up when ctx is done
+func (nvme *NVMe) NVMeTCPConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.NVMeTCPConnectWithOptions")()
+	return nvme.nvmeTCPConnectWithOptions(ctx, target, options)
+}
+
+func (nvme *NVMe) nvmeTCPConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	options, err := resolveConnectOptions(nvme.options, NVMeTransportTypeTCP, options)
+	if err != nil {
+		logger.Error(ctx, "Error during NVMe/TCP connect %s: %v", target.TargetNqn, err)
+		return ConnectResult{}, err
+	}
+	if options.HostTraddr == "" {
+		options.HostTraddr = target.HostAdr
+	}
+	target.HostAdr = options.HostTraddr
+	result := ConnectResult{Options: options}
+	if nvme.options[ConnectBackend] == BackendFabrics {
+		result.AlreadyConnected, err = nvme.fabricsConnect(ctx, NVMeTransportTypeTCP, target, options)
+		return result, err
+	}
 	// nvme connect is done via the nvme cli
-	// nvme connect -t tcp -n <target NQN> -a <NVMe interface IP> -s 4420
+	// nvme connect -t tcp -n <target NQN> -a <NVMe interface IP> -s <target port> [-w <host IP>]
 	// D allows duplicate connections between same transport host and subsystem port
-	var exe []string
-	if duplicateConnect {
-		exe = nvme.buildNVMeCommand([]string{NVMeCommand, "connect", "-t", "tcp", "-n", target.TargetNqn, "-a", target.Portal, "-s", NVMePort, "--ctrl-loss-tmo=-1", "-D"})
-	} else {
-		exe = nvme.buildNVMeCommand([]string{NVMeCommand, "connect", "-t", "tcp", "-n", target.TargetNqn, "-a", target.Portal, "-s", NVMePort, "--ctrl-loss-tmo=-1"})
-	}
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-	var Output string
-	stderr, _ := cmd.StderrPipe()
-	err := cmd.Start()
-
-	scanner := bufio.NewScanner(stderr)
-	for scanner.Scan() {
-		Output = scanner.Text()
+	address, port, err := targetAddress(target)
+	if err != nil {
+		logger.Error(ctx, "Error during NVMe/TCP connect %s: %v", target.TargetNqn, err)
+		return ConnectResult{}, err
 	}
-	log.Debugf("connect output: %s", Output)
-	err = cmd.Wait()
-
+	tls, err := nvme.tlsArgs(ctx, target)
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			// nvme connect exited with an exit code != 0
-			nvmeConnectResult := -1
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				nvmeConnectResult = status.ExitStatus()
-			}
-			if nvmeConnectResult == 114 || nvmeConnectResult == 70 {
-				// session already exists
-				// do not treat this as a failure
-				// this is applicable if nvme cli version 1.16 or below
-				if Output == "Failed to write to /dev/nvme-fabrics: Operation already in progress" || Output == "" {
-					log.Infof("NVMe connection already exists\n")
-					err = nil
-				} else {
-					log.Errorf("\nError during nvme connect %s at %s: %v", target.TargetNqn, target.Portal, err)
-					return err
-				}
-			} else if nvmeConnectResult == 1 && strings.Contains(Output, NVMEAlreadyConnected) {
-				// session already exists
-				// this is applicable if nvme cli version is 2.0 and above
-				log.Infof("NVMe connection already exists\n")
-				err = nil
-			} else {
-				log.Errorf("\nnvme connect failure: %v, %s", err, err.Error())
-			}
-		} else {
-			log.Errorf("\nError during nvme connect %s at %s: %v", target.TargetNqn, target.Portal, err)
-		}
-
-		if err != nil {
-			log.Errorf("\nError during nvme connect %s at %s: %v", target.TargetNqn, target.Portal, err)
-			return err
-		}
-	} else {
-		log.Infof("\nnvme connect successful: %s", target.TargetNqn)
+		logger.Error(ctx, "Error during NVMe/TCP connect %s: %v", target.TargetNqn, err)
+		return ConnectResult{}, err
 	}
-
-	return nil
+	exe := []string{NVMeCommand, "connect", "-t", "tcp", "-n", target.TargetNqn, "-a", address, "-s", port}
+	if target.HostAdr != "" {
+		exe = append(exe, "-w", target.HostAdr)
+	}
+	exe = append(append(exe, options.args()...), tls...)
+	result.AlreadyConnected, err = nvme.runNVMeConnect(ctx, "NVMe/TCP", target, exe)
+	return result, err
 }
 
 // NVMeFCConnect will attempt to connect into a given NVMeFC target
 func (nvme *NVMe) NVMeFCConnect(target NVMeTarget, duplicateConnect bool) error {
-	return nvme.nvmeFCConnect(target, duplicateConnect)
+	return nvme.NVMeFCConnectWithContext(context.Background(), target, duplicateConnect)
+}
+
+// NVMeFCConnectWithContext will attempt to connect into a given NVMeFC target, giving up when ctx is done
+func (nvme *NVMe) NVMeFCConnectWithContext(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	defer tracer.TraceFuncCall(ctx, "gonvme.NVMeFCConnect")()
+	return nvme.nvmeFCConnect(ctx, target, duplicateConnect)
+}
+
+func (nvme *NVMe) nvmeFCConnect(ctx context.Context, target NVMeTarget, duplicateConnect bool) error {
+	_, err := nvme.nvmeFCConnectWithOptions(ctx, target, ConnectOptions{DuplicateConnect: duplicateConnect})
+	return err
 }
 
-func (nvme *NVMe) nvmeFCConnect(target NVMeTarget, duplicateConnect bool) error {
+// NVMeFCConnectWithOptions will attempt to connect into a given NVMeFC target with the given
+// controller settings, giving up when ctx is done
+func (nvme *NVMe) NVMeFCConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.NVMeFCConnectWithOptions")()
+	return nvme.nvmeFCConnectWithOptions(ctx, target, options)
+}
+
+func (nvme *NVMe) nvmeFCConnectWithOptions(ctx context.Context, target NVMeTarget, options ConnectOptions) (ConnectResult, error) {
+	options, err := resolveConnectOptions(nvme.options, NVMeTransportTypeFC, options)
+	if err != nil {
+		logger.Error(ctx, "Error during NVMe/FC connect %s: %v", target.TargetNqn, err)
+		return ConnectResult{}, err
+	}
+	if options.HostTraddr == "" {
+		options.HostTraddr = target.HostAdr
+	}
+	target.HostAdr = options.HostTraddr
+	result := ConnectResult{Options: options}
+	if nvme.options[ConnectBackend] == BackendFabrics {
+		result.AlreadyConnected, err = nvme.fabricsConnect(ctx, NVMeTransportTypeFC, target, options)
+		return result, err
+	}
 	// nvme connect is done via the nvme cli
 	// nvme connect -t fc -a traddr -w host_traddr -n target_nqn
 	// where traddr = nn-<Target_WWNN>:pn-<Target_WWPN> and host_traddr = nn-<Initiator_WWNN>:pn-<Initiator_WWPN>
 	// D allows duplicate connections between same transport host and subsystem port
-	var exe []string
-	if duplicateConnect {
-		exe = nvme.buildNVMeCommand([]string{NVMeCommand, "connect", "-t", "fc", "-a", target.Portal, "-w", target.HostAdr, "-n", target.TargetNqn, "--ctrl-loss-tmo=-1", "-D"})
-	} else {
-		exe = nvme.buildNVMeCommand([]string{NVMeCommand, "connect", "-t", "fc", "-a", target.Portal, "-w", target.HostAdr, "-n", target.TargetNqn, "--ctrl-loss-tmo=-1"})
-	}
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-	var Output string
-	stderr, _ := cmd.StderrPipe()
-	err := cmd.Start()
+	exe := []string{NVMeCommand, "connect", "-t", "fc", "-a", target.Portal, "-w", target.HostAdr, "-n", target.TargetNqn}
+	result.AlreadyConnected, err = nvme.runNVMeConnect(ctx, "NVMe/FC", target, append(exe, options.args()...))
+	return result, err
+}
 
-	scanner := bufio.NewScanner(stderr)
-	for scanner.Scan() {
-		Output = scanner.Text()
+// runNVMeConnect runs the nvme connect command exe for target and reports whether the
+// connection already existed, which is not treated as a failure.
+func (nvme *NVMe) runNVMeConnect(ctx context.Context, transport string, target NVMeTarget, exe []string) (bool, error) {
+	auth, err := nvme.dhchapArgs(ctx, target)
+	if err != nil {
+		logger.Error(ctx, "Error during %s connect %s at %s: %v", transport, target.TargetNqn, target.Portal, err)
+		return false, err
+	}
+	result, err := nvme.runNVMeCommand(ctx, append(exe, auth...))
+	Output := RedactSecrets(lastLine(result.Stderr))
+	logger.Debug(ctx, "connect output: %s", Output)
+	if ctx.Err() != nil && err != nil {
+		logger.Error(ctx, "Error during %s connect %s at %s: %v", transport, target.TargetNqn, target.Portal, err)
+		return false, err
 	}
-	err = cmd.Wait()
 
+	alreadyConnected := false
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
+		// nvme-cli 1.x and 2.x report an existing connection differently,
+		// both are checked when the version is not known
+		capabilities, capErr := nvme.getCapabilities(ctx)
+		legacy := capErr != nil || !capabilities.Version.AtLeast(2, 0)
+		current := capErr != nil || capabilities.Version.AtLeast(2, 0)
+		if result.ExitCode > 0 {
 			// nvme connect exited with an exit code != 0
-			nvmeConnectResult := -1
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				nvmeConnectResult = status.ExitStatus()
-			}
-			if nvmeConnectResult == 114 || nvmeConnectResult == 70 {
+			nvmeConnectResult := result.ExitCode
+			if legacy && (nvmeConnectResult == 114 || nvmeConnectResult == 70) {
 				// session already exists
 				// do not treat this as a failure
 				// this is applicable if nvme cli version 1.16 or below
 				if Output == "Failed to write to /dev/nvme-fabrics: Operation already in progress" || Output == "" {
-					log.Infof("NVMe connection already exists\n")
-					err = nil
+					logger.Info(ctx, "NVMe connection already exists\n")
+					alreadyConnected, err = true, nil
 				} else {
-					log.Errorf("\nError during nvme connect %s at %s: %v", target.TargetNqn, target.Portal, err)
-					return err
+					logger.Error(ctx, "\nError during %s connect %s at %s: %v", transport, target.TargetNqn, target.Portal, err)
+					return false, err
 				}
-			} else if nvmeConnectResult == 1 && strings.Contains(Output, NVMEAlreadyConnected) {
+			} else if current && nvmeConnectResult == 1 && strings.Contains(Output, NVMEAlreadyConnected) {
 				// session already exists
 				// this is applicable if nvme cli version is 2.0 and above
-				log.Infof("NVMe connection already exists\n")
-				err = nil
+				logger.Info(ctx, "NVMe connection already exists\n")
+				alreadyConnected, err = true, nil
 			} else {
-				log.Errorf("NVMe/FC connect failure: %v", err)
+				logger.Error(ctx, "%s connect failure: %v", transport, err)
 			}
-		} else {
-			log.Errorf("Error during NVMe/FC connect %s at %s for %s host: %v", target.TargetNqn, target.Portal, target.HostAdr, err)
 		}
 
+		if err != nil && len(auth) > 0 && isAuthFailure(Output) {
+			err = withKind(err, ErrAuthFailed)
+		}
 		if err != nil {
-			log.Errorf("Error during NVMe/FC connect %s at %s for %s host: %v", target.TargetNqn, target.Portal, target.HostAdr, err)
-			return err
+			logger.Error(ctx, "Error during %s connect %s at %s for %s host: %v", transport, target.TargetNqn, target.Portal, target.HostAdr, err)
+			return false, err
 		}
 	} else {
-		log.Infof("NVMe/FC connect successful: %s", target.TargetNqn)
+		logger.Info(ctx, "%s connect successful: %s", transport, target.TargetNqn)
 	}
 
-	return nil
+	return alreadyConnected, nil
 }
 
 // NVMeDisconnect will attempt to disconnect from a given nvme target
 func (nvme *NVMe) NVMeDisconnect(target NVMeTarget) error {
-	return nvme.nvmeDisconnect(target)
+	return nvme.NVMeDisconnectWithContext(context.Background(), target)
+}
+
+// NVMeDisconnectWithContext will attempt to disconnect from a given nvme target, giving up when ctx is done
+func (nvme *NVMe) NVMeDisconnectWithContext(ctx context.Context, target NVMeTarget) error {
+	defer tracer.TraceFuncCall(ctx, "gonvme.NVMeDisconnect")()
+	return nvme.nvmeDisconnect(ctx, target)
 }
 
-func (nvme *NVMe) nvmeDisconnect(target NVMeTarget) error {
+func (nvme *NVMe) nvmeDisconnect(ctx context.Context, target NVMeTarget) error {
+	if nvme.options[ConnectBackend] == BackendFabrics {
+		return nvme.fabricsDisconnect(ctx, target)
+	}
 	// nvme disconnect is done via the nvme cli
 	// nvme disconnect -n <target NQN>
-	exe := nvme.buildNVMeCommand([]string{NVMeCommand, "disconnect", "-n", target.TargetNqn})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-
-	_, err := cmd.Output()
+	_, err := nvme.runNVMeCommand(ctx, []string{NVMeCommand, "disconnect", "-n", target.TargetNqn})
 
 	if err != nil {
-		log.Errorf("\nError during NVMe disconnect %s at %s: %v", target.TargetNqn, target.Portal, err)
+		logger.Error(ctx, "\nError during NVMe disconnect %s at %s: %v", target.TargetNqn, target.Portal, err)
 	} else {
-		log.Infof("\nnvme disconnect successful: %s", target.TargetNqn)
+		logger.Info(ctx, "\nnvme disconnect successful: %s", target.TargetNqn)
 	}
 
 	return err
@@ -608,13 +592,22 @@ func (nvme *NVMe) nvmeDisconnect(target NVMeTarget) error {
 
 // ListNVMeDeviceAndNamespace returns the NVME Device Paths and Namespace of each of the NVME device
 func (nvme *NVMe) ListNVMeDeviceAndNamespace() ([]DevicePathAndNamespace, error) {
+	return nvme.ListNVMeDeviceAndNamespaceWithContext(context.Background())
+}
+
+// ListNVMeDeviceAndNamespaceWithContext returns the NVME Device Paths and Namespace of each of the NVME device
+func (nvme *NVMe) ListNVMeDeviceAndNamespaceWithContext(ctx context.Context) ([]DevicePathAndNamespace, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.ListNVMeDeviceAndNamespace")()
 	/* ListNVMeDeviceAndNamespace Output
 	{/dev/nvme0n1 54}
 	{/dev/nvme0n2 55}
 	{/dev/nvme1n1 54}
 	{/dev/nvme1n2 55}
 	*/
-	exe := nvme.buildNVMeCommand([]string{"nvme", "list", "-o", "json"})
+	if err := nvme.requireCapability(ctx, FeatureListJSON); err != nil {
+		return []DevicePathAndNamespace{}, err
+	}
+	exe := []string{"nvme", "list", "-o", "json"}
 
 	/* nvme list -o json
 	{
@@ -646,14 +639,12 @@ func (nvme *NVMe) ListNVMeDeviceAndNamespace() ([]DevicePathAndNamespace, error)
 	  ]
 	}
 	*/
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-
-	output, err := cmd.Output()
+	output, err := nvme.runNVMeCommand(ctx, exe)
 	if err != nil {
 		return []DevicePathAndNamespace{}, err
 	}
 
-	str := string(output)
+	str := string(output.Stdout)
 	lines := strings.Split(str, "\n")
 
 	var result []DevicePathAndNamespace
@@ -695,6 +686,13 @@ func (nvme *NVMe) ListNVMeDeviceAndNamespace() ([]DevicePathAndNamespace, error)
 
 // ListNVMeNamespaceID returns the namespace IDs for each NVME device path
 func (nvme *NVMe) ListNVMeNamespaceID(NVMeDeviceAndNamespace []DevicePathAndNamespace) (map[DevicePathAndNamespace][]string, error) {
+	return nvme.ListNVMeNamespaceIDWithContext(context.Background(), NVMeDeviceAndNamespace)
+}
+
+// ListNVMeNamespaceIDWithContext returns the namespace IDs for each NVME device path. The
+// devices whose namespaces cannot be listed are left out, and their errors joined.
+func (nvme *NVMe) ListNVMeNamespaceIDWithContext(ctx context.Context, NVMeDeviceAndNamespace []DevicePathAndNamespace) (map[DevicePathAndNamespace][]string, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.ListNVMeNamespaceID")()
 	/* ListNVMeNamespaceID Output
 	{devicePath namespace} [namespaceId1 namespaceId2]
 	{/dev/nvme0n1 54} [0x36 0x37]
@@ -704,23 +702,26 @@ func (nvme *NVMe) ListNVMeNamespaceID(NVMeDeviceAndNamespace []DevicePathAndName
 	*/
 	namespaceIDs := make(map[DevicePathAndNamespace][]string)
 
-	var err error
+	var errs []error
 	for _, devicePathAndNamespace := range NVMeDeviceAndNamespace {
 
 		devicePath := devicePathAndNamespace.DevicePath
 
-		exe := nvme.buildNVMeCommand([]string{"nvme", "list-ns", devicePath})
+		exe := []string{"nvme", "list-ns", devicePath}
 		/* nvme list-ns /dev/nvme0n1
 		[   0]:0x2401
 		[   1]:0x2406
 		*/
-		cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-		output, err := cmd.Output()
-		if err != nil {
+		result, runErr := nvme.runNVMeCommand(ctx, exe)
+		if runErr != nil {
+			if ctx.Err() != nil {
+				return map[DevicePathAndNamespace][]string{}, runErr
+			}
+			errs = append(errs, runErr)
 			continue
 		}
 
-		str := string(output)
+		str := string(result.Stdout)
 		lines := strings.Split(str, "\n")
 
 		var namespaceDevice []string
@@ -736,111 +737,61 @@ func (nvme *NVMe) ListNVMeNamespaceID(NVMeDeviceAndNamespace []DevicePathAndName
 		namespaceIDs[devicePathAndNamespace] = namespaceDevice
 	}
 
-	if len(namespaceIDs) == 0 {
-		return map[DevicePathAndNamespace][]string{}, err
-	}
-
-	return namespaceIDs, nil
+	return namespaceIDs, errors.Join(errs...)
 }
 
 // GetNVMeDeviceData returns the information (nguid and namespace) of an NVME device path
 func (nvme *NVMe) GetNVMeDeviceData(path string) (string, string, error) {
-	var nguid string
-	var namespace string
-
-	exe := nvme.buildNVMeCommand([]string{"nvme", "id-ns", path})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-
-	/*
-		nvme id-ns /dev/nvme3n1 0x95
-		NVME Identify Namespace 149:
-		nsze    : 0x1000000
-		ncap    : 0x1000000
-		nuse    : 0x223b8
-		nsfeat  : 0xb
-		nlbaf   : 0
-		flbas   : 0
-		mc      : 0
-		dpc     : 0
-		dps     : 0
-		nmic    : 0x1
-		rescap  : 0xff
-		fpi     : 0
-		dlfeat  : 9
-		nawun   : 2047
-		nawupf  : 2047
-		nacwu   : 0
-		nabsn   : 2047
-		nabo    : 0
-		nabspf  : 2047
-		noiob   : 0
-		nvmcap  : 0
-		mssrl   : 0
-		mcl     : 0
-		msrc    : 0
-		anagrpid: 2
-		nsattr  : 0
-		nvmsetid: 0
-		endgid  : 0
-		nguid   : 507911ecda65a2498ccf0968009a5d07
-		eui64   : 0000000000000000
-		lbaf  0 : ms:0   lbads:9  rp:0 (in use)
-	*/
+	return nvme.GetNVMeDeviceDataWithContext(context.Background(), path)
+}
 
-	output, err := cmd.Output()
+// GetNVMeDeviceDataWithContext returns the information (nguid and namespace) of an NVME device path
+func (nvme *NVMe) GetNVMeDeviceDataWithContext(ctx context.Context, path string) (string, string, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetNVMeDeviceData")()
+	// the text output of nvme id-ns names the namespace in its header, see parseIDNamespaceText
+	result, err := nvme.runNVMeCommand(ctx, []string{"nvme", "id-ns", path})
 	if err != nil {
 		return "", "", err
 	}
-	str := string(output)
-	lines := strings.Split(str, "\n")
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "nguid") {
-			if len(strings.Split(line, ":")) >= 2 {
-				nguid = strings.TrimSpace(strings.Split(line, ":")[1])
-			}
-		}
-		if strings.HasPrefix(line, "NVME Identify Namespace") {
-			if len(strings.Fields(line)) >= 4 {
-				namespace = strings.ReplaceAll(strings.TrimSpace(strings.Fields(line)[3]), ":", "")
-			}
-		}
-
-		if nguid != "" && namespace != "" {
-			return nguid, namespace, nil
-		}
-	}
-	return nguid, namespace, err
+	id, nsid := parseIDNamespaceText(result.Stdout)
+	return id.NGUID, namespaceIDString(nsid), nil
 }
 
 // GetSessions queries information about  NVMe sessions
 func (nvme *NVMe) GetSessions() ([]NVMESession, error) {
-	exe := nvme.buildNVMeCommand([]string{"nvme", "list-subsys", "-o", "json"})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-	output, err := cmd.Output()
+	return nvme.GetSessionsWithContext(context.Background())
+}
+
+// GetSessionsWithContext queries information about NVMe sessions, giving up when ctx is done
+func (nvme *NVMe) GetSessionsWithContext(ctx context.Context) ([]NVMESession, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetSessions")()
+	if nvme.options[SessionsBackend] == BackendSysfs {
+		return nvme.getSysfsSessions(ctx)
+	}
+	result, err := nvme.runNVMeCommand(ctx, []string{"nvme", "list-subsys", "-o", "json"})
 	if err != nil {
-		if isNoObjsExitCode(err) {
+		if errors.Is(err, ErrNoObjectsFound) {
 			return []NVMESession{}, nil
 		}
 		return []NVMESession{}, err
 	}
-	return nvme.sessionParser.Parse(output), nil
-}
-
-func isNoObjsExitCode(err error) bool {
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			return exitError.ExitCode() == NVMeNoObjsFoundExitCode
-		}
+	// the output format follows the nvme-cli version, both are accepted when it is not known
+	parser := &sessionParser{}
+	if capabilities, capErr := nvme.getCapabilities(ctx); capErr == nil {
+		parser.v2 = capabilities.ListSubsysJSONV2
 	}
-	return false
+	return parser.Parse(result.Stdout), nil
 }
 
 // DeviceRescan rescan the NVMe controller device
 func (nvme *NVMe) DeviceRescan(device string) error {
-	exe := nvme.buildNVMeCommand([]string{"nvme", "ns-rescan", device})
-	cmd := exec.Command(exe[0], exe[1:]...) // #nosec G204
-	_, err := cmd.Output()
+	return nvme.DeviceRescanWithContext(context.Background(), device)
+}
+
+// DeviceRescanWithContext rescan the NVMe controller device, giving up when ctx is done
+func (nvme *NVMe) DeviceRescanWithContext(ctx context.Context, device string) error {
+	defer tracer.TraceFuncCall(ctx, "gonvme.DeviceRescan")()
+	_, err := nvme.runNVMeCommand(ctx, []string{"nvme", "ns-rescan", device})
 	if err != nil {
 		return err
 	}
@@ -17,12 +17,25 @@
 package gonvme
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/dell/gonvme/gonvmetest"
+	"github.com/dell/gonvme/internal/nvmetcp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -59,11 +72,17 @@ func reset() {
 	GONVMEMock.InduceInitiatorError = false
 	GONVMEMock.InduceTCPLoginError = false
 	GONVMEMock.InduceFCLoginError = false
+	GONVMEMock.InduceRDMALoginError = false
 	GONVMEMock.InduceLogoutError = false
 	GONVMEMock.InduceGetSessionsError = false
 	GONVMEMock.InducedNVMeDeviceAndNamespaceError = false
 	GONVMEMock.InducedNVMeNamespaceIDError = false
 	GONVMEMock.InducedNVMeDeviceDataError = false
+	GONVMEMock.InduceIdentifyControllerError = false
+	GONVMEMock.InduceVersionError = false
+	GONVMEMock.InduceAuthError = false
+	GONVMEMock.InduceConfigError = false
+	GONVMEMock.InducedCommandDelay = 0
 }
 
 func TestPolymorphichCapability(t *testing.T) {
@@ -105,7 +124,7 @@ func TestDiscoverNVMeFCTargets(t *testing.T) {
 	reset()
 	c := NewNVMe(map[string]string{})
 	_, err := c.DiscoverNVMeFCTargets(fcTestPortal, false)
-	FCHostsInfo, err := c.getFCHostInfo()
+	FCHostsInfo, err := c.getFCHostInfo(context.Background())
 	if err == nil && len(FCHostsInfo) != 0 {
 		_, err := c.DiscoverNVMeFCTargets(fcTestPortal, false)
 		if err == nil {
@@ -244,7 +263,8 @@ func TestGetInitiators(t *testing.T) {
 		count    int
 	}{
 		{"testdata/initiatorname.nvme", 1},
-		{"testdata/multiple_nqn.nvme", 2},
+		// the same NQN twice is reported once
+		{"testdata/multiple_nqn.nvme", 1},
 		{"testdata/no_nqn.nvme", 0},
 		{"testdata/valid.nvme", 1},
 	}
@@ -327,6 +347,21 @@ func TestGetSessions(t *testing.T) {
 	}
 }
 
+func TestDiscoverNVMeTCPTargetsWithContextTimeout(t *testing.T) {
+	reset()
+	c := NewNVMe(map[string]string{})
+	ctx, cancel := context.WithTimeout(context.Background(), -1)
+	defer cancel()
+	_, err := c.DiscoverNVMeTCPTargetsWithContext(ctx, tcpTestPortal, false)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected a timeout error, but got %v", err)
+	}
+	_, err = c.GetSessionsWithContext(ctx)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected a timeout error, but got %v", err)
+	}
+}
+
 func TestMockDiscoverNVMETCPTargets(t *testing.T) {
 	reset()
 	var c NVMEinterface
@@ -405,6 +440,46 @@ func TestMockDiscoverNVMeFCTargetsError(t *testing.T) {
 	}
 }
 
+func TestMockDiscoverNVMeRDMATargets(t *testing.T) {
+	reset()
+	var c NVMEinterface
+	opts := map[string]string{}
+	expected := 4
+	opts[MockNumberOfRDMATargets] = fmt.Sprintf("%d", expected)
+	c = NewMockNVMe(opts)
+	targets, err := c.DiscoverNVMeRDMATargets("192.168.1.10", true)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if len(targets) != expected {
+		t.Errorf("Expected to find %d targets, but got back %v", expected, targets)
+	}
+	compareStr(t, targets[0].TargetType, NVMeTransportTypeRDMA)
+
+	GONVMEMock.InduceDiscoveryError = true
+	targets, err = c.DiscoverNVMeRDMATargets("192.168.1.10", false)
+	if err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+	if len(targets) != 0 {
+		t.Errorf("Expected to receive 0 targets when inducing an error. Received %v", targets)
+	}
+}
+
+func TestMockNVMeRDMALoginTargetsError(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{})
+	tgt := NVMeTarget{Portal: "192.168.1.10", TargetNqn: testTarget, TargetType: "rdma"}
+	if err := c.NVMeRDMAConnect(tgt, false); err != nil {
+		t.Error(err.Error())
+	}
+	GONVMEMock.InduceRDMALoginError = true
+	err := c.NVMeRDMAConnect(tgt, false)
+	if err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Error("Expected an induced error")
+	}
+}
+
 func TestMockGetInitiators(t *testing.T) {
 	reset()
 	opts := map[string]string{}
@@ -757,6 +832,20 @@ func TestSessionParserParse(t *testing.T) {
 	}
 }
 
+func TestSessionParserParseRDMA(t *testing.T) {
+	data, err := os.ReadFile("testdata/session_info_rdma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := (&sessionParser{}).Parse(data)
+	if len(sessions) != 1 {
+		t.Fatalf("Expected only the RDMA session, but got %v", sessions)
+	}
+	compareStr(t, sessions[0].Portal, "192.168.1.10:4420")
+	compareStr(t, sessions[0].Name, "nvme0")
+	compareStr(t, string(sessions[0].NVMETransportName), string(NVMETransportNameRDMA))
+}
+
 func compareStr(t *testing.T, str1 string, str2 string) {
 	if str1 != str2 {
 		t.Errorf("strings are not equal: %s != %s", str1, str2)
@@ -783,3 +872,2538 @@ func TestMockDeviceRescan(t *testing.T) {
 		return
 	}
 }
+
+func TestMockContextDeadline(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{})
+	GONVMEMock.InducedCommandDelay = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := c.NVMeTCPConnectWithContext(ctx, NVMeTarget{Portal: tcpTestPortal, TargetNqn: testTarget}, false)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected a timeout error, but got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the timeout error to wrap context.DeadlineExceeded, but got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = c.GetSessionsWithContext(ctx)
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected a cancellation error, but got %v", err)
+	}
+
+	GONVMEMock.InducedCommandDelay = time.Millisecond
+	_, err = c.DiscoverNVMeTCPTargetsWithContext(context.Background(), tcpTestPortal, false)
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+// fakeCommandRunner answers the commands of an NVMe client with canned output,
+// keyed by the nvme subcommand (e.g. "discover")
+type fakeCommandRunner struct {
+	mu        sync.Mutex
+	responses map[string]fakeCommandResponse
+	calls     [][]string
+	// probes counts the nvme-cli version probes, which are not recorded in calls
+	probes int
+}
+
+type fakeCommandResponse struct {
+	stdoutFile string
+	stdout     string
+	stderr     string
+	exitCode   int
+}
+
+func (r *fakeCommandRunner) Run(_ context.Context, args []string) (CommandResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(args) == 2 && args[1] == "version" {
+		r.probes++
+	} else {
+		r.calls = append(r.calls, args)
+	}
+	// a response for the whole command line takes precedence over one for the subcommand
+	resp, ok := r.responses[strings.Join(args, " ")]
+	if !ok {
+		resp, ok = r.responses[args[1]]
+	}
+	if !ok {
+		return CommandResult{ExitCode: -1}, fmt.Errorf("unexpected command %v", args)
+	}
+	result := CommandResult{Stdout: []byte(resp.stdout), Stderr: []byte(resp.stderr), ExitCode: resp.exitCode}
+	if resp.stdoutFile != "" {
+		data, err := os.ReadFile(resp.stdoutFile)
+		if err != nil {
+			return CommandResult{ExitCode: -1}, err
+		}
+		result.Stdout = data
+	}
+	if resp.exitCode != 0 {
+		return result, fmt.Errorf("exit status %d", resp.exitCode)
+	}
+	return result, nil
+}
+
+func (r *fakeCommandRunner) lastCall() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.calls) == 0 {
+		return nil
+	}
+	return r.calls[len(r.calls)-1]
+}
+
+func TestExecCommandRunner(t *testing.T) {
+	runner := NewExecCommandRunner("/")
+	result, err := runner.Run(context.Background(), []string{"sh", "-c", "echo out; echo err >&2; exit 3"})
+	if err == nil {
+		t.Error("Expected an error for a non-zero exit code")
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, but got %d", result.ExitCode)
+	}
+	compareStr(t, string(result.Stdout), "out\n")
+	compareStr(t, string(result.Stderr), "err\n")
+
+	result, err = runner.Run(context.Background(), []string{"sh", "-c", "true"})
+	if err != nil || result.ExitCode != 0 {
+		t.Errorf("Expected a successful run, but got %d: %v", result.ExitCode, err)
+	}
+}
+
+func TestDiscoverNVMeTCPTargetsWithRunner(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"discover": {stdoutFile: "testdata/discovery_tcp.txt"},
+		"connect":  {},
+	}}
+	c := NewNVMe(map[string]string{ChrootDirectory: "/noroot"}, WithCommandRunner(runner))
+	targets, err := c.DiscoverNVMeTCPTargets("10.230.1.1", false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Expected to find 2 targets, but got back %v", targets)
+	}
+	compareStr(t, targets[0].Portal, "10.230.1.1")
+	compareStr(t, targets[0].TargetNqn, "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D")
+	compareStr(t, targets[0].PortID, "2304")
+	compareStr(t, targets[1].Portal, "10.230.1.2")
+	compareStr(t, targets[1].SubType, "nvme subsystem")
+	// a custom runner receives the command without the chroot prefix
+	compareStr(t, runner.lastCall()[0], NVMeCommand)
+
+	_, err = c.DiscoverNVMeTCPTargets("10.230.1.1", true)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	compareStr(t, strings.Join(runner.lastCall()[1:4], " "), "connect -t tcp")
+
+	runner.responses["discover"] = fakeCommandResponse{exitCode: 2}
+	_, err = c.DiscoverNVMeTCPTargets("10.230.1.1", false)
+	if err == nil {
+		t.Error("Expected a discovery error")
+	}
+}
+
+func TestNVMeTCPConnectExitCodes(t *testing.T) {
+	reset()
+	testdata := []struct {
+		stderr   string
+		exitCode int
+		fail     bool
+	}{
+		{"", 0, false},
+		{"Failed to write to /dev/nvme-fabrics: Operation already in progress", 114, false},
+		{"", 70, false},
+		{"Failed to write to /dev/nvme-fabrics: Connection refused", 114, true},
+		{"traddr=10.230.1.1,trsvcid=4420: already connected", 1, false},
+		{"failed to add controller, error Unknown error -1", 1, true},
+		{"", 2, true},
+	}
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, TargetType: "tcp"}
+	for _, tt := range testdata {
+		runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+			"connect": {stderr: tt.stderr + "\n", exitCode: tt.exitCode},
+		}}
+		c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+		err := c.NVMeTCPConnect(tgt, true)
+		if (err != nil) != tt.fail {
+			t.Errorf("exit code %d with %q: expected failure %v, got %v", tt.exitCode, tt.stderr, tt.fail, err)
+		}
+		if runner.lastCall()[len(runner.lastCall())-1] != "-D" {
+			t.Errorf("Expected a duplicate connect, got %v", runner.lastCall())
+		}
+		err = c.NVMeFCConnect(tgt, false)
+		if (err != nil) != tt.fail {
+			t.Errorf("FC exit code %d with %q: expected failure %v, got %v", tt.exitCode, tt.stderr, tt.fail, err)
+		}
+		err = c.NVMeRDMAConnect(tgt, false)
+		if (err != nil) != tt.fail {
+			t.Errorf("RDMA exit code %d with %q: expected failure %v, got %v", tt.exitCode, tt.stderr, tt.fail, err)
+		}
+	}
+}
+
+func TestListNVMeDeviceAndNamespaceWithRunner(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"list":    {stdoutFile: "testdata/nvme_list.json"},
+		"list-ns": {stdout: "[   0]:0x2401\n[   1]:0x2406\n"},
+	}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	devices, err := c.ListNVMeDeviceAndNamespace()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(devices) != 2 {
+		t.Fatalf("Expected to find 2 devices, but got back %v", devices)
+	}
+	compareStr(t, devices[0].DevicePath, "/dev/nvme0n1")
+	compareStr(t, devices[0].Namespace, "9217")
+	compareStr(t, devices[1].DevicePath, "/dev/nvme0n2")
+	compareStr(t, devices[1].Namespace, "9222")
+
+	namespaceIDs, err := c.ListNVMeNamespaceID(devices)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if ids := namespaceIDs[devices[1]]; len(ids) != 2 || ids[1] != "0x2406" {
+		t.Errorf("Unexpected namespace IDs %v", ids)
+	}
+
+	// a device whose namespaces cannot be listed is reported along with the others
+	runner.responses["nvme list-ns /dev/nvme0n1"] = fakeCommandResponse{stderr: "No such device\n", exitCode: 19}
+	namespaceIDs, err = c.ListNVMeNamespaceID(devices)
+	if err == nil || !strings.Contains(err.Error(), "/dev/nvme0n1") || len(namespaceIDs) != 1 || len(namespaceIDs[devices[1]]) != 2 {
+		t.Errorf("Expected the namespace IDs of /dev/nvme0n2 and an error, but got %v: %v", namespaceIDs, err)
+	}
+	delete(runner.responses, "nvme list-ns /dev/nvme0n1")
+
+	// nvme-cli 0.x cannot list the devices as JSON
+	runner.responses["version"] = fakeCommandResponse{stdout: "nvme version 0.9\n"}
+	c = NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	var notSupported *NotSupportedError
+	if _, err = c.ListNVMeDeviceAndNamespace(); !errors.As(err, &notSupported) || notSupported.Feature != FeatureListJSON {
+		t.Errorf("Expected a NotSupportedError, but got %v", err)
+	}
+}
+
+func TestGetSessionsWithRunner(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"list-subsys": {stdoutFile: "testdata/session_info_valid"},
+	}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	sessions, err := c.GetSessions()
+	if err != nil || len(sessions) != 2 {
+		t.Errorf("Expected 2 sessions, but got %v: %v", sessions, err)
+	}
+
+	// no subsystems at all is not an error
+	runner.responses["list-subsys"] = fakeCommandResponse{exitCode: NVMeNoObjsFoundExitCode}
+	sessions, err = c.GetSessions()
+	if err != nil || len(sessions) != 0 {
+		t.Errorf("Expected no sessions, but got %v: %v", sessions, err)
+	}
+
+	// the list-subsys format follows the nvme-cli version
+	runner.responses["list-subsys"] = fakeCommandResponse{stdoutFile: "testdata/session_info_v1"}
+	for _, tt := range []struct {
+		version string
+		target  string
+	}{
+		{"nvme version 1.16\n", "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D"},
+		{"nvme version 2.8 (git 2.8)\nlibnvme version 1.8 (git 1.8)\n", ""},
+	} {
+		runner.responses["version"] = fakeCommandResponse{stdout: tt.version}
+		c = NewNVMe(map[string]string{}, WithCommandRunner(runner))
+		sessions, err = c.GetSessions()
+		if err != nil || len(sessions) != 1 {
+			t.Fatalf("%q: expected a single session, but got %v: %v", tt.version, sessions, err)
+		}
+		compareStr(t, sessions[0].Target, tt.target)
+	}
+}
+
+func TestGetSessionsSysfs(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{}
+	c := NewNVMe(map[string]string{ChrootDirectory: "testdata/sysfs", SessionsBackend: BackendSysfs}, WithCommandRunner(runner))
+	sessions, err := c.GetSessions()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(runner.calls) != 0 {
+		t.Errorf("Expected no nvme-cli invocation, but got %v", runner.calls)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("Expected 3 sessions, but got %v", sessions)
+	}
+	expected := []NVMESession{
+		{
+			Target:            "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D",
+			Portal:            "10.230.1.1:4420",
+			Name:              "nvme0",
+			Address:           "traddr=10.230.1.1,trsvcid=4420,src_addr=10.230.1.4",
+			NVMESessionState:  NVMESessionStateLive,
+			NVMETransportName: NVMETransportNameTCP,
+		},
+		{
+			Target:            "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D",
+			Portal:            "10.230.1.2:4420",
+			Name:              "nvme10",
+			Address:           "traddr=10.230.1.2,trsvcid=4420",
+			NVMESessionState:  NVMESessionStateConnecting,
+			NVMETransportName: NVMETransportNameTCP,
+		},
+		{
+			Target:            "nqn.1988-11.com.dell.mock:00:a1a1a1a111a1111a111a",
+			Portal:            "nn-0x11aaa111a1111a11:pn-0x11aaa11111111a11",
+			Name:              "nvme2",
+			Address:           "traddr=nn-0x11aaa111a1111a11:pn-0x11aaa11111111a11,host_traddr=nn-0x58aaa11111111a11:pn-0x58aaa11111111a11",
+			NVMESessionState:  NVMESessionStateLive,
+			NVMETransportName: NVMETransportNameFC,
+		},
+	}
+	for i := range expected {
+		if sessions[i] != expected[i] {
+			t.Errorf("Expected session %+v, but got %+v", expected[i], sessions[i])
+		}
+	}
+
+	// an empty sysfs tree has no sessions
+	c = NewNVMe(map[string]string{ChrootDirectory: t.TempDir(), SessionsBackend: BackendSysfs})
+	sessions, err = c.GetSessions()
+	if err != nil || len(sessions) != 0 {
+		t.Errorf("Expected no sessions, but got %v: %v", sessions, err)
+	}
+}
+
+// fakeFabricsDevice stands in for /dev/nvme-fabrics: it records the connect request
+// and answers it like the kernel does
+type fakeFabricsDevice struct {
+	written  string
+	response string
+	writeErr error
+	// block delays the response until it is closed
+	block chan struct{}
+}
+
+func (d *fakeFabricsDevice) Write(p []byte) (int, error) {
+	if d.writeErr != nil {
+		return 0, d.writeErr
+	}
+	d.written = string(p)
+	return len(p), nil
+}
+
+func (d *fakeFabricsDevice) Read(p []byte) (int, error) {
+	if d.block != nil {
+		<-d.block
+	}
+	return copy(p, d.response), nil
+}
+
+func (d *fakeFabricsDevice) Close() error {
+	return nil
+}
+
+func TestFabricsConnect(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	if err := os.MkdirAll(root+"/etc/nvme", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(root+DefaultInitiatorNameFile, []byte("nqn.2014-08.org.nvmexpress:uuid:705f2142-696e-48ff-42df-310e5424dfd1\n"), 0o600)
+	_ = os.WriteFile(root+DefaultHostIDFile, []byte("705f2142-696e-48ff-42df-310e5424dfd1\n"), 0o600)
+
+	device := &fakeFabricsDevice{response: "instance=3,cntlid=1\n"}
+	var opened string
+	c := NewNVMe(map[string]string{ChrootDirectory: root, ConnectBackend: BackendFabrics})
+	c.openFabrics = func(path string) (io.ReadWriteCloser, error) {
+		opened = path
+		return device, nil
+	}
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, TargetType: "tcp"}
+	if err := c.NVMeTCPConnect(tgt, true); err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, opened, root+DefaultFabricsDevice)
+	compareStr(t, device.written, "nqn="+testTarget+",transport=tcp,traddr=10.230.1.1,trsvcid=4420,"+
+		"hostnqn=nqn.2014-08.org.nvmexpress:uuid:705f2142-696e-48ff-42df-310e5424dfd1,"+
+		"hostid=705f2142-696e-48ff-42df-310e5424dfd1,ctrl_loss_tmo=-1,duplicate_connect")
+
+	fcTgt := NVMeTarget{Portal: fcTestPortal, TargetNqn: testTarget, HostAdr: hostAddress, TargetType: "fc"}
+	if err := c.NVMeFCConnect(fcTgt, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(device.written, "transport=fc,traddr="+fcTestPortal+",host_traddr="+hostAddress+",") {
+		t.Errorf("Unexpected FC connect options %s", device.written)
+	}
+
+	rdmaTgt := NVMeTarget{Portal: "192.168.1.10", TargetNqn: testTarget, HostAdr: "192.168.1.100", TargetType: "rdma"}
+	if err := c.NVMeRDMAConnect(rdmaTgt, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(device.written, "transport=rdma,traddr=192.168.1.10,trsvcid=4420,host_traddr=192.168.1.100,") {
+		t.Errorf("Unexpected RDMA connect options %s", device.written)
+	}
+
+	// the kernel reports an existing controller with EALREADY
+	device.writeErr = &os.PathError{Op: "write", Path: DefaultFabricsDevice, Err: syscall.EALREADY}
+	if err := c.NVMeTCPConnect(tgt, false); err != nil {
+		t.Errorf("Expected an existing connection to succeed, but got %v", err)
+	}
+	device.writeErr = &os.PathError{Op: "write", Path: DefaultFabricsDevice, Err: syscall.ECONNREFUSED}
+	if err := c.NVMeTCPConnect(tgt, false); err == nil {
+		t.Error("Expected a connect error")
+	}
+	device.writeErr = nil
+	device.response = "garbage"
+	if err := c.NVMeTCPConnect(tgt, false); err == nil {
+		t.Error("Expected an error for an unexpected response")
+	}
+}
+
+func TestFabricsConnectDevicePath(t *testing.T) {
+	reset()
+	// a regular file takes the request but never answers it
+	device := filepath.Join(t.TempDir(), "nvme-fabrics")
+	if err := os.WriteFile(device, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := NewNVMe(map[string]string{ConnectBackend: BackendFabrics, FabricsDevice: device})
+	err := c.NVMeTCPConnect(NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}, false)
+	if err == nil {
+		t.Error("Expected an error for a device without response")
+	}
+	data, _ := os.ReadFile(device)
+	if !strings.HasPrefix(string(data), "nqn="+testTarget+",transport=tcp,traddr=10.230.1.1,trsvcid=4420") {
+		t.Errorf("Unexpected connect request %q", data)
+	}
+}
+
+func TestFabricsDisconnect(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	for name, nqn := range map[string]string{"nvme0": testTarget, "nvme1": "nqn.1988-11.com.mock:other", "nvme2": testTarget} {
+		dir := filepath.Join(root, sysfsNVMeClass, name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.WriteFile(filepath.Join(dir, "subsysnqn"), []byte(nqn+"\n"), 0o600)
+		_ = os.WriteFile(filepath.Join(dir, "delete_controller"), nil, 0o600)
+	}
+	c := NewNVMe(map[string]string{ChrootDirectory: root, ConnectBackend: BackendFabrics})
+	if err := c.NVMeDisconnect(NVMeTarget{TargetNqn: testTarget}); err != nil {
+		t.Fatal(err.Error())
+	}
+	for name, deleted := range map[string]bool{"nvme0": true, "nvme1": false, "nvme2": true} {
+		data, _ := os.ReadFile(filepath.Join(root, sysfsNVMeClass, name, "delete_controller"))
+		if (string(data) == "1") != deleted {
+			t.Errorf("Unexpected delete_controller content %q for %s", data, name)
+		}
+	}
+}
+
+func TestParseFabricsResponse(t *testing.T) {
+	instance, cntlid, err := parseFabricsResponse("instance=12,cntlid=2\n")
+	if err != nil || instance != 12 || cntlid != 2 {
+		t.Errorf("Unexpected result %d %d %v", instance, cntlid, err)
+	}
+	if _, _, err = parseFabricsResponse(""); err == nil {
+		t.Error("Expected an error for an empty response")
+	}
+}
+
+// startDiscoveryController starts a gonvmetest discovery controller serving entries until the test ends
+func startDiscoveryController(t *testing.T, entries ...gonvmetest.LogEntry) *gonvmetest.DiscoveryController {
+	controller, err := gonvmetest.NewDiscoveryController(entries...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { controller.Close() })
+	return controller
+}
+
+func TestNativeDiscoverNVMeTCPTargets(t *testing.T) {
+	reset()
+	controller := startDiscoveryController(t,
+		gonvmetest.FCEntry(testTarget, fcTestPortal),
+		gonvmetest.LogEntry{PortID: 2304, SubNQN: testTarget, TrAddr: "10.230.1.1"},
+		gonvmetest.LogEntry{
+			SubType: "current discovery subsystem", Treq: "required", SecType: "tls1.3", PortID: 2305,
+			EFlags: gonvmetest.EFlagExplicitDiscoveryConnections, TrAddr: "10.230.1.2",
+		},
+		gonvmetest.RDMAEntry(testTarget, "10.230.2.1", "4420"),
+	)
+	controller.SetGenCtr(5)
+
+	runner := &fakeCommandRunner{}
+	c := NewNVMe(map[string]string{DiscoveryBackend: BackendNative, ChrootDirectory: t.TempDir()}, WithCommandRunner(runner))
+	targets, err := c.DiscoverNVMeTCPTargets(controller.Address(), false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(runner.calls) != 0 {
+		t.Errorf("Expected no nvme-cli invocation, but got %v", runner.calls)
+	}
+	expected := []NVMeTarget{
+		{
+			Portal: "10.230.1.1", TargetNqn: testTarget, TrType: "tcp", AdrFam: "ipv4", SubType: "nvme subsystem",
+			Treq: "not specified", PortID: "2304", TrsvcID: "4420", SecType: "none", TargetType: "tcp",
+			CntlID: "65535", AsqSz: "32", EFlags: "none", GenCtr: 5, NumRec: 4,
+		},
+		{
+			Portal: "10.230.1.2", TargetNqn: gonvmetest.DiscoveryNQN, TrType: "tcp", AdrFam: "ipv4", SubType: "current discovery subsystem",
+			Treq: "required", PortID: "2305", TrsvcID: "8009", SecType: "tls1.3", TargetType: "tcp",
+			CntlID: "65535", AsqSz: "32", EFlags: "explicit discovery connections", GenCtr: 5, NumRec: 4,
+		},
+	}
+	if len(targets) != len(expected) {
+		t.Fatalf("Expected %d targets, but got %v", len(expected), targets)
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Errorf("Expected target %+v, but got %+v", expected[i], targets[i])
+		}
+	}
+	if hosts := controller.HostNQNs(); len(hosts) != 1 || !strings.HasPrefix(hosts[0], "nqn.2014-08.org.nvmexpress:uuid:") {
+		t.Errorf("Unexpected host NQNs %v", hosts)
+	}
+
+	controller.Close()
+	if _, err = c.DiscoverNVMeTCPTargets(controller.Address(), false); err == nil {
+		t.Error("Expected a discovery error")
+	}
+}
+
+func TestNativeDiscoverNVMeTCPTargetsLargeLog(t *testing.T) {
+	reset()
+	var entries []gonvmetest.LogEntry
+	for i := 0; i < 9; i++ {
+		entries = append(entries, gonvmetest.TCPEntry(testTarget, fmt.Sprintf("10.230.1.%d", i), "4420"))
+	}
+	controller := startDiscoveryController(t, entries...)
+	c := NewNVMe(map[string]string{DiscoveryBackend: BackendNative, ChrootDirectory: t.TempDir()})
+	targets, err := c.DiscoverNVMeTCPTargets(controller.Address(), false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(targets) != 9 || targets[8].Portal != "10.230.1.8" {
+		t.Errorf("Unexpected targets %v", targets)
+	}
+}
+
+func TestNativeDiscoverNVMeTCPTargetsUnreliableController(t *testing.T) {
+	reset()
+	controller := startDiscoveryController(t, gonvmetest.TCPEntry(testTarget, "10.230.1.1", "4420"))
+	c := NewNVMe(map[string]string{DiscoveryBackend: BackendNative, ChrootDirectory: t.TempDir()})
+
+	// a log which changes while it is read is read again
+	controller.ChangeGenCtrOnRead(2)
+	targets, err := c.DiscoverNVMeTCPTargets(controller.Address(), false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(targets) != 1 || targets[0].GenCtr != controller.GenCtr() {
+		t.Errorf("Expected the targets of generation %d, but got %v", controller.GenCtr(), targets)
+	}
+
+	controller.ChangeGenCtrOnRead(100)
+	if _, err = c.DiscoverNVMeTCPTargets(controller.Address(), false); err == nil {
+		t.Error("Expected an error for a log which keeps changing")
+	}
+	controller.ChangeGenCtrOnRead(0)
+
+	controller.DropConnections(true)
+	if _, err = c.DiscoverNVMeTCPTargets(controller.Address(), false); err == nil {
+		t.Error("Expected an error for a dropped connection")
+	}
+	controller.DropConnections(false)
+
+	controller.SetDelay(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = c.DiscoverNVMeTCPTargetsWithContext(ctx, controller.Address(), false); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, but got %v", err)
+	}
+
+	// a controller which stops answering times out without a deadline of the context
+	defer func(timeout time.Duration) { nvmetcp.IOTimeout = timeout }(nvmetcp.IOTimeout)
+	nvmetcp.IOTimeout = 20 * time.Millisecond
+	if _, err = c.DiscoverNVMeTCPTargets(controller.Address(), false); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, but got %v", err)
+	}
+}
+
+// fakeInterfaceAddrs returns the addresses of the network interfaces of the sysfs fixture
+func fakeInterfaceAddrs(name string) ([]net.Addr, error) {
+	cidrs := map[string][]string{
+		"ens1f0": {"192.168.1.100/24", "fe80::1/64"},
+		"ens1f1": {"192.168.2.100/24"},
+	}[name]
+	if cidrs == nil {
+		return nil, fmt.Errorf("no such network interface %s", name)
+	}
+	var addrs []net.Addr
+	for _, cidr := range cidrs {
+		ip, network, _ := net.ParseCIDR(cidr)
+		addrs = append(addrs, &net.IPNet{IP: ip, Mask: network.Mask})
+	}
+	return addrs, nil
+}
+
+func TestDiscoverNVMeRDMATargetsWithRunner(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"discover": {stdoutFile: "testdata/discovery_rdma.txt"},
+		"connect":  {},
+	}}
+	c := NewNVMe(map[string]string{ChrootDirectory: "testdata/sysfs"}, WithCommandRunner(runner))
+	c.interfaceAddrs = fakeInterfaceAddrs
+	targets, err := c.DiscoverNVMeRDMATargets("192.168.2.10", true)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, strings.Join(runner.calls[0], " "), "nvme discover -t rdma -a 192.168.2.10 -s 4420 -w 192.168.2.100 -o json")
+	if len(targets) != 2 {
+		t.Fatalf("Expected to find 2 targets, but got back %v", targets)
+	}
+	compareStr(t, targets[0].Portal, "192.168.1.10")
+	compareStr(t, targets[0].TargetType, NVMeTransportTypeRDMA)
+	compareStr(t, targets[0].TrsvcID, "4420")
+	compareStr(t, targets[1].Portal, "192.168.2.10")
+	compareStr(t, targets[1].HostAdr, "192.168.2.100")
+	compareStr(t, strings.Join(runner.lastCall()[1:4], " "), "connect -t rdma")
+
+	runner.responses["discover"] = fakeCommandResponse{exitCode: 2}
+	if _, err = c.DiscoverNVMeRDMATargets("192.168.2.10", false); err == nil {
+		t.Error("Expected a discovery error")
+	}
+}
+
+func TestNVMeRDMAConnect(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{"connect": {}}}
+	c := NewNVMe(map[string]string{ChrootDirectory: "testdata/sysfs"}, WithCommandRunner(runner))
+	c.interfaceAddrs = fakeInterfaceAddrs
+
+	testdata := []struct {
+		target    NVMeTarget
+		duplicate bool
+		expected  string
+	}{
+		// the interface on the subnet of the target is selected
+		{
+			NVMeTarget{Portal: "192.168.1.10", TargetNqn: testTarget}, false,
+			"nvme connect -t rdma -n " + testTarget + " -a 192.168.1.10 -s 4420 -w 192.168.1.100 --ctrl-loss-tmo=-1",
+		},
+		// a host address of the target takes precedence
+		{
+			NVMeTarget{Portal: "192.168.1.10", TargetNqn: testTarget, HostAdr: "192.168.1.101"}, true,
+			"nvme connect -t rdma -n " + testTarget + " -a 192.168.1.10 -s 4420 -w 192.168.1.101 --ctrl-loss-tmo=-1 -D",
+		},
+		// the kernel routes targets no RDMA interface is attached to
+		{
+			NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}, false,
+			"nvme connect -t rdma -n " + testTarget + " -a 10.230.1.1 -s 4420 --ctrl-loss-tmo=-1",
+		},
+	}
+	for _, tt := range testdata {
+		if err := c.NVMeRDMAConnect(tt.target, tt.duplicate); err != nil {
+			t.Error(err.Error())
+		}
+		compareStr(t, strings.Join(runner.lastCall(), " "), tt.expected)
+	}
+}
+
+func TestSplitDiscoveryAddress(t *testing.T) {
+	testdata := []struct {
+		address string
+		host    string
+		ports   []string
+	}{
+		{"10.230.1.1", "10.230.1.1", []string{NVMeDiscoveryPort, NVMePort}},
+		{"10.230.1.1:4421", "10.230.1.1", []string{"4421"}},
+		{"fd00::1", "fd00::1", []string{NVMeDiscoveryPort, NVMePort}},
+		{"[fd00::1]", "fd00::1", []string{NVMeDiscoveryPort, NVMePort}},
+		{"[fd00::1]:8009", "fd00::1", []string{"8009"}},
+		{"array.example.com:8009", "array.example.com", []string{"8009"}},
+	}
+	for _, tt := range testdata {
+		host, ports := splitDiscoveryAddress(tt.address, NVMeDiscoveryPort, NVMePort)
+		compareStr(t, host, tt.host)
+		compareStr(t, strings.Join(ports, ","), strings.Join(tt.ports, ","))
+	}
+}
+
+func TestDiscoverNVMeTCPTargetsPorts(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"nvme discover -t tcp -a 10.230.1.1 -s 8009 -o json":              {stderr: "failed to add controller, error connection refused\n", exitCode: 1},
+		"nvme discover -t tcp -a 10.230.1.1 -s 4420 -o json":              {stdoutFile: "testdata/discovery_tcp.txt"},
+		"nvme discover -t tcp -a fd00::1 -s 8009 -o json":                 {stdoutFile: "testdata/discovery_tcp.txt"},
+		"nvme discover -t tcp -a 10.230.1.2 -s 8009 -o json":              {stderr: "Failed to write to /dev/nvme-fabrics: Key was rejected by service\n", exitCode: 129},
+		"nvme discover -t tcp -a 10.230.1.2 -s 4420 -o json":              {stdoutFile: "testdata/discovery_tcp.txt"},
+		"nvme discover -t tcp -a 10.230.1.2 -s 8009 --persistent -o json": {stderr: "Failed to write to /dev/nvme-fabrics: Key was rejected by service\n", exitCode: 129},
+		"nvme discover -t tcp -a 10.230.1.2 -s 4420 --persistent -o json": {stdoutFile: "testdata/discovery_tcp.txt"},
+	}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+
+	// the well-known discovery port is tried first, NVMePort after it
+	targets, err := c.DiscoverNVMeTCPTargets("10.230.1.1", false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(targets) != 2 || len(runner.calls) != 2 {
+		t.Errorf("Expected 2 targets after 2 attempts, but got %v after %v", targets, runner.calls)
+	}
+
+	// an explicit port is the only one tried
+	if _, err = c.DiscoverNVMeTCPTargets("10.230.1.1:8009", false); err == nil {
+		t.Error("Expected a discovery error")
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme discover -t tcp -a 10.230.1.1 -s 8009 -o json")
+	if _, err = c.DiscoverNVMeTCPTargets("[fd00::1]:8009", false); err != nil {
+		t.Error(err.Error())
+	}
+
+	// only a port which cannot be reached is skipped, a failed authentication is returned
+	if _, err = c.DiscoverNVMeTCPTargets("10.230.1.2", false); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Expected ErrAuthFailed, but got %v", err)
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme discover -t tcp -a 10.230.1.2 -s 8009 -o json")
+	if _, err = c.WatchDiscovery(context.Background(), DiscoveryWatchOptions{Address: "10.230.1.2"}); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Expected ErrAuthFailed, but got %v", err)
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme discover -t tcp -a 10.230.1.2 -s 8009 --persistent -o json")
+}
+
+func TestNVMeConnectServiceID(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{"connect": {}}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	testdata := []struct {
+		trsvcid string
+		port    string
+	}{
+		{"4421", "4421"},
+		{"8009", "8009"},
+		{"none", NVMePort},
+		{"", NVMePort},
+	}
+	for _, tt := range testdata {
+		tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, TrsvcID: tt.trsvcid}
+		if err := c.NVMeTCPConnect(tgt, false); err != nil {
+			t.Error(err.Error())
+		}
+		compareStr(t, strings.Join(runner.lastCall()[6:10], " "), "-a 10.230.1.1 -s "+tt.port)
+		if err := c.NVMeRDMAConnect(tgt, false); err != nil {
+			t.Error(err.Error())
+		}
+		compareStr(t, strings.Join(runner.lastCall()[6:10], " "), "-a 10.230.1.1 -s "+tt.port)
+	}
+}
+
+func TestNativeDiscoverNVMeTCPTargetsPorts(t *testing.T) {
+	reset()
+	controller := startDiscoveryController(t, gonvmetest.TCPEntry(testTarget, "10.230.1.1", "4421"))
+	c := NewNVMe(map[string]string{DiscoveryBackend: BackendNative, ChrootDirectory: t.TempDir()})
+	targets, err := c.DiscoverNVMeTCPTargets("[::ffff:127.0.0.1]:"+controller.Port(), false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(targets) != 1 || targets[0].TrsvcID != "4421" {
+		t.Errorf("Unexpected targets %v", targets)
+	}
+}
+
+func TestSessionPortalRoundTrip(t *testing.T) {
+	testdata := []struct {
+		address string
+		host    string
+		port    string
+	}{
+		{"traddr=10.230.1.1,trsvcid=4421,src_addr=10.230.1.4", "10.230.1.1", "4421"},
+		{"traddr=fd00::1 trsvcid=8009", "fd00::1", "8009"},
+	}
+	for _, tt := range testdata {
+		session, ok := newNVMESession(testTarget, "nvme0", NVMeTransportTypeTCP, tt.address, "live")
+		if !ok {
+			t.Fatalf("Expected a session for %s", tt.address)
+		}
+		host, ports := splitDiscoveryAddress(session.Portal, NVMeDiscoveryPort, NVMePort)
+		compareStr(t, host, tt.host)
+		compareStr(t, strings.Join(ports, ","), tt.port)
+	}
+}
+
+func TestSessionParserParseIPv6(t *testing.T) {
+	data, err := os.ReadFile("testdata/session_info_ipv6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := (&sessionParser{}).Parse(data)
+	expected := []string{"[fd00:230::1]:4420", "[fe80::2%ens1f0]:4421", "10.230.1.1:4420", "[fd00:231::1]:4420"}
+	if len(sessions) != len(expected) {
+		t.Fatalf("Expected %d sessions, but got %v", len(expected), sessions)
+	}
+	for i, session := range sessions {
+		compareStr(t, session.Portal, expected[i])
+	}
+	compareStr(t, string(sessions[3].NVMETransportName), string(NVMETransportNameRDMA))
+}
+
+func TestDiscoverNVMeTCPTargetsIPv6(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"discover": {stdoutFile: "testdata/discovery_tcp_ipv6.txt"},
+		"connect":  {},
+	}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	targets, err := c.DiscoverNVMeTCPTargets("[fd00:230::1]:8009", true)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, strings.Join(runner.calls[0], " "), "nvme discover -t tcp -a fd00:230::1 -s 8009 -o json")
+	if len(targets) != 3 {
+		t.Fatalf("Expected to find 3 targets, but got back %v", targets)
+	}
+	compareStr(t, targets[1].AdrFam, "ipv6")
+	compareStr(t, targets[1].Portal, "fd00:230::1")
+	compareStr(t, targets[2].Portal, "fd00:230::2")
+	// the targets are connected concurrently, in no particular order
+	found := false
+	for _, call := range runner.calls {
+		if len(call) >= 10 && call[1] == "connect" && strings.Join(call[6:10], " ") == "-a fd00:230::2 -s 4420" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a connect to fd00:230::2, but got %v", runner.calls)
+	}
+}
+
+func TestNVMeTCPConnectIPv6(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{"connect": {}}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	testdata := []struct {
+		portal  string
+		trsvcid string
+		address string
+		fail    bool
+	}{
+		{"fd00:230::1", "4420", "-a fd00:230::1 -s 4420", false},
+		{"[fd00:230::1]", "", "-a fd00:230::1 -s 4420", false},
+		{"fe80::2%ens1f0", "4421", "-a fe80::2%ens1f0 -s 4421", false},
+		// the portal of a session
+		{"[fe80::2%ens1f0]:4421", "", "-a fe80::2%ens1f0 -s 4421", false},
+		{"10.230.1.1:4422", "", "-a 10.230.1.1 -s 4422", false},
+		{"fd00:230::1::2", "4420", "", true},
+	}
+	for _, tt := range testdata {
+		runner.calls = nil
+		err := c.NVMeTCPConnect(NVMeTarget{Portal: tt.portal, TrsvcID: tt.trsvcid, TargetNqn: testTarget}, false)
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: expected failure %v, got %v", tt.portal, tt.fail, err)
+		}
+		if tt.fail {
+			if len(runner.calls) != 0 {
+				t.Errorf("Expected no nvme connect for %s, got %v", tt.portal, runner.calls)
+			}
+			continue
+		}
+		compareStr(t, strings.Join(runner.lastCall()[6:10], " "), tt.address)
+	}
+}
+
+func TestFabricsConnectAbandoned(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	deleteController := filepath.Join(root, sysfsNVMeClass, "nvme3", "delete_controller")
+	_ = os.MkdirAll(filepath.Dir(deleteController), 0o755)
+	_ = os.WriteFile(deleteController, nil, 0o600)
+
+	device := &fakeFabricsDevice{response: "instance=3,cntlid=1\n", block: make(chan struct{})}
+	c := NewNVMe(map[string]string{ChrootDirectory: root, ConnectBackend: BackendFabrics})
+	c.openFabrics = func(string) (io.ReadWriteCloser, error) {
+		return device, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, TargetType: "tcp"}
+	if _, err := c.NVMeTCPConnectWithOptions(ctx, tgt, ConnectOptions{}); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected ErrTimeout, but got %v", err)
+	}
+
+	// the controller the kernel creates after all is deleted
+	close(device.block)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(deleteController)
+		if string(data) == "1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected nvme3 to be deleted, but got %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFabricsConnectIPv6(t *testing.T) {
+	reset()
+	device := &fakeFabricsDevice{response: "instance=3,cntlid=1\n"}
+	c := NewNVMe(map[string]string{ChrootDirectory: t.TempDir(), ConnectBackend: BackendFabrics})
+	c.openFabrics = func(string) (io.ReadWriteCloser, error) { return device, nil }
+	tgt := NVMeTarget{Portal: "[fe80::2%ens1f0]:4421", TargetNqn: testTarget}
+	if err := c.NVMeTCPConnect(tgt, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(device.written, ",traddr=fe80::2%ens1f0,trsvcid=4421,") {
+		t.Errorf("Unexpected connect options %s", device.written)
+	}
+}
+
+func TestNativeDiscoverNVMeTCPTargetsIPv6(t *testing.T) {
+	reset()
+	controller := startDiscoveryController(t, gonvmetest.TCPEntry(testTarget, "fd00:230::1", "4420"))
+	c := NewNVMe(map[string]string{DiscoveryBackend: BackendNative, ChrootDirectory: t.TempDir()})
+	targets, err := c.DiscoverNVMeTCPTargets(controller.Address(), false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(targets) != 1 || targets[0].AdrFam != "ipv6" || targets[0].Portal != "fd00:230::1" {
+		t.Errorf("Unexpected targets %v", targets)
+	}
+}
+
+func TestParseDiscoveryLog(t *testing.T) {
+	testdata := []struct {
+		file    string
+		genCtr  uint64
+		numRec  uint64
+		entries int
+	}{
+		// nvme-cli 1.x
+		{"testdata/discovery_tcp.txt", 7, 3, 3},
+		{"testdata/discovery_tcp_v1.json", 7, 3, 3},
+		// nvme-cli 2.x
+		{"testdata/discovery_tcp_ipv6.txt", 9, 3, 3},
+		{"testdata/discovery_rdma.txt", 4, 3, 3},
+		{"testdata/discovery_tcp_v2.json", 12, 3, 3},
+		{"testdata/discovery_tcp_v2_cntlid.json", 13, 2, 2},
+	}
+	for _, tt := range testdata {
+		data, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log, err := parseDiscoveryLog(data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if log.GenCtr != tt.genCtr || log.NumRec != tt.numRec || len(log.Entries) != tt.entries {
+			t.Errorf("%s: unexpected discovery log %+v", tt.file, log)
+		}
+	}
+
+	// the text and JSON output of the same log are parsed the same way
+	text, _ := os.ReadFile("testdata/discovery_tcp.txt")
+	data, _ := os.ReadFile("testdata/discovery_tcp_v1.json")
+	textLog, _ := parseDiscoveryLog(text)
+	jsonLog, _ := parseDiscoveryLog(data)
+	for i := range textLog.Entries {
+		if textLog.Entries[i] != jsonLog.Entries[i] {
+			t.Errorf("Expected entry %+v, but got %+v", textLog.Entries[i], jsonLog.Entries[i])
+		}
+	}
+	expected := DiscoveryLogEntry{
+		TrType: "fc", AdrFam: "fibre-channel", SubType: "nvme subsystem", Treq: "not specified", TrSvcID: "none",
+		SubNQN: "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D", TrAddr: "nn-0x11aaa111a1111a11:pn-0x11aaa11111111a11",
+	}
+	if textLog.Entries[0] != expected {
+		t.Errorf("Expected entry %+v, but got %+v", expected, textLog.Entries[0])
+	}
+
+	data, _ = os.ReadFile("testdata/discovery_tcp_ipv6.txt")
+	log, _ := parseDiscoveryLog(data)
+	compareStr(t, log.Entries[0].EFlags, "explicit discovery connections, duplicate discovery information")
+
+	if _, err := parseDiscoveryLog([]byte(`{"genctr": "x"}`)); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+	if log, err := parseDiscoveryLog([]byte("No discovery log entries to fetch.\n")); err != nil || len(log.Entries) != 0 {
+		t.Errorf("Expected an empty discovery log, but got %+v, %v", log, err)
+	}
+}
+
+func TestDiscoverNVMeTCPTargetsJSON(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"discover": {stdoutFile: "testdata/discovery_tcp_v2_cntlid.json"},
+	}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	targets, err := c.DiscoverNVMeTCPTargets("10.230.1.1", false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []NVMeTarget{
+		{
+			Portal: "10.230.1.1", TargetNqn: "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D", TrType: "tcp", AdrFam: "ipv4", SubType: "nvme subsystem",
+			Treq: "required", PortID: "2304", TrsvcID: "4420", SecType: "tls1.3", TargetType: "tcp",
+			CntlID: "65535", AsqSz: "32", EFlags: "none", GenCtr: 13, NumRec: 2,
+		},
+		{
+			Portal: "10.230.1.2", TargetNqn: "nqn.2014-08.org.nvmexpress.discovery", TrType: "tcp", AdrFam: "ipv4",
+			SubType: "current discovery subsystem", Treq: "not specified", PortID: "2303", TrsvcID: "8009", SecType: "none",
+			TargetType: "tcp", CntlID: "65535", AsqSz: "32", EFlags: "explicit discovery connections", GenCtr: 13, NumRec: 2,
+		},
+	}
+	if len(targets) != len(expected) {
+		t.Fatalf("Expected %d targets, but got %v", len(expected), targets)
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Errorf("Expected target %+v, but got %+v", expected[i], targets[i])
+		}
+	}
+}
+
+func TestDiscoverNVMeTCPTargetsWithoutJSON(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"nvme discover -t tcp -a 10.230.1.1 -s 4420 -o json": {stderr: "discover: invalid option -- 'o'\n", exitCode: 1},
+		"nvme discover -t tcp -a 10.230.1.1 -s 4420":         {stdoutFile: "testdata/discovery_tcp.txt"},
+	}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	targets, err := c.DiscoverNVMeTCPTargets("10.230.1.1:4420", false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(targets) != 2 || targets[0].GenCtr != 7 {
+		t.Errorf("Unexpected targets %v", targets)
+	}
+	if len(runner.calls) != 2 {
+		t.Errorf("Expected a retry without JSON output, but got %v", runner.calls)
+	}
+
+	// a failed discovery is not retried
+	runner.calls = nil
+	runner.responses["nvme discover -t tcp -a 10.230.1.1 -s 4420 -o json"] = fakeCommandResponse{stderr: "failed to connect\n", exitCode: 1}
+	if _, err = c.DiscoverNVMeTCPTargets("10.230.1.1:4420", false); err == nil {
+		t.Error("Expected a discovery error")
+	}
+	if len(runner.calls) != 1 {
+		t.Errorf("Expected a single attempt, but got %v", runner.calls)
+	}
+}
+
+func TestParseNVMeVersion(t *testing.T) {
+	testdata := []struct {
+		out     string
+		version Version
+		libnvme Version
+		fail    bool
+	}{
+		{"nvme version 1.16\n", Version{1, 16, 0}, Version{}, false},
+		{"nvme version 2.8 (git 2.8)\nlibnvme version 1.8 (git 1.8)\n", Version{2, 8, 0}, Version{1, 8, 0}, false},
+		{"nvme version 2.11.1 (git 2.11.1-5.el9)\nlibnvme version 1.11.1 (git 1.11.1)\n", Version{2, 11, 1}, Version{1, 11, 1}, false},
+		{"command not found\n", Version{}, Version{}, true},
+	}
+	for _, tt := range testdata {
+		version, libnvme, err := parseNVMeVersion([]byte(tt.out))
+		if (err != nil) != tt.fail {
+			t.Errorf("%q: expected failure %v, got %v", tt.out, tt.fail, err)
+		}
+		if version != tt.version || libnvme != tt.libnvme {
+			t.Errorf("%q: expected %v and %v, got %v and %v", tt.out, tt.version, tt.libnvme, version, libnvme)
+		}
+	}
+
+	capabilities := newCapabilities(Version{1, 16, 0}, Version{})
+	if !capabilities.DiscoverJSON || capabilities.ListSubsysJSONV2 || capabilities.TLS || capabilities.DHCHAPSecret {
+		t.Errorf("Unexpected nvme-cli 1.16 capabilities %+v", capabilities)
+	}
+	capabilities = newCapabilities(Version{2, 4, 0}, Version{1, 4, 0})
+	if !capabilities.TLS || !capabilities.DHCHAPSecret || !capabilities.ListJSON || capabilities.Context {
+		t.Errorf("Unexpected nvme-cli 2.4 capabilities %+v", capabilities)
+	}
+}
+
+func TestGetNVMeCLICapabilities(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	if _, err := c.GetNVMeCLICapabilities(); err == nil {
+		t.Error("Expected an error when nvme version fails")
+	}
+
+	// a failed probe is not cached
+	runner.responses["version"] = fakeCommandResponse{stdout: "nvme version 2.8 (git 2.8)\nlibnvme version 1.8 (git 1.8)\n"}
+	for i := 0; i < 2; i++ {
+		capabilities, err := c.GetNVMeCLICapabilities()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if capabilities.Version != (Version{2, 8, 0}) || capabilities.LibNVMeVersion != (Version{1, 8, 0}) || !capabilities.ListSubsysJSONV2 || !capabilities.Context {
+			t.Errorf("Unexpected capabilities %+v", capabilities)
+		}
+	}
+	if runner.probes != 2 {
+		t.Errorf("Expected nvme version to run twice, but it ran %d times", runner.probes)
+	}
+
+	err := (&NVMe{runner: runner, capabilities: &Capabilities{Version: Version{1, 16, 0}}}).requireCapability(context.Background(), FeatureTLS)
+	var notSupported *NotSupportedError
+	if !errors.Is(err, ErrNotSupported) || !errors.As(err, &notSupported) || notSupported.Feature != FeatureTLS {
+		t.Errorf("Expected a NotSupportedError, but got %v", err)
+	}
+	if err = c.requireCapability(context.Background(), FeatureTLS); err != nil {
+		t.Errorf("Expected --tls to be supported, but got %v", err)
+	}
+}
+
+func TestNVMeCLIVersionCommands(t *testing.T) {
+	reset()
+	// nvme-cli 1.x without JSON discovery output
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"version":  {stdout: "nvme version 1.9\n"},
+		"discover": {stdoutFile: "testdata/discovery_tcp.txt"},
+		"connect":  {stderr: "Failed to write to /dev/nvme-fabrics: Operation already in progress\n", exitCode: 114},
+	}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	targets, err := c.DiscoverNVMeTCPTargets("10.230.1.1:4420", false)
+	if err != nil || len(targets) != 2 {
+		t.Errorf("Unexpected targets %v, %v", targets, err)
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme discover -t tcp -a 10.230.1.1 -s 4420")
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, TargetType: "tcp"}
+	if err = c.NVMeTCPConnect(tgt, false); err != nil {
+		t.Errorf("Expected nvme-cli 1.x exit code 114 to be an existing connection, but got %v", err)
+	}
+
+	// nvme-cli 2.x reports an existing connection with exit code 1 only
+	runner = &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"version": {stdout: "nvme version 2.8 (git 2.8)\nlibnvme version 1.8 (git 1.8)\n"},
+		"connect": {stderr: "Failed to write to /dev/nvme-fabrics: Operation already in progress\n", exitCode: 114},
+	}}
+	c = NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	if err = c.NVMeTCPConnect(tgt, false); err == nil {
+		t.Error("Expected nvme-cli 2.x exit code 114 to fail")
+	}
+}
+
+func TestSessionParserParseV1(t *testing.T) {
+	data, err := os.ReadFile("testdata/session_info_v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := (&sessionParser{}).Parse(data)
+	if len(sessions) != 1 {
+		t.Fatalf("Expected a single session, but got %v", sessions)
+	}
+	compareStr(t, sessions[0].Target, "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D")
+	compareStr(t, sessions[0].Portal, "10.230.1.1:4420")
+}
+
+func TestMockGetNVMeCLICapabilities(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{MockNVMeCLIVersion: "1.16"})
+	capabilities, err := c.GetNVMeCLICapabilities()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if capabilities.Version != (Version{1, 16, 0}) || capabilities.DHCHAPSecret {
+		t.Errorf("Unexpected capabilities %+v", capabilities)
+	}
+	GONVMEMock.InduceVersionError = true
+	if _, err = c.GetNVMeCLICapabilities(); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestDHCHAPKeys(t *testing.T) {
+	hostNQN := "nqn.2014-08.org.nvmexpress:uuid:02a08600-57d6-4089-8736-bf1f7326990e"
+	for _, tt := range []struct {
+		hash   DHCHAPHash
+		length int
+		prefix string
+	}{
+		{DHCHAPHashNone, 0, "DHHC-1:00:"},
+		{DHCHAPHashNone, 64, "DHHC-1:00:"},
+		{DHCHAPHashSHA256, 0, "DHHC-1:01:"},
+		{DHCHAPHashSHA384, 48, "DHHC-1:02:"},
+		{DHCHAPHashSHA512, 0, "DHHC-1:03:"},
+	} {
+		key, err := GenerateDHCHAPKey(tt.hash, tt.length, hostNQN)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !strings.HasPrefix(key, tt.prefix) {
+			t.Errorf("Expected a key starting with %s, but got %s", tt.prefix, key)
+		}
+		if err = ValidateDHCHAPKey(key); err != nil {
+			t.Errorf("Expected %s to be valid, but got %v", key, err)
+		}
+	}
+	if _, err := GenerateDHCHAPKey(DHCHAPHashSHA256, 64, hostNQN); err == nil {
+		t.Error("Expected an error for a key length not matching the hash")
+	}
+	if _, err := GenerateDHCHAPKey(DHCHAPHashSHA256, 0, ""); err == nil {
+		t.Error("Expected an error for a transformed key without host NQN")
+	}
+
+	key, _ := GenerateDHCHAPKey(DHCHAPHashNone, 32, "")
+	fields := strings.Split(key, ":")
+	data, _ := base64.StdEncoding.DecodeString(fields[2])
+	data[0] ^= 0xff
+	for _, invalid := range []string{
+		"",
+		"DHHC-1:00:" + fields[2],
+		"DHHC-2:00:" + fields[2] + ":",
+		"DHHC-1:04:" + fields[2] + ":",
+		"DHHC-1:02:" + fields[2] + ":",
+		"DHHC-1:00:not base64:",
+		"DHHC-1:00:" + base64.StdEncoding.EncodeToString(data) + ":",
+		"DHHC-1:00:" + base64.StdEncoding.EncodeToString(make([]byte, 20)) + ":",
+	} {
+		if err := ValidateDHCHAPKey(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+
+	compareStr(t, RedactSecrets("nvme connect --dhchap-secret="+key+" --dhchap-ctrl-secret="+key),
+		"nvme connect --dhchap-secret=DHHC-1:00:<redacted>: --dhchap-ctrl-secret=DHHC-1:00:<redacted>:")
+}
+
+func TestNVMeConnectDHCHAP(t *testing.T) {
+	reset()
+	hostKey, _ := GenerateDHCHAPKey(DHCHAPHashNone, 32, "")
+	ctrlKey, _ := GenerateDHCHAPKey(DHCHAPHashNone, 48, "")
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"version":  {stdout: "nvme version 2.8 (git 2.8)\nlibnvme version 1.8 (git 1.8)\n"},
+		"connect":  {},
+		"discover": {stdoutFile: "testdata/discovery_tcp_v2.json"},
+	}}
+	c := NewNVMe(map[string]string{DHCHAPHostSecret: hostKey}, WithCommandRunner(runner))
+
+	// the keys of the target take precedence over those of the options
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, DHCHAPSecret: hostKey, DHCHAPCtrlSecret: ctrlKey}
+	if err := c.NVMeTCPConnect(tgt, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme connect -t tcp -n "+testTarget+" -a 10.230.1.1 -s 4420 --ctrl-loss-tmo=-1 --dhchap-secret="+hostKey+" --dhchap-ctrl-secret="+ctrlKey)
+
+	if _, err := c.DiscoverNVMeTCPTargets("10.230.1.1:8009", false); err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme discover -t tcp -a 10.230.1.1 -s 8009 --dhchap-secret="+hostKey+" -o json")
+
+	tgt.DHCHAPSecret = ""
+	if err := c.NVMeTCPConnect(tgt, false); err == nil {
+		t.Error("Expected an error for a controller key without host key")
+	}
+
+	// a rejected key is reported without the key
+	runner.responses["connect"] = fakeCommandResponse{stderr: "could not add new controller: failed to write to nvme-fabrics device\nfailed to connect with " + hostKey + ": Key was rejected by service\n", exitCode: 1}
+	err := c.NVMeFCConnect(NVMeTarget{Portal: "nn-0x1:pn-0x2", HostAdr: "nn-0x3:pn-0x4", TargetNqn: testTarget}, false)
+	if !errors.Is(err, ErrAuthFailed) || strings.Contains(err.Error(), hostKey) {
+		t.Errorf("Expected a redacted authentication failure, but got %v", err)
+	}
+
+	// nvme-cli 1.x does not support in-band authentication
+	runner.responses["version"] = fakeCommandResponse{stdout: "nvme version 1.16\n"}
+	c = NewNVMe(map[string]string{DHCHAPHostSecret: hostKey}, WithCommandRunner(runner))
+	if err = c.NVMeRDMAConnect(NVMeTarget{Portal: "10.230.2.1", TargetNqn: testTarget}, false); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported, but got %v", err)
+	}
+
+	c = NewNVMe(map[string]string{DHCHAPHostSecret: hostKey, DiscoveryBackend: BackendNative})
+	if _, err = c.DiscoverNVMeTCPTargets("10.230.1.1", false); err == nil {
+		t.Error("Expected an error for an authenticated native discovery")
+	}
+}
+
+func TestFabricsConnectDHCHAP(t *testing.T) {
+	reset()
+	hostKey, _ := GenerateDHCHAPKey(DHCHAPHashNone, 32, "")
+	device := &fakeFabricsDevice{response: "instance=3,cntlid=1\n"}
+	c := NewNVMe(map[string]string{ChrootDirectory: t.TempDir(), ConnectBackend: BackendFabrics, DHCHAPHostSecret: hostKey})
+	c.openFabrics = func(string) (io.ReadWriteCloser, error) { return device, nil }
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}
+	if err := c.NVMeTCPConnect(tgt, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(device.written, ",dhchap_secret="+hostKey+",") {
+		t.Errorf("Unexpected connect options %s", device.written)
+	}
+
+	device.writeErr = syscall.EKEYREJECTED
+	if err := c.NVMeTCPConnect(tgt, false); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Expected ErrAuthFailed, but got %v", err)
+	}
+}
+
+func TestMockDHCHAP(t *testing.T) {
+	reset()
+	hostKey, _ := GenerateDHCHAPKey(DHCHAPHashNone, 32, "")
+	c := NewMockNVMe(map[string]string{DHCHAPHostSecret: hostKey})
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}
+	if err := c.NVMeTCPConnect(tgt, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	tgt.DHCHAPSecret = "DHHC-1:00:invalid:"
+	if err := c.NVMeTCPConnect(tgt, false); err == nil {
+		t.Error("Expected an error for an invalid key")
+	}
+
+	GONVMEMock.InduceAuthError = true
+	if _, err := c.DiscoverNVMeTCPTargets("10.230.1.1", false); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Expected ErrAuthFailed, but got %v", err)
+	}
+	if err := c.NVMeRDMAConnect(NVMeTarget{Portal: "10.230.2.1", TargetNqn: testTarget}, false); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Expected ErrAuthFailed, but got %v", err)
+	}
+}
+
+func TestTLSKeys(t *testing.T) {
+	hostNQN := "nqn.2014-08.org.nvmexpress:uuid:02a08600-57d6-4089-8736-bf1f7326990e"
+	keyString := "NVMeTLSkey-1:01:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh+KfiaR:"
+	key, err := ParseTLSKey(keyString)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if key.Hash != TLSHashSHA256 || len(key.PSK) != 32 || key.PSK[31] != 31 {
+		t.Errorf("Unexpected key %+v", key)
+	}
+	compareStr(t, key.String(), keyString)
+
+	retained, err := DeriveRetainedPSK(key, hostNQN)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, fmt.Sprintf("%x", retained), "133cc9c52844e8f1e1457eb799958c1d24b1b963e5ed4786fb1d96bca57b4152")
+	if _, err = DeriveRetainedPSK(key, ""); err == nil {
+		t.Error("Expected an error without host NQN")
+	}
+	compareStr(t, TLSPSKIdentity(key, hostNQN, testTarget), "NVMe0R01 "+hostNQN+" "+testTarget)
+
+	key384 := TLSKey{Hash: TLSHashSHA384, PSK: make([]byte, 48)}
+	if parsed, err := ParseTLSKey(key384.String()); err != nil || parsed.Hash != TLSHashSHA384 {
+		t.Errorf("Expected a SHA-384 key, but got %+v, %v", parsed, err)
+	}
+	if retained, err = DeriveRetainedPSK(key384, hostNQN); err != nil || len(retained) != 48 {
+		t.Errorf("Expected a retained PSK of 48 bytes, but got %x, %v", retained, err)
+	}
+
+	// a PSK without hash keeps its hash indicator and is retained as is
+	keyNone := TLSKey{Hash: TLSHashNone, PSK: make([]byte, 48)}
+	for i := range keyNone.PSK {
+		keyNone.PSK[i] = byte(i)
+	}
+	noneString := keyNone.String()
+	parsed, err := ParseTLSKey(noneString)
+	if err != nil || parsed.Hash != TLSHashNone || len(parsed.PSK) != 48 {
+		t.Errorf("Expected a 48 bytes PSK without hash, but got %+v, %v", parsed, err)
+	}
+	compareStr(t, parsed.String(), noneString)
+	if retained, err = DeriveRetainedPSK(parsed, hostNQN); err != nil || !bytes.Equal(retained, keyNone.PSK) {
+		t.Errorf("Expected the PSK to be retained as is, but got %x, %v", retained, err)
+	}
+	compareStr(t, TLSPSKIdentity(parsed, hostNQN, testTarget), "NVMe0R02 "+hostNQN+" "+testTarget)
+
+	for _, invalid := range []string{
+		"",
+		"NVMeTLSkey-1:01:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh+KfiaR",
+		"NVMeTLSkey-1:03:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh+KfiaR:",
+		"NVMeTLSkey-1:02:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh+KfiaR:",
+		"NVMeTLSkey-1:01:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh+KfiaS:",
+		"DHHC-1:01:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh+KfiaR:",
+	} {
+		if _, err = ParseTLSKey(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+	compareStr(t, RedactSecrets("--tls_key="+keyString), "--tls_key=NVMeTLSkey-1:01:<redacted>:")
+}
+
+func TestNVMeTCPConnectTLS(t *testing.T) {
+	reset()
+	keyString := "NVMeTLSkey-1:01:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh+KfiaR:"
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"version":  {stdout: "nvme version 2.8 (git 2.8)\nlibnvme version 1.8 (git 1.8)\n"},
+		"discover": {stdoutFile: "testdata/discovery_tcp_tls.json"},
+		"connect":  {},
+	}}
+	c := NewNVMe(map[string]string{TLSKeyring: ".nvme-test"}, WithCommandRunner(runner))
+
+	// a secure channel is selected for the entry which requires one
+	targets, err := c.DiscoverNVMeTCPTargets("10.230.1.1", true)
+	if err != nil || len(targets) != 2 {
+		t.Fatalf("Unexpected targets %v, %v", targets, err)
+	}
+	if len(runner.calls) != 3 {
+		t.Fatalf("Expected a discovery and two connects, but got %v", runner.calls)
+	}
+	compareStr(t, strings.Join(runner.calls[1], " "), "nvme connect -t tcp -n "+targets[0].TargetNqn+" -a 10.230.1.1 -s 4420 --ctrl-loss-tmo=-1 --tls --keyring=.nvme-test")
+	compareStr(t, strings.Join(runner.calls[2], " "), "nvme connect -t tcp -n "+targets[1].TargetNqn+" -a 10.230.1.1 -s 4421 --ctrl-loss-tmo=-1")
+
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, TLSKey: keyString}
+	if err = c.NVMeTCPConnect(tgt, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme connect -t tcp -n "+testTarget+" -a 10.230.1.1 -s 4420 --ctrl-loss-tmo=-1 --tls --tls_key="+keyString+" --keyring=.nvme-test")
+
+	tgt.TLSKey = "NVMeTLSkey-1:01:invalid:"
+	if err = c.NVMeTCPConnect(tgt, false); err == nil {
+		t.Error("Expected an error for an invalid PSK")
+	}
+
+	// nvme-cli 2.3 has no TLS support
+	runner.responses["version"] = fakeCommandResponse{stdout: "nvme version 2.3 (git 2.3)\nlibnvme version 1.3 (git 1.3)\n"}
+	c = NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	if err = c.NVMeTCPConnect(NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, TLS: true}, false); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported, but got %v", err)
+	}
+}
+
+func TestFabricsConnectTLS(t *testing.T) {
+	reset()
+	device := &fakeFabricsDevice{response: "instance=3,cntlid=1\n"}
+	c := NewNVMe(map[string]string{ChrootDirectory: t.TempDir(), ConnectBackend: BackendFabrics})
+	c.openFabrics = func(string) (io.ReadWriteCloser, error) { return device, nil }
+	tgt := NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget, Treq: "required"}
+	if err := c.NVMeTCPConnect(tgt, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.HasSuffix(device.written, ",ctrl_loss_tmo=-1") || !strings.Contains(device.written, ",tls,") {
+		t.Errorf("Unexpected connect options %s", device.written)
+	}
+	tgt.TLSKey = "NVMeTLSkey-1:01:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh+KfiaR:"
+	if err := c.NVMeTCPConnect(tgt, false); err == nil {
+		t.Error("Expected an error for a PSK outside the keyring")
+	}
+}
+
+func TestConnectOptions(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{"connect": {}}}
+	c := NewNVMe(map[string]string{ConnectCtrlLossTmo: "600", ConnectKeepAliveTmo: "5", ConnectHostIface: "ens1f0"}, WithCommandRunner(runner))
+	fastIOFailTmo := 0
+	result, err := c.NVMeTCPConnectWithOptions(context.Background(), NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}, ConnectOptions{
+		ReconnectDelay:   10,
+		KeepAliveTmo:     15,
+		FastIOFailTmo:    &fastIOFailTmo,
+		NrIOQueues:       4,
+		NrWriteQueues:    2,
+		NrPollQueues:     1,
+		QueueSize:        128,
+		HostNQN:          "nqn.2014-08.org.nvmexpress:uuid:02a08600-57d6-4089-8736-bf1f7326990e",
+		HostID:           "02a08600-57d6-4089-8736-bf1f7326990e",
+		HostTraddr:       "10.230.1.4",
+		DuplicateConnect: true,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme connect -t tcp -n "+testTarget+" -a 10.230.1.1 -s 4420 -w 10.230.1.4"+
+		" --ctrl-loss-tmo=600 --reconnect-delay=10 --keep-alive-tmo=15 --fast_io_fail_tmo=0 --nr-io-queues=4 --nr-write-queues=2"+
+		" --nr-poll-queues=1 --queue-size=128 --hostnqn=nqn.2014-08.org.nvmexpress:uuid:02a08600-57d6-4089-8736-bf1f7326990e"+
+		" --hostid=02a08600-57d6-4089-8736-bf1f7326990e --host-iface=ens1f0 -D")
+	// the options echo the defaults they were completed with
+	if *result.Options.CtrlLossTmo != 600 || result.Options.KeepAliveTmo != 15 || result.Options.HostIface != "ens1f0" || result.Options.HostTraddr != "10.230.1.4" {
+		t.Errorf("Unexpected options %+v", result.Options)
+	}
+
+	result, err = c.NVMeFCConnectWithOptions(context.Background(), NVMeTarget{Portal: fcTestPortal, HostAdr: hostAddress, TargetNqn: testTarget}, ConnectOptions{HostIface: "-"})
+	if err == nil {
+		t.Error("Expected an error for host-iface on NVMe/FC")
+	}
+	c = NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	if result, err = c.NVMeFCConnectWithOptions(context.Background(), NVMeTarget{Portal: fcTestPortal, HostAdr: hostAddress, TargetNqn: testTarget}, ConnectOptions{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme connect -t fc -a "+fcTestPortal+" -w "+hostAddress+" -n "+testTarget+" --ctrl-loss-tmo=-1")
+	if *result.Options.CtrlLossTmo != DefaultCtrlLossTmo || result.Options.HostTraddr != hostAddress {
+		t.Errorf("Unexpected options %+v", result.Options)
+	}
+
+	invalid := -2
+	for _, options := range []ConnectOptions{
+		{CtrlLossTmo: &invalid},
+		{FastIOFailTmo: &invalid},
+		{ReconnectDelay: -1},
+		{NrIOQueues: -1},
+		{QueueSize: 8},
+		{QueueSize: 2048},
+		{HostNQN: "host"},
+		{HostNQN: "nqn." + strings.Repeat("a", 220)},
+		{HostID: "not a uuid"},
+		{HostIface: "a/b"},
+	} {
+		if _, err = c.NVMeTCPConnectWithOptions(context.Background(), NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}, options); err == nil {
+			t.Errorf("Expected an error for %+v", options)
+		}
+	}
+	c = NewNVMe(map[string]string{ConnectQueueSize: "large"}, WithCommandRunner(runner))
+	if err = c.NVMeTCPConnect(NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}, false); err == nil {
+		t.Error("Expected an error for an invalid default")
+	}
+}
+
+func TestFabricsConnectOptions(t *testing.T) {
+	reset()
+	device := &fakeFabricsDevice{response: "instance=3,cntlid=1\n"}
+	c := NewNVMe(map[string]string{ChrootDirectory: t.TempDir(), ConnectBackend: BackendFabrics, ConnectNrIOQueues: "8"})
+	c.openFabrics = func(string) (io.ReadWriteCloser, error) { return device, nil }
+	ctrlLossTmo := 0
+	_, err := c.NVMeTCPConnectWithOptions(context.Background(), NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}, ConnectOptions{
+		CtrlLossTmo: &ctrlLossTmo,
+		HostNQN:     "nqn.2014-08.org.nvmexpress:uuid:02a08600-57d6-4089-8736-bf1f7326990e",
+		HostIface:   "ens1f0",
+		HostTraddr:  "10.230.1.4",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, device.written, "nqn="+testTarget+",transport=tcp,traddr=10.230.1.1,trsvcid=4420,host_traddr=10.230.1.4,"+
+		"hostnqn=nqn.2014-08.org.nvmexpress:uuid:02a08600-57d6-4089-8736-bf1f7326990e,ctrl_loss_tmo=0,nr_io_queues=8,host_iface=ens1f0")
+}
+
+func TestMockConnectOptions(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{ConnectReconnectDelay: "5"})
+	result, err := c.NVMeRDMAConnectWithOptions(context.Background(), NVMeTarget{Portal: "10.230.2.1", TargetNqn: testTarget}, ConnectOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Options.ReconnectDelay != 5 || *result.Options.CtrlLossTmo != DefaultCtrlLossTmo {
+		t.Errorf("Unexpected options %+v", result.Options)
+	}
+	GONVMEMock.InduceRDMALoginError = true
+	if _, err = c.NVMeRDMAConnectWithOptions(context.Background(), NVMeTarget{Portal: "10.230.2.1", TargetNqn: testTarget}, ConnectOptions{}); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestValidateNQN(t *testing.T) {
+	for _, nqn := range []string{
+		"nqn.2014-08.org.nvmexpress:uuid:02a08600-57d6-4089-8736-bf1f7326990e",
+		"nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D",
+		"nqn.2014-08.org.nvmexpress.discovery",
+		"nqn.2014-08.org.mock:uuid:02a08600-0000-0000-0000-bf1f7326990e",
+	} {
+		if err := ValidateNQN(nqn); err != nil {
+			t.Errorf("Expected %s to be valid, but got %v", nqn, err)
+		}
+	}
+	for _, nqn := range []string{
+		"",
+		"iqn.2014-08.org.nvmexpress:host",
+		"nqn.2014-13.org.nvmexpress:host",
+		"nqn.14-08.org.nvmexpress:host",
+		"nqn.2014-08.-org:host",
+		"nqn.2014-08.org.nvmexpress:uuid:not-a-uuid",
+		"nqn.2014-08.com.dell:" + strings.Repeat("a", 203),
+	} {
+		if err := ValidateNQN(nqn); err == nil {
+			t.Errorf("Expected %q to be invalid", nqn)
+		}
+	}
+
+	nqn, hostID, err := GenerateHostNQN()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if ValidateNQN(nqn) != nil || !(HostIdentity{HostNQN: nqn, HostID: hostID}).Consistent() {
+		t.Errorf("Unexpected host NQN %s and host ID %s", nqn, hostID)
+	}
+}
+
+func TestEnsureHostIdentity(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	c := NewNVMe(map[string]string{ChrootDirectory: root})
+	identity, err := c.GetHostIdentity()
+	if err != nil || identity.HostNQN != "" || identity.HostID != "" {
+		t.Fatalf("Expected no host identity, but got %+v, %v", identity, err)
+	}
+
+	// the host NQN is derived from the DMI product UUID
+	dmi := filepath.Join(root, sysfsDMIProductUUID)
+	_ = os.MkdirAll(filepath.Dir(dmi), 0o755)
+	_ = os.WriteFile(dmi, []byte("4C4C4544-0051-3510-8057-B7C04F4E4432\n"), 0o600)
+	if identity, err = c.EnsureHostIdentity(true); err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, identity.HostNQN, UUIDHostNQNPrefix+"4c4c4544-0051-3510-8057-b7c04f4e4432")
+	compareStr(t, identity.HostID, "4c4c4544-0051-3510-8057-b7c04f4e4432")
+	data, _ := os.ReadFile(filepath.Join(root, DefaultInitiatorNameFile))
+	compareStr(t, string(data), identity.HostNQN+"\n")
+	data, _ = os.ReadFile(filepath.Join(root, DefaultHostIDFile))
+	compareStr(t, string(data), identity.HostID+"\n")
+
+	// a host ID which does not match the host NQN is rewritten, duplicates are removed
+	_ = os.WriteFile(filepath.Join(root, DefaultInitiatorNameFile), []byte(identity.HostNQN+"\r\nnqn.1988-11.com.dell:host1\n"+identity.HostNQN+"\n"), 0o600)
+	_ = os.WriteFile(filepath.Join(root, DefaultHostIDFile), []byte("02a08600-57d6-4089-8736-bf1f7326990e\n"), 0o600)
+	if identity, err = c.GetHostIdentity(); err != nil || identity.Consistent() || len(identity.DuplicateNQNs) != 1 {
+		t.Errorf("Expected an inconsistent identity with a duplicate, but got %+v, %v", identity, err)
+	}
+	if identity, err = c.EnsureHostIdentity(false); err != nil || identity.HostID != "4c4c4544-0051-3510-8057-b7c04f4e4432" {
+		t.Errorf("Unexpected identity %+v, %v", identity, err)
+	}
+	data, _ = os.ReadFile(filepath.Join(root, DefaultInitiatorNameFile))
+	compareStr(t, string(data), identity.HostNQN+"\nnqn.1988-11.com.dell:host1\n")
+
+	// a host NQN not derived from a UUID keeps its host ID, or gets a random one
+	_ = os.Remove(filepath.Join(root, DefaultHostIDFile))
+	_ = os.WriteFile(filepath.Join(root, DefaultInitiatorNameFile), []byte("nqn.1988-11.com.dell:host1\n"), 0o600)
+	if identity, err = c.EnsureHostIdentity(true); err != nil || identity.HostNQN != "nqn.1988-11.com.dell:host1" {
+		t.Fatalf("Unexpected identity %+v, %v", identity, err)
+	}
+	if _, err = parseUUID(identity.HostID); err != nil {
+		t.Errorf("Expected a random host ID, but got %v", err)
+	}
+
+	if err = c.SetHostIdentity(HostIdentity{HostNQN: UUIDHostNQNPrefix + "02a08600-57d6-4089-8736-bf1f7326990e", HostID: "4c4c4544-0051-3510-8057-b7c04f4e4432"}); err == nil {
+		t.Error("Expected an error for an inconsistent identity")
+	}
+	if err = c.SetHostIdentity(HostIdentity{HostNQN: "nqn.1988-11.com.dell:host2", HostID: "4c4c4544-0051-3510-8057-b7c04f4e4432"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if identity, err = c.GetHostIdentity(); err != nil || identity.HostNQN != "nqn.1988-11.com.dell:host2" {
+		t.Errorf("Unexpected identity %+v, %v", identity, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(root, "etc/nvme/.*")); len(files) != 0 {
+		t.Errorf("Unexpected temporary files %v", files)
+	}
+}
+
+func TestMockHostIdentity(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{})
+	identity, err := c.EnsureHostIdentity(false)
+	if err != nil || !identity.Consistent() {
+		t.Errorf("Unexpected identity %+v, %v", identity, err)
+	}
+	if err = c.SetHostIdentity(HostIdentity{HostNQN: "host"}); err == nil {
+		t.Error("Expected an error for an invalid identity")
+	}
+	GONVMEMock.InduceInitiatorError = true
+	if _, err = c.GetHostIdentity(); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestDiscoveryConf(t *testing.T) {
+	conf := `# Used for extracting default parameters for discovery
+#
+-t tcp -a 10.230.1.1 -s 8009 -w 10.230.1.4
+--transport=tcp --traddr=fe80::1%eth0 --nr-io-queues 4 --tls -D
+--transport=fc --traddr=nn-0x58ccf090c9200c22:pn-0x58ccf091492b0c22 --host-traddr=nn-0x20000090fae0b5f5:pn-0x10000090fae0b5f5
+`
+	targets, err := ParseDiscoveryConf([]byte(conf))
+	if err != nil || len(targets) != 3 {
+		t.Fatalf("Expected 3 targets, but got %+v: %v", targets, err)
+	}
+	compareStr(t, targets[0].Portal, "10.230.1.1")
+	compareStr(t, targets[0].TrsvcID, "8009")
+	compareStr(t, targets[0].HostAdr, "10.230.1.4")
+	compareStr(t, targets[1].Portal, "fe80::1%eth0")
+	if !targets[1].TLS {
+		t.Error("Expected a TLS target")
+	}
+	compareStr(t, targets[2].TargetType, NVMeTransportTypeFC)
+
+	again, err := ParseDiscoveryConf(FormatDiscoveryConf(targets))
+	if err != nil || !reflect.DeepEqual(again, targets) {
+		t.Errorf("Expected %+v after a round trip, but got %+v: %v", targets, again, err)
+	}
+
+	for _, line := range []string{"-t tcp", "-a 10.230.1.1", "-t tcp -a", "tcp 10.230.1.1"} {
+		if _, err = ParseDiscoveryConf([]byte(line)); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
+
+func TestFabricsConfig(t *testing.T) {
+	data, err := os.ReadFile("testdata/fabrics_config.json")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	config, err := ParseFabricsConfig(data)
+	if err != nil || len(config) != 1 || len(config[0].Subsystems) != 2 {
+		t.Fatalf("Unexpected configuration %+v: %v", config, err)
+	}
+	port := config[0].Subsystems[0].Ports[0]
+	if port.CtrlLossTmo == nil || *port.CtrlLossTmo != -1 || !port.TLS {
+		t.Errorf("Unexpected port %+v", port)
+	}
+	compareStr(t, config[0].Subsystems[0].Ports[1].HostIface, "eth0")
+
+	targets := config.Targets()
+	if len(targets) != 3 {
+		t.Fatalf("Expected 3 targets, but got %+v", targets)
+	}
+	compareStr(t, targets[0].TargetNqn, "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D")
+	compareStr(t, targets[0].HostAdr, "10.230.1.4")
+	compareStr(t, targets[2].TargetType, NVMeTransportTypeFC)
+
+	identity := HostIdentity{HostNQN: config[0].HostNQN, HostID: config[0].HostID}
+	converted := NewFabricsConfig(identity, targets)
+	if !reflect.DeepEqual(converted.Targets(), targets) {
+		t.Errorf("Expected %+v after a round trip, but got %+v", targets, converted.Targets())
+	}
+
+	formatted, err := config.Format()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	again, err := ParseFabricsConfig(formatted)
+	if err != nil || !reflect.DeepEqual(again, config) {
+		t.Errorf("Expected %+v after a round trip, but got %+v: %v", config, again, err)
+	}
+	if _, err = ParseFabricsConfig([]byte("{")); err == nil {
+		t.Error("Expected an error for a malformed configuration")
+	}
+}
+
+func TestConfigFiles(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	c := NewNVMe(map[string]string{ChrootDirectory: root})
+	targets, err := c.GetDiscoveryConf()
+	if err != nil || len(targets) != 0 {
+		t.Errorf("Expected no discovery controllers, but got %+v: %v", targets, err)
+	}
+	config, err := c.GetFabricsConfig()
+	if err != nil || len(config) != 0 {
+		t.Errorf("Expected no configuration, but got %+v: %v", config, err)
+	}
+
+	targets = []NVMeTarget{{Portal: "10.230.1.1", TrType: NVMeTransportTypeTCP, TargetType: NVMeTransportTypeTCP, TrsvcID: NVMeDiscoveryPort}}
+	if err = c.SetDiscoveryConf(targets); err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, err := c.GetDiscoveryConf(); err != nil || !reflect.DeepEqual(got, targets) {
+		t.Errorf("Expected %+v, but got %+v: %v", targets, got, err)
+	}
+	info, err := os.Stat(filepath.Join(root, DefaultDiscoveryConfFile))
+	if err != nil || info.Mode().Perm() != configFileMode {
+		t.Errorf("Unexpected discovery.conf %v: %v", info, err)
+	}
+	if err = c.SetDiscoveryConf([]NVMeTarget{{Portal: "10.230.1.1"}}); err == nil {
+		t.Error("Expected an error for a target without transport")
+	}
+	// the transport may be set as TargetType alone, as for connects
+	if err = c.SetDiscoveryConf([]NVMeTarget{{Portal: "10.230.1.2", TargetType: NVMeTransportTypeTCP}}); err != nil {
+		t.Error(err.Error())
+	}
+	if got, err := c.GetDiscoveryConf(); err != nil || len(got) != 1 || got[0].TrType != NVMeTransportTypeTCP {
+		t.Errorf("Expected a TCP discovery controller, but got %+v: %v", got, err)
+	}
+
+	config = NewFabricsConfig(HostIdentity{HostNQN: "nqn.1988-11.com.dell:host1"}, []NVMeTarget{{Portal: "10.230.1.1", TargetNqn: testTarget, TrType: NVMeTransportTypeTCP}})
+	if err = c.SetFabricsConfig(config); err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, err := c.GetFabricsConfig(); err != nil || !reflect.DeepEqual(got, config) {
+		t.Errorf("Expected %+v, but got %+v: %v", config, got, err)
+	}
+	config[0].HostNQN = "host1"
+	if err = c.SetFabricsConfig(config); err == nil {
+		t.Error("Expected an error for an invalid host NQN")
+	}
+}
+
+func TestExportSessions(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "etc/nvme"), 0o755)
+	_ = os.WriteFile(filepath.Join(root, DefaultInitiatorNameFile), []byte("nqn.1988-11.com.dell:host1\n"), 0o600)
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"list-subsys": {stdoutFile: "testdata/session_info_valid"},
+	}}
+	c := NewNVMe(map[string]string{ChrootDirectory: root}, WithCommandRunner(runner))
+	config, err := c.ExportSessions()
+	if err != nil || len(config) != 1 {
+		t.Fatalf("Unexpected configuration %+v: %v", config, err)
+	}
+	compareStr(t, config[0].HostNQN, "nqn.1988-11.com.dell:host1")
+	if len(config[0].Subsystems) != 1 || len(config[0].Subsystems[0].Ports) != 1 {
+		t.Fatalf("Expected the live session only, but got %+v", config[0].Subsystems)
+	}
+	port := config[0].Subsystems[0].Ports[0]
+	if port != (ConfigPort{Transport: NVMeTransportTypeTCP, TrAddr: "10.230.1.1", TrSvcID: "4420"}) {
+		t.Errorf("Unexpected port %+v", port)
+	}
+}
+
+func TestMockFabricsConfig(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{MockNumberOfSessions: "2"})
+	config, err := c.ExportSessions()
+	if err != nil || len(config) != 1 || len(config[0].Subsystems) != 2 {
+		t.Errorf("Unexpected configuration %+v: %v", config, err)
+	}
+	if err = c.SetFabricsConfig(config); err != nil {
+		t.Error(err.Error())
+	}
+	targets, err := c.GetDiscoveryConf()
+	if err != nil || len(targets) != 1 {
+		t.Errorf("Expected a discovery controller, but got %+v: %v", targets, err)
+	}
+	if err = c.SetDiscoveryConf(targets); err != nil {
+		t.Error(err.Error())
+	}
+	GONVMEMock.InduceConfigError = true
+	if _, err = c.GetFabricsConfig(); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+type fakeEventSource struct {
+	events chan DiscoveryEvent
+	err    error
+}
+
+func (s *fakeEventSource) Events(_ context.Context) (<-chan DiscoveryEvent, error) {
+	return s.events, s.err
+}
+
+func receiveChange(t *testing.T, changes <-chan DiscoveryChange) DiscoveryChange {
+	t.Helper()
+	select {
+	case change, ok := <-changes:
+		if !ok {
+			t.Fatal("Expected a change, but the watch ended")
+		}
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change, but got none")
+	}
+	return DiscoveryChange{}
+}
+
+func TestWatchDiscovery(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"discover": {stdoutFile: "testdata/discovery_tcp_v2.json"},
+	}}
+	source := &fakeEventSource{events: make(chan DiscoveryEvent)}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner), WithDiscoveryEventSource(source))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := c.WatchDiscovery(ctx, DiscoveryWatchOptions{Address: "10.230.1.1", PollInterval: -1})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	change := receiveChange(t, changes)
+	if len(change.Added) != 2 || len(change.Removed) != 0 || change.GenCtr != 12 {
+		t.Errorf("Unexpected initial change %+v", change)
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme discover -t tcp -a 10.230.1.1 -s 8009 --persistent -o json")
+
+	// events of other discovery controllers are ignored
+	source.events <- DiscoveryEvent{Controller: "nvme2", Transport: "tcp", TrAddr: "10.230.1.9", TrSvcID: "8009"}
+	runner.mu.Lock()
+	runner.responses["discover"] = fakeCommandResponse{stdoutFile: "testdata/discovery_tcp_v2_cntlid.json"}
+	runner.mu.Unlock()
+	source.events <- DiscoveryEvent{Controller: "nvme3", Transport: "tcp", TrAddr: "10.230.1.1", TrSvcID: "8009"}
+	change = receiveChange(t, changes)
+	if len(change.Added) != 1 || change.Added[0].Portal != "10.230.1.2" || len(change.Removed) != 1 || change.Removed[0].TrsvcID != "8009" || change.GenCtr != 13 {
+		t.Errorf("Unexpected change %+v", change)
+	}
+	runner.mu.Lock()
+	if len(runner.calls) != 2 {
+		t.Errorf("Expected 2 discoveries, but got %v", runner.calls)
+	} else {
+		// the discovery controller which sent the event is reused
+		compareStr(t, strings.Join(runner.calls[1], " "), "nvme discover -t tcp -a 10.230.1.1 -s 8009 --persistent --device=nvme3 -o json")
+	}
+	runner.responses["discover"] = fakeCommandResponse{stderr: "failed to connect\n", exitCode: 1}
+	runner.mu.Unlock()
+	source.events <- DiscoveryEvent{Controller: "nvme3", Transport: "tcp", TrAddr: "10.230.1.1", TrSvcID: "8009"}
+	if change = receiveChange(t, changes); change.Err == nil {
+		t.Errorf("Expected an error, but got %+v", change)
+	}
+
+	cancel()
+	for range changes {
+	}
+
+	runner.responses["discover"] = fakeCommandResponse{exitCode: 1}
+	if _, err = c.WatchDiscovery(context.Background(), DiscoveryWatchOptions{Address: "10.230.1.1"}); err == nil {
+		t.Error("Expected an error for a failed discovery")
+	}
+	if _, err = c.WatchDiscovery(context.Background(), DiscoveryWatchOptions{Transport: NVMeTransportTypeFC, Address: "nn-0x1:pn-0x2"}); err == nil {
+		t.Error("Expected an error for NVMe/FC without host address")
+	}
+}
+
+func TestWatchDiscoveryReusesController(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	for name, attributes := range map[string]map[string]string{
+		"nvme1": {"subsysnqn": testTarget, "transport": "tcp", "state": "live", "address": "traddr=10.230.1.1,trsvcid=4420"},
+		"nvme4": {"subsysnqn": nvmetcp.DiscoveryNQN, "transport": "tcp", "state": "live", "address": "traddr=10.230.1.1,trsvcid=8009,src_addr=10.230.1.4"},
+	} {
+		dir := filepath.Join(root, sysfsNVMeClass, name)
+		_ = os.MkdirAll(dir, 0o755)
+		for attribute, value := range attributes {
+			_ = os.WriteFile(filepath.Join(dir, attribute), []byte(value+"\n"), 0o600)
+		}
+	}
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"discover": {stdoutFile: "testdata/discovery_tcp_v2.json"},
+	}}
+	c := NewNVMe(map[string]string{SysfsRoot: root}, WithCommandRunner(runner))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := c.WatchDiscovery(ctx, DiscoveryWatchOptions{Address: "10.230.1.1", PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	receiveChange(t, changes)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runner.mu.Lock()
+		calls := len(runner.calls)
+		runner.mu.Unlock()
+		if calls >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	for range changes {
+	}
+	if len(runner.calls) < 2 {
+		t.Fatalf("Expected the discovery log to be polled, but got %v", runner.calls)
+	}
+	compareStr(t, strings.Join(runner.calls[0], " "), "nvme discover -t tcp -a 10.230.1.1 -s 8009 --persistent -o json")
+	compareStr(t, strings.Join(runner.calls[1], " "), "nvme discover -t tcp -a 10.230.1.1 -s 8009 --persistent --device=nvme4 -o json")
+}
+
+func TestWatchDiscoveryPoll(t *testing.T) {
+	reset()
+	controller := startDiscoveryController(t, gonvmetest.TCPEntry(testTarget, "10.230.1.1", "4420"))
+	c := NewNVMe(map[string]string{DiscoveryBackend: BackendNative, ChrootDirectory: t.TempDir()},
+		WithDiscoveryEventSource(&fakeEventSource{err: errors.New("no uevents")}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := c.WatchDiscovery(ctx, DiscoveryWatchOptions{Address: controller.Address(), PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if change := receiveChange(t, changes); len(change.Added) != 1 {
+		t.Errorf("Unexpected initial change %+v", change)
+	}
+	if err = controller.SetEntries(gonvmetest.TCPEntry(testTarget, "10.230.1.2", "4420")); err != nil {
+		t.Fatal(err.Error())
+	}
+	change := receiveChange(t, changes)
+	if len(change.Added) != 1 || change.Added[0].Portal != "10.230.1.2" || len(change.Removed) != 1 || change.Removed[0].Portal != "10.230.1.1" {
+		t.Errorf("Unexpected change %+v", change)
+	}
+}
+
+func TestParseDiscoveryUevent(t *testing.T) {
+	msg := []byte("change@/devices/virtual/nvme-fabrics/ctl/nvme3\x00ACTION=change\x00DEVPATH=/devices/virtual/nvme-fabrics/ctl/nvme3\x00" +
+		"SUBSYSTEM=nvme\x00NVME_EVENT=discovery\x00NVME_TRTYPE=tcp\x00NVME_TRADDR=10.230.1.1\x00NVME_TRSVCID=8009\x00" +
+		"NVME_HOST_TRADDR=none\x00DEVNAME=nvme3\x00SEQNUM=4711\x00")
+	event, ok := parseDiscoveryUevent(msg)
+	if !ok {
+		t.Fatal("Expected a discovery event")
+	}
+	expected := DiscoveryEvent{Controller: "nvme3", Transport: "tcp", TrAddr: "10.230.1.1", TrSvcID: "8009", HostTrAddr: "none"}
+	if event != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, event)
+	}
+	if _, ok = parseDiscoveryUevent(bytes.ReplaceAll(msg, []byte("NVME_EVENT=discovery"), []byte("NVME_AEN=0x70f002"))); ok {
+		t.Error("Expected no discovery event")
+	}
+}
+
+func TestMockWatchDiscovery(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{MockNumberOfTCPTargets: "2"})
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := c.WatchDiscovery(ctx, DiscoveryWatchOptions{Address: tcpTestPortal})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if change := receiveChange(t, changes); len(change.Added) != 2 {
+		t.Errorf("Unexpected change %+v", change)
+	}
+	cancel()
+	if _, ok := <-changes; ok {
+		t.Error("Expected the watch to end")
+	}
+	GONVMEMock.InduceDiscoveryError = true
+	if _, err = c.WatchDiscovery(context.Background(), DiscoveryWatchOptions{Address: tcpTestPortal}); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestGetNamespacePaths(t *testing.T) {
+	reset()
+	c := NewNVMe(map[string]string{SysfsRoot: "testdata/sysfs"})
+	namespaces, err := c.GetNamespacePaths()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []NVMeNamespacePaths{
+		{
+			Device: "nvme0n1", SubsystemNQN: "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D", NamespaceID: 1,
+			Paths: []NVMePath{
+				{Name: "nvme0c0n1", Controller: "nvme0", NamespaceID: 1, ANAGroupID: 1, ANAState: ANAStateOptimized, State: NVMESessionStateLive},
+				{Name: "nvme0c10n1", Controller: "nvme10", NamespaceID: 1, ANAGroupID: 1, ANAState: ANAStateInaccessible, State: NVMESessionStateConnecting},
+			},
+			OptimizedPaths: 1,
+		},
+		{
+			Device: "nvme0n2", SubsystemNQN: "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D", NamespaceID: 2,
+			Paths: []NVMePath{
+				{Name: "nvme0c0n2", Controller: "nvme0", NamespaceID: 2, ANAGroupID: 2, ANAState: ANAStateNonOptimized, State: NVMESessionStateLive},
+				{Name: "nvme0c10n2", Controller: "nvme10", NamespaceID: 2, ANAGroupID: 2, ANAState: ANAStateOptimized, State: NVMESessionStateConnecting},
+			},
+		},
+		{
+			Device: "nvme1n1", SubsystemNQN: "nqn.2014.08.org.nvmexpress:80868086PHKS7333001V1P6CGN  INTEL SSDPEKKA256G7L", NamespaceID: 1,
+			Paths: []NVMePath{{Name: "nvme1n1", Controller: "nvme1", NamespaceID: 1, State: NVMESessionStateLive}},
+		},
+	}
+	if !reflect.DeepEqual(namespaces, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, namespaces)
+	}
+
+	// the sysfs root defaults to the ChrootDirectory
+	c = NewNVMe(map[string]string{ChrootDirectory: "testdata/sysfs"})
+	if namespaces, err = c.GetNamespacePaths(); err != nil || len(namespaces) != 3 {
+		t.Errorf("Expected 3 namespaces, but got %+v: %v", namespaces, err)
+	}
+	c = NewNVMe(map[string]string{SysfsRoot: t.TempDir()})
+	if namespaces, err = c.GetNamespacePaths(); err != nil || len(namespaces) != 0 {
+		t.Errorf("Expected no namespaces, but got %+v: %v", namespaces, err)
+	}
+}
+
+func TestMockGetNamespacePaths(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{MockNumberOfNamespaceDevices: "2"})
+	namespaces, err := c.GetNamespacePaths()
+	if err != nil || len(namespaces) != 2 || namespaces[1].OptimizedPaths != 1 || !namespaces[1].Paths[0].Optimized() {
+		t.Errorf("Unexpected namespaces %+v: %v", namespaces, err)
+	}
+	GONVMEMock.InduceGetSessionsError = true
+	if _, err = c.GetNamespacePaths(); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestGetTopology(t *testing.T) {
+	reset()
+	c := NewNVMe(map[string]string{SysfsRoot: "testdata/sysfs", ChrootDirectory: t.TempDir()})
+	topology, err := c.GetTopology()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(topology.Subsystems) != 3 {
+		t.Fatalf("Expected 3 subsystems, but got %+v", topology.Subsystems)
+	}
+	subsystem := topology.Subsystems[0]
+	compareStr(t, subsystem.Name, "nvme-subsys0")
+	compareStr(t, subsystem.NQN, "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D")
+	compareStr(t, subsystem.Model, "PowerStore")
+	compareStr(t, subsystem.Serial, "FP08RZ2")
+	compareStr(t, subsystem.IOPolicy, "round-robin")
+	expectedControllers := []NVMeController{
+		{Name: "nvme0", CntlID: "1", Transport: NVMETransportNameTCP, Address: "traddr=10.230.1.1,trsvcid=4420,src_addr=10.230.1.4", State: NVMESessionStateLive},
+		{Name: "nvme10", CntlID: "2", Transport: NVMETransportNameTCP, Address: "traddr=10.230.1.2,trsvcid=4420", State: NVMESessionStateConnecting},
+	}
+	if !reflect.DeepEqual(subsystem.Controllers, expectedControllers) {
+		t.Errorf("Expected controllers %+v, but got %+v", expectedControllers, subsystem.Controllers)
+	}
+	if len(subsystem.Namespaces) != 2 {
+		t.Fatalf("Expected 2 namespaces, but got %+v", subsystem.Namespaces)
+	}
+	ns := subsystem.Namespaces[0]
+	if ns.NamespaceID != 1 || ns.Device != "/dev/nvme0n1" || ns.NGUID != "507911ecda65a2498ccf0968009a5d07" ||
+		ns.UUID != "507911ec-da65-a249-8ccf-0968009a5d07" || ns.Size != 5368709120 || len(ns.Paths) != 2 || ns.OptimizedPaths != 1 {
+		t.Errorf("Unexpected namespace %+v", ns)
+	}
+
+	// without native multipath the namespace is below its controller
+	ns = topology.Subsystems[1].Namespaces[0]
+	if ns.Device != "/dev/nvme1n1" || ns.EUI64 != "5cd2e42a81a11f6e" || ns.Size != 500118192*512 || len(ns.Paths) != 1 {
+		t.Errorf("Unexpected namespace %+v", ns)
+	}
+	if len(topology.Subsystems[2].Namespaces) != 0 || topology.Subsystems[2].Controllers[0].Transport != NVMETransportNameFC {
+		t.Errorf("Unexpected subsystem %+v", topology.Subsystems[2])
+	}
+}
+
+func TestMockGetTopology(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{MockNumberOfSessions: "2", MockNumberOfNamespaceDevices: "3"})
+	topology, err := c.GetTopology()
+	if err != nil || len(topology.Subsystems) != 2 || len(topology.Subsystems[0].Namespaces) != 3 || topology.HostID == "" {
+		t.Errorf("Unexpected topology %+v: %v", topology, err)
+	}
+	GONVMEMock.InduceGetSessionsError = true
+	if _, err = c.GetTopology(); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestClassifyExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		exitCode int
+		stderr   string
+		kind     error
+	}{
+		{NVMeNoObjsFoundExitCode, "", ErrNoObjectsFound},
+		{114, "Failed to write to /dev/nvme-fabrics: Operation already in progress", ErrAlreadyConnected},
+		{1, "already connected", ErrAlreadyConnected},
+		{70, "", nil},
+		{111, "", ErrTargetUnreachable},
+		{1, "could not add new controller: failed to connect", ErrTargetUnreachable},
+		{1, "Failed to write to /dev/nvme-fabrics: Connection refused", ErrTargetUnreachable},
+		{129, "", ErrAuthFailed},
+		{1, "Invalid argument", nil},
+		{-1, "", nil},
+	} {
+		if kind := classifyExitCode(tt.exitCode, tt.stderr); kind != tt.kind {
+			t.Errorf("Expected %v for exit code %d and %q, but got %v", tt.kind, tt.exitCode, tt.stderr, kind)
+		}
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	reset()
+	hostKey, _ := GenerateDHCHAPKey(DHCHAPHashNone, 32, "")
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"connect": {stderr: "Failed to write to /dev/nvme-fabrics: Connection refused\n", exitCode: 111},
+	}}
+	c := NewNVMe(map[string]string{DHCHAPHostSecret: hostKey}, WithCommandRunner(runner))
+	err := c.NVMeTCPConnect(NVMeTarget{Portal: "10.230.1.1", TargetNqn: testTarget}, false)
+	if !errors.Is(err, ErrTargetUnreachable) {
+		t.Fatalf("Expected ErrTargetUnreachable, but got %v", err)
+	}
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("Expected a CommandError, but got %T", err)
+	}
+	if cmdErr.ExitCode != 111 || cmdErr.Stderr != "Failed to write to /dev/nvme-fabrics: Connection refused" || cmdErr.Command[1] != "connect" {
+		t.Errorf("Unexpected command error %+v", cmdErr)
+	}
+	if strings.Contains(err.Error(), hostKey) || strings.Contains(strings.Join(cmdErr.Command, " "), hostKey) {
+		t.Errorf("Expected the key to be redacted from %q", err.Error())
+	}
+
+	runner.responses["list-ns"] = fakeCommandResponse{exitCode: NVMeNoObjsFoundExitCode}
+	devices := []DevicePathAndNamespace{{DevicePath: "/dev/nvme0n1", Namespace: "1"}}
+	if _, err = c.ListNVMeNamespaceID(devices); !errors.Is(err, ErrNoObjectsFound) {
+		t.Errorf("Expected ErrNoObjectsFound, but got %v", err)
+	}
+
+	GONVMEMock.InduceTCPLoginError = true
+	mock := NewMockNVMe(map[string]string{})
+	if err = mock.NVMeTCPConnect(NVMeTarget{Portal: tcpTestPortal, TargetNqn: testTarget}, false); !errors.Is(err, ErrTargetUnreachable) || !errors.As(err, &cmdErr) {
+		t.Errorf("Expected an induced ErrTargetUnreachable, but got %v", err)
+	}
+}
+
+func TestConnectAll(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"connect": {exitCode: 1, stderr: "Failed to write to /dev/nvme-fabrics: already connected"},
+	}}
+	c := NewNVMe(map[string]string{ChrootDirectory: "/noroot"}, WithCommandRunner(runner))
+	targets := []NVMeTarget{
+		{Portal: "10.230.1.1", TargetNqn: testTarget, TargetType: NVMeTransportTypeTCP},
+		{Portal: "10.230.1.2", TargetNqn: testTarget, TrType: "loop"},
+		{Portal: "10.230.1.3", TargetNqn: testTarget, TrType: NVMeTransportTypeTCP},
+	}
+	results, err := c.ConnectAll(context.Background(), targets, ConnectAllOptions{Concurrency: 2})
+	if err == nil || !strings.Contains(err.Error(), "10.230.1.2") {
+		t.Errorf("Expected the error of the loop target, but got %v", err)
+	}
+	if len(results) != len(targets) {
+		t.Fatalf("Expected %d results, but got %v", len(targets), results)
+	}
+	for i, result := range results {
+		compareStr(t, result.Target.Portal, targets[i].Portal)
+	}
+	if results[0].Err != nil || !results[0].AlreadyConnected || results[2].Err != nil || !results[2].AlreadyConnected {
+		t.Errorf("Expected the TCP targets to be already connected, but got %+v", results)
+	}
+	if results[1].Err == nil {
+		t.Error("Expected an error for an unknown transport")
+	}
+	if len(runner.calls) != 2 {
+		t.Errorf("Expected 2 connects, but got %v", runner.calls)
+	}
+
+	// the failed login of a discovered target is returned with the targets
+	runner.responses["discover"] = fakeCommandResponse{stdoutFile: "testdata/discovery_tcp.txt"}
+	runner.responses["connect"] = fakeCommandResponse{exitCode: 111, stderr: "Failed to write to /dev/nvme-fabrics: Connection refused"}
+	discovered, err := c.DiscoverNVMeTCPTargets("10.230.1.1", true)
+	if len(discovered) != 2 || !errors.Is(err, ErrTargetUnreachable) {
+		t.Errorf("Expected 2 targets and ErrTargetUnreachable, but got %v, %v", discovered, err)
+	}
+}
+
+func TestConnectAllConcurrency(t *testing.T) {
+	targets := make([]NVMeTarget, 6)
+	for i := range targets {
+		targets[i] = NVMeTarget{Portal: fmt.Sprintf("10.230.1.%d", i+1), TargetNqn: testTarget}
+	}
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	connect := func(_ context.Context, target NVMeTarget, _ ConnectOptions) (ConnectResult, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if target.Portal == "10.230.1.1" {
+			return ConnectResult{}, ErrTargetUnreachable
+		}
+		return ConnectResult{}, nil
+	}
+
+	results, err := connectAll(context.Background(), targets, ConnectAllOptions{Concurrency: 2}, connect)
+	if !errors.Is(err, ErrTargetUnreachable) {
+		t.Errorf("Expected ErrTargetUnreachable, but got %v", err)
+	}
+	if maxRunning != 2 {
+		t.Errorf("Expected 2 connects at a time, but got %d", maxRunning)
+	}
+	for _, result := range results[1:] {
+		if result.Err != nil || result.Duration <= 0 {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	}
+
+	// a failure stops the connects not started yet
+	results, _ = connectAll(context.Background(), targets, ConnectAllOptions{Concurrency: 1, StopOnFailure: true}, connect)
+	if !errors.Is(results[0].Err, ErrTargetUnreachable) {
+		t.Errorf("Expected ErrTargetUnreachable, but got %v", results[0].Err)
+	}
+	for _, result := range results[2:] {
+		if !errors.Is(result.Err, ErrConnectSkipped) {
+			t.Errorf("Expected ErrConnectSkipped, but got %v", result.Err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = connectAll(ctx, targets, ConnectAllOptions{}, connect)
+	if !errors.Is(err, context.Canceled) || !errors.Is(results[5].Err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, but got %v", err)
+	}
+}
+
+func TestMockConnectAll(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{MockNumberOfTCPTargets: "3"})
+	targets, err := c.DiscoverNVMeTCPTargets("1.1.1.1", false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	results, err := c.ConnectAll(context.Background(), targets, ConnectAllOptions{})
+	if err != nil || len(results) != 3 {
+		t.Errorf("Expected 3 connected targets, but got %v, %v", results, err)
+	}
+	GONVMEMock.InduceTCPLoginError = true
+	if _, err = c.ConnectAll(context.Background(), targets, ConnectAllOptions{}); !errors.Is(err, ErrTargetUnreachable) {
+		t.Errorf("Expected an induced ErrTargetUnreachable, but got %v", err)
+	}
+	targets, err = c.DiscoverNVMeTCPTargets("1.1.1.1", true)
+	if len(targets) != 3 || err == nil || !strings.Contains(err.Error(), "induced") {
+		t.Errorf("Expected 3 targets and an induced error, but got %v, %v", targets, err)
+	}
+}
+
+func TestWaitForNamespace(t *testing.T) {
+	reset()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dev"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(filepath.Join(root, "dev", "nvme0n1"), nil, 0o600)
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{"ns-rescan": {}}}
+	c := NewNVMe(map[string]string{SysfsRoot: "testdata/sysfs", ChrootDirectory: root}, WithCommandRunner(runner))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, id := range []NamespaceIdentifier{
+		{NGUID: "507911ECDA65A2498CCF0968009A5D07"},
+		{UUID: "507911ec-da65-a249-8ccf-0968009a5d07"},
+		{SubsystemNQN: "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D", NamespaceID: 1},
+	} {
+		ns, err := c.WaitForNamespace(ctx, id)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if ns.Device != "/dev/nvme0n1" || len(ns.Paths) != 2 {
+			t.Errorf("Unexpected namespace %+v", ns)
+		}
+	}
+
+	// the namespace is returned once its device is created
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = os.WriteFile(filepath.Join(root, "dev", "nvme1n1"), nil, 0o600)
+	}()
+	ns, err := c.WaitForNamespace(ctx, NamespaceIdentifier{EUI64: "5CD2E42A81A11F6E"})
+	if err != nil || ns.Device != "/dev/nvme1n1" {
+		t.Errorf("Unexpected namespace %+v: %v", ns, err)
+	}
+
+	// the controllers of the subsystem are rescanned while the namespace is missing
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer shortCancel()
+	_, err = c.WaitForNamespace(shortCtx, NamespaceIdentifier{SubsystemNQN: "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D", NamespaceID: 9})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, but got %v", err)
+	}
+	if len(runner.calls) != 2 || strings.Join(runner.calls[1], " ") != "nvme ns-rescan /dev/nvme10" {
+		t.Errorf("Expected rescans of nvme0 and nvme10, but got %v", runner.calls)
+	}
+
+	if _, err = c.WaitForNamespace(ctx, NamespaceIdentifier{NamespaceID: 1}); err == nil {
+		t.Error("Expected an error for a namespace ID without a subsystem NQN")
+	}
+}
+
+func TestMockWaitForNamespace(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{MockNumberOfNamespaceDevices: "2"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ns, err := c.WaitForNamespace(ctx, NamespaceIdentifier{NGUID: "507911ecda65a2498ccf096800000002"})
+	if err != nil || ns.NamespaceID != 2 {
+		t.Errorf("Unexpected namespace %+v: %v", ns, err)
+	}
+	if _, err = c.WaitForNamespace(ctx, NamespaceIdentifier{NGUID: "507911ecda65a2498ccf096800000009"}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, but got %v", err)
+	}
+}
+
+func TestFindDevicesByNamespaceID(t *testing.T) {
+	reset()
+	// sysfs is read below the chroot directory
+	c := NewNVMe(map[string]string{ChrootDirectory: "testdata/sysfs"})
+	expected := []NamespaceDevice{
+		{Name: "nvme0c0n1", NamespaceID: 1},
+		{Name: "nvme0c10n1", NamespaceID: 1},
+		{Name: "nvme0n1", Head: true, NamespaceID: 1},
+	}
+	for _, id := range []string{"507911ECDA65A2498CCF0968009A5D07", "507911EC-DA65-A249-8CCF-0968009A5D07", "eui.507911ecda65a2498ccf0968009a5d07"} {
+		devices, err := c.FindDevicesByNamespaceID(id)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !reflect.DeepEqual(devices, expected) {
+			t.Errorf("Expected %+v for %s, but got %+v", expected, id, devices)
+		}
+	}
+	devices, err := c.FindDevicesByNamespaceID("5CD2E42A81A11F6E")
+	if err != nil || len(devices) != 1 || devices[0].Name != "nvme1n1" || !devices[0].Head {
+		t.Errorf("Unexpected devices %+v: %v", devices, err)
+	}
+	devices, err = c.FindDevicesByNamespaceID("uuid.00000000-0000-0000-0000-000000000001")
+	if err != nil || len(devices) != 0 {
+		t.Errorf("Expected no devices, but got %+v: %v", devices, err)
+	}
+	if _, err = c.FindDevicesByNamespaceID("0000000000000000"); err == nil {
+		t.Error("Expected an error for an identifier of zeros")
+	}
+}
+
+func TestMockFindDevicesByNamespaceID(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{MockNumberOfNamespaceDevices: "2"})
+	devices, err := c.FindDevicesByNamespaceID("507911ECDA65A2498CCF096800000001")
+	if err != nil || len(devices) != 3 || !devices[0].Head || devices[1].Head {
+		t.Errorf("Unexpected devices %+v: %v", devices, err)
+	}
+	GONVMEMock.InduceGetSessionsError = true
+	if _, err = c.FindDevicesByNamespaceID("507911ECDA65A2498CCF096800000001"); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestGetNamespaceInfo(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"nvme id-ns /dev/nvme0n1 -o json":    {stdoutFile: "testdata/id_ns.json"},
+		"nvme ns-descs /dev/nvme0n1 -o json": {stdoutFile: "testdata/ns_descs.json"},
+	}}
+	c := NewNVMe(map[string]string{SysfsRoot: "testdata/sysfs"}, WithCommandRunner(runner))
+	expected := NamespaceInfo{
+		NamespaceID:              1,
+		SizeBlocks:               16777216,
+		CapacityBlocks:           16777216,
+		UtilizationBlocks:        140216,
+		SizeBytes:                16777216 * 4096,
+		CapacityBytes:            16777216 * 4096,
+		UtilizationBytes:         140216 * 4096,
+		LBAFormat:                1,
+		BlockSize:                4096,
+		MetadataSize:             8,
+		MetadataExtended:         true,
+		ProtectionType:           1,
+		ProtectionFirst:          true,
+		Shared:                   true,
+		ANAGroupID:               2,
+		AtomicWriteUnit:          8,
+		AtomicWriteUnitPowerFail: 4,
+		NGUID:                    "507911ecda65a2498ccf0968009a5d07",
+		EUI64:                    "0000000000000000",
+		UUID:                     "507911ec-da65-a249-8ccf-0968009a5d07",
+	}
+	info, err := c.GetNamespaceInfo("/dev/nvme0n1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, info)
+	}
+
+	// the text output is parsed when nvme-cli rejects -o json
+	unsupported := fakeCommandResponse{exitCode: 1, stderr: "Invalid output format"}
+	runner.responses["nvme id-ns /dev/nvme0n1 -o json"] = unsupported
+	runner.responses["nvme ns-descs /dev/nvme0n1 -o json"] = unsupported
+	runner.responses["nvme id-ns /dev/nvme0n1"] = fakeCommandResponse{stdoutFile: "testdata/id_ns.txt"}
+	runner.responses["nvme ns-descs /dev/nvme0n1"] = fakeCommandResponse{stdoutFile: "testdata/ns_descs.txt"}
+	expected.NamespaceID = 149
+	if info, err = c.GetNamespaceInfo("/dev/nvme0n1"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, info)
+	}
+	calls := len(runner.calls)
+	nguid, namespace, err := c.GetNVMeDeviceData("/dev/nvme0n1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	compareStr(t, nguid, "507911ecda65a2498ccf0968009a5d07")
+	compareStr(t, namespace, "149")
+	// nvme id-ns alone names the namespace
+	if len(runner.calls) != calls+1 {
+		t.Errorf("Expected a single nvme id-ns, but got %v", runner.calls[calls:])
+	}
+	compareStr(t, strings.Join(runner.lastCall(), " "), "nvme id-ns /dev/nvme0n1")
+
+	// without sysfs the namespace ID comes from nvme get-ns-id, and the UUID is optional
+	runner.responses["nvme id-ns /dev/nvme5n1 -o json"] = fakeCommandResponse{stdoutFile: "testdata/id_ns.json"}
+	runner.responses["get-ns-id"] = fakeCommandResponse{stdout: "/dev/nvme5n1: namespace-id:7\n"}
+	runner.responses["ns-descs"] = fakeCommandResponse{exitCode: 1, stderr: "NVMe status: Invalid Field in Command"}
+	if info, err = c.GetNamespaceInfo("/dev/nvme5n1"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if info.NamespaceID != 7 || info.UUID != "" || info.BlockSize != 4096 {
+		t.Errorf("Unexpected namespace information %+v", info)
+	}
+
+	runner.responses["id-ns"] = fakeCommandResponse{exitCode: 1, stderr: "NVMe status: Invalid Namespace or Format"}
+	if _, _, err = c.GetNVMeDeviceData("/dev/nvme6n1"); err == nil {
+		t.Error("Expected an error for a failed nvme id-ns")
+	}
+}
+
+func TestMockGetNamespaceInfo(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{})
+	info, err := c.GetNamespaceInfo("/dev/nvme0n1")
+	if err != nil || info.NamespaceID != 11 || info.SizeBytes != info.SizeBlocks*uint64(info.BlockSize) {
+		t.Errorf("Unexpected namespace information %+v: %v", info, err)
+	}
+	GONVMEMock.InducedNVMeDeviceDataError = true
+	if _, err = c.GetNamespaceInfo("/dev/nvme0n1"); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
+
+func TestGetControllerInfo(t *testing.T) {
+	reset()
+	runner := &fakeCommandRunner{responses: map[string]fakeCommandResponse{
+		"nvme id-ctrl /dev/nvme0 -o json": {stdoutFile: "testdata/id_ctrl.json"},
+	}}
+	c := NewNVMe(map[string]string{}, WithCommandRunner(runner))
+	expected := ControllerInfo{
+		Model:                "dellemc-powerstore",
+		Serial:               "FP08RZ2",
+		Firmware:             "3.0.0.0",
+		CntlID:               1,
+		VendorID:             0x11db,
+		SubsystemVendorID:    0x11db,
+		SubsystemNQN:         "nqn.1988-11.com.dell:powerstore:00:e6e2d5b871f1403E169D",
+		MDTS:                 5,
+		MaxDataTransferBytes: 128 * 1024,
+		ANASupported:         true,
+		ANAGroupMax:          64,
+		KeepAliveSupported:   true,
+		KeepAliveGranularity: 10 * time.Second,
+		SGLSupported:         true,
+		LogPages:             ControllerLogPages{CommandEffects: true, Telemetry: true, ANA: true},
+	}
+	info, err := c.GetControllerInfo("nvme0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, info)
+	}
+
+	// the text output is parsed when nvme-cli rejects -o json
+	runner.responses["nvme id-ctrl /dev/nvme0 -o json"] = fakeCommandResponse{exitCode: 1, stderr: "Invalid output format"}
+	runner.responses["nvme id-ctrl /dev/nvme0"] = fakeCommandResponse{stdoutFile: "testdata/id_ctrl.txt"}
+	if info, err = c.GetControllerInfo("/dev/nvme0"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, info)
+	}
+
+	runner.responses["id-ctrl"] = fakeCommandResponse{stdout: "garbage\n"}
+	if _, err = c.GetControllerInfo("nvme1"); err == nil {
+		t.Error("Expected an error for unparsable output")
+	}
+}
+
+func TestMockGetControllerInfo(t *testing.T) {
+	reset()
+	c := NewMockNVMe(map[string]string{})
+	info, err := c.GetControllerInfo("nvme0")
+	if err != nil || info.Model != "dellemc-powerstore" || !info.ANASupported {
+		t.Errorf("Unexpected controller information %+v: %v", info, err)
+	}
+	c = NewMockNVMe(map[string]string{MockIdentifyControllerFile: "testdata/id_ctrl.txt"})
+	if info, err = c.GetControllerInfo("nvme0"); err != nil || info.CntlID != 1 {
+		t.Errorf("Unexpected controller information %+v: %v", info, err)
+	}
+	GONVMEMock.InduceIdentifyControllerError = true
+	if _, err = c.GetControllerInfo("nvme0"); err == nil {
+		t.Error("Expected an induced error")
+	}
+}
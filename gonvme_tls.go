@@ -0,0 +1,188 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+)
+
+const (
+	// TLSKeyring is the option naming the keyring nvme connect looks the TLS PSKs up in,
+	// nvme-cli uses .nvme if it is not set
+	TLSKeyring = "tlsKeyring"
+
+	tlsKeyPrefix = "NVMeTLSkey-1"
+)
+
+// TLSHash is the hash function of a TLS PSK, which determines its length
+type TLSHash int
+
+// Hash functions of TLS PSKs, as in the NVMeTLSkey-1:<hash>:... interchange format
+const (
+	TLSHashNone   TLSHash = 0
+	TLSHashSHA256 TLSHash = 1
+	TLSHashSHA384 TLSHash = 2
+)
+
+func (h TLSHash) new() func() hash.Hash {
+	if h == TLSHashSHA384 {
+		return sha512.New384
+	}
+	return sha256.New
+}
+
+// TLSKey is a configured PSK for NVMe/TCP secure channels
+type TLSKey struct {
+	Hash TLSHash
+	PSK  []byte
+}
+
+// ParseTLSKey parses a PSK in the NVMeTLSkey-1:<hash>:<base64>: interchange format, checking
+// that the hash is known, the PSK of 32 or 48 bytes matches it and its CRC-32 is right
+func ParseTLSKey(key string) (TLSKey, error) {
+	fields := strings.Split(key, ":")
+	if len(fields) != 4 || fields[0] != tlsKeyPrefix || fields[3] != "" {
+		return TLSKey{}, errors.New("invalid TLS PSK: expected NVMeTLSkey-1:<hash>:<key>:")
+	}
+	var h TLSHash
+	switch fields[1] {
+	case "00":
+		h = TLSHashNone
+	case "01":
+		h = TLSHashSHA256
+	case "02":
+		h = TLSHashSHA384
+	default:
+		return TLSKey{}, fmt.Errorf("invalid TLS PSK: unknown hash %q", fields[1])
+	}
+	data, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return TLSKey{}, errors.New("invalid TLS PSK: malformed base64")
+	}
+	psk := data[:max(len(data)-crc32.Size, 0)]
+	switch {
+	case h == TLSHashSHA256 && len(psk) != sha256.Size,
+		h == TLSHashSHA384 && len(psk) != sha512.Size384,
+		len(psk) != sha256.Size && len(psk) != sha512.Size384:
+		return TLSKey{}, fmt.Errorf("invalid TLS PSK: unexpected key length %d for hash %s", len(psk), fields[1])
+	}
+	if binary.LittleEndian.Uint32(data[len(psk):]) != crc32.ChecksumIEEE(psk) {
+		return TLSKey{}, errors.New("invalid TLS PSK: CRC mismatch")
+	}
+	return TLSKey{Hash: h, PSK: psk}, nil
+}
+
+// String returns the PSK in the interchange format
+func (k TLSKey) String() string {
+	data := binary.LittleEndian.AppendUint32(append([]byte{}, k.PSK...), crc32.ChecksumIEEE(k.PSK))
+	return fmt.Sprintf("%s:%02x:%s:", tlsKeyPrefix, int(k.Hash), base64.StdEncoding.EncodeToString(data))
+}
+
+// DeriveRetainedPSK derives the retained PSK of hostNQN from the configured PSK k, as
+// NVMe/TCP does before deriving the TLS PSK: HKDF with the hash of k, no salt and the
+// label "HostNQN" with hostNQN as context. A PSK without hash is retained as is.
+func DeriveRetainedPSK(k TLSKey, hostNQN string) ([]byte, error) {
+	if hostNQN == "" {
+		return nil, errors.New("a host NQN is required to derive a retained PSK")
+	}
+	if k.Hash == TLSHashNone {
+		return append([]byte{}, k.PSK...), nil
+	}
+	newHash := k.Hash.new()
+	prk := hkdfExtract(newHash, k.PSK)
+	return hkdfExpandLabel(newHash, prk, "HostNQN", []byte(hostNQN), len(k.PSK)), nil
+}
+
+// TLSPSKIdentity returns the identity of the TLS PSK hostNQN uses to connect to subsysNQN
+func TLSPSKIdentity(k TLSKey, hostNQN, subsysNQN string) string {
+	h := k.Hash
+	if h == TLSHashNone {
+		// the identity names the hash of the TLS PSK, which follows the length of the PSK
+		h = TLSHashSHA256
+		if len(k.PSK) == sha512.Size384 {
+			h = TLSHashSHA384
+		}
+	}
+	return fmt.Sprintf("NVMe0R%02d %s %s", int(h), hostNQN, subsysNQN)
+}
+
+// hkdfExtract is HKDF-Extract of RFC 5869 without salt
+func hkdfExtract(newHash func() hash.Hash, ikm []byte) []byte {
+	mac := hmac.New(newHash, make([]byte, newHash().Size()))
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label of RFC 8446
+func hkdfExpandLabel(newHash func() hash.Hash, prk []byte, label string, context []byte, length int) []byte {
+	label = "tls13 " + label
+	info := binary.BigEndian.AppendUint16(nil, uint16(length)) // #nosec G115
+	info = append(info, byte(len(label)))
+	info = append(info, label...)
+	info = append(info, byte(len(context)))
+	info = append(info, context...)
+
+	var out, t []byte
+	for counter := byte(1); len(out) < length; counter++ {
+		mac := hmac.New(newHash, prk)
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{counter})
+		t = mac.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+// useTLS reports whether target is connected over a secure channel, either because it is
+// asked for or because the discovery log entry of target requires one
+func useTLS(target NVMeTarget) bool {
+	return target.TLS || target.TLSKey != "" || strings.HasPrefix(target.Treq, "required")
+}
+
+// tlsArgs returns the nvme connect arguments for a secure channel to target, none when it uses none
+func (nvme *NVMe) tlsArgs(ctx context.Context, target NVMeTarget) ([]string, error) {
+	if !useTLS(target) {
+		return nil, nil
+	}
+	if target.TLSKey != "" {
+		if _, err := ParseTLSKey(target.TLSKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := nvme.requireCapability(ctx, FeatureTLS); err != nil {
+		return nil, err
+	}
+	args := []string{"--tls"}
+	if target.TLSKey != "" {
+		args = append(args, "--tls_key="+target.TLSKey)
+	}
+	if keyring := nvme.options[TLSKeyring]; keyring != "" {
+		args = append(args, "--keyring="+keyring)
+	}
+	return args, nil
+}
@@ -0,0 +1,155 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+// sysfsSectorSize is the unit of the size attribute of block devices
+const sysfsSectorSize = 512
+
+// Topology is the host with its NVMe subsystems, their controllers and namespaces
+type Topology struct {
+	HostNQN    string
+	HostID     string
+	Subsystems []NVMeSubsystem
+}
+
+// NVMeSubsystem is an NVMe subsystem the host is connected to
+type NVMeSubsystem struct {
+	Name        string // e.g. nvme-subsys0
+	NQN         string
+	Model       string
+	Serial      string
+	Firmware    string
+	IOPolicy    string // native multipath I/O policy, e.g. numa or round-robin
+	Controllers []NVMeController
+	Namespaces  []NVMeNamespace
+}
+
+// NVMeController is a controller of an NVMe subsystem
+type NVMeController struct {
+	Name      string // e.g. nvme0
+	CntlID    string
+	Transport NVMETransportName
+	Address   string // controller address as reported by the kernel
+	State     NVMESessionState
+}
+
+// NVMeNamespace is a namespace of an NVMe subsystem
+type NVMeNamespace struct {
+	NamespaceID uint32
+	NGUID       string
+	UUID        string
+	EUI64       string
+	WWID        string
+	Device      string // block device, e.g. /dev/nvme0n1
+	Paths       []NVMePath
+	// OptimizedPaths counts the live paths in the optimized ANA state
+	OptimizedPaths int
+	Size           uint64 // in bytes
+}
+
+// GetTopology returns the host with its NVMe subsystems, their controllers and namespaces
+func (nvme *NVMe) GetTopology() (Topology, error) {
+	return nvme.GetTopologyWithContext(context.Background())
+}
+
+// GetTopologyWithContext returns the host with its NVMe subsystems, their controllers and
+// namespaces, all read from sysfs in one pass
+func (nvme *NVMe) GetTopologyWithContext(ctx context.Context) (Topology, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetTopology")()
+	if err := ctx.Err(); err != nil {
+		return Topology{}, contextError(ctx, err)
+	}
+	return nvme.getTopology(ctx)
+}
+
+func (nvme *NVMe) getTopology(ctx context.Context) (Topology, error) {
+	identity, err := nvme.readHostIdentity(ctx)
+	if err != nil {
+		return Topology{}, err
+	}
+	topology := Topology{HostNQN: identity.HostNQN, HostID: identity.HostID, Subsystems: []NVMeSubsystem{}}
+
+	subsystems, err := filepath.Glob(nvme.sysfsPath(sysfsNVMeSubsystemClass, "nvme-subsys*"))
+	if err != nil {
+		logger.Error(ctx, "Error gathering nvme subsystems: %v", err)
+		return Topology{}, err
+	}
+	sortSysfsNames(subsystems)
+	for _, subsystem := range subsystems {
+		controllers, err := sysfsSubsystemControllers(subsystem)
+		if err != nil {
+			logger.Error(ctx, "Error reading nvme subsystem %s: %v", subsystem, err)
+			continue
+		}
+		topology.Subsystems = append(topology.Subsystems, nvme.sysfsSubsystem(ctx, subsystem, controllers))
+	}
+	return topology, nil
+}
+
+// sysfsSubsystem returns the subsystem of a subsystem directory in sysfs
+func (nvme *NVMe) sysfsSubsystem(ctx context.Context, subsystem string, controllers []string) NVMeSubsystem {
+	s := NVMeSubsystem{
+		Name:        filepath.Base(subsystem),
+		NQN:         readSysfsAttribute(filepath.Join(subsystem, "subsysnqn")),
+		Model:       readSysfsAttribute(filepath.Join(subsystem, "model")),
+		Serial:      readSysfsAttribute(filepath.Join(subsystem, "serial")),
+		Firmware:    readSysfsAttribute(filepath.Join(subsystem, "firmware_rev")),
+		IOPolicy:    readSysfsAttribute(filepath.Join(subsystem, "iopolicy")),
+		Controllers: make([]NVMeController, 0, len(controllers)),
+		Namespaces:  []NVMeNamespace{},
+	}
+	for _, name := range controllers {
+		dir := nvme.sysfsPath(sysfsNVMeClass, name)
+		s.Controllers = append(s.Controllers, NVMeController{
+			Name:      name,
+			CntlID:    readSysfsAttribute(filepath.Join(dir, "cntlid")),
+			Transport: NVMETransportName(readSysfsAttribute(filepath.Join(dir, "transport"))),
+			Address:   readSysfsAttribute(filepath.Join(dir, "address")),
+			State:     NVMESessionState(readSysfsAttribute(filepath.Join(dir, "state"))),
+		})
+	}
+	for _, ns := range nvme.subsystemNamespacePaths(ctx, s.NQN, controllers) {
+		// the namespace device is below the subsystem with native multipath, below its controller without
+		dir := filepath.Join(subsystem, ns.Device)
+		if _, err := os.Stat(dir); err != nil && len(ns.Paths) > 0 {
+			dir = nvme.sysfsPath(sysfsNVMeClass, ns.Paths[0].Controller, ns.Device)
+		}
+		size, _ := strconv.ParseUint(readSysfsAttribute(filepath.Join(dir, "size")), 10, 64)
+		s.Namespaces = append(s.Namespaces, NVMeNamespace{
+			NamespaceID:    ns.NamespaceID,
+			NGUID:          readSysfsAttribute(filepath.Join(dir, "nguid")),
+			UUID:           readSysfsAttribute(filepath.Join(dir, "uuid")),
+			EUI64:          readSysfsAttribute(filepath.Join(dir, "eui")),
+			WWID:           readSysfsAttribute(filepath.Join(dir, "wwid")),
+			Device:         "/dev/" + ns.Device,
+			Paths:          ns.Paths,
+			OptimizedPaths: ns.OptimizedPaths,
+			Size:           size * sysfsSectorSize,
+		})
+	}
+	return s
+}
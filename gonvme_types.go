@@ -29,6 +29,40 @@ type NVMeTarget struct {
 	SecType    string // sectype
 	TargetType string // trtype
 	HostAdr    string // host_traddr
+	CntlID     string // cntlid
+	AsqSz      string // asqsz
+	EFlags     string // eflags
+	GenCtr     uint64 // generation counter of the discovery log the target was found in
+	NumRec     uint64 // number of records of the discovery log the target was found in
+
+	DHCHAPSecret     string // dhchap_secret, the host key for in-band authentication
+	DHCHAPCtrlSecret string // dhchap_ctrl_secret, the controller key for bidirectional authentication
+
+	TLS    bool   // tls, connect over a TLS secure channel, implied when Treq says one is required
+	TLSKey string // tls_key, the configured PSK in interchange format, from the keyring if not set
+}
+
+// DiscoveryLog defines the discovery log page reported by a discovery controller
+type DiscoveryLog struct {
+	GenCtr  uint64 // generation counter, which changes with every change of the log
+	NumRec  uint64 // number of records
+	Entries []DiscoveryLogEntry
+}
+
+// DiscoveryLogEntry defines an entry of the discovery log page, with the names nvme discover prints
+type DiscoveryLogEntry struct {
+	TrType  string
+	AdrFam  string
+	SubType string
+	Treq    string
+	PortID  uint16
+	CntlID  uint16 // 0 if not reported
+	AsqSz   uint16 // 0 if not reported
+	EFlags  string
+	TrSvcID string
+	SubNQN  string
+	TrAddr  string
+	SecType string // NVMe/TCP entries only
 }
 
 // NVMESessionState defines the NVMe connection state
@@ -44,6 +78,9 @@ const (
 	// NVMeTransportTypeFC - Placeholder for NVMe Transport type FC
 	NVMeTransportTypeFC = "fc"
 
+	// NVMeTransportTypeRDMA - Placeholder for NVMe Transport type RDMA
+	NVMeTransportTypeRDMA = "rdma"
+
 	// NVMESessionStateLive indicates the NVMe connection state as live
 	NVMESessionStateLive NVMESessionState = "live"
 	// NVMESessionStateDeleting indicates the NVMe connection state as deleting
@@ -67,9 +104,10 @@ type DevicePathAndNamespace struct {
 
 // NVMESession defines an iSCSI session info
 type NVMESession struct {
-	Target            string
+	Target            string // subsystem NQN
 	Portal            string
-	Name              string
+	Name              string // controller name
+	Address           string // controller address as reported by the kernel
 	NVMESessionState  NVMESessionState
 	NVMETransportName NVMETransportName
 }
@@ -0,0 +1,93 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// ueventGroupKernel is the netlink multicast group of the uevents sent by the kernel
+const ueventGroupKernel = 1
+
+// ueventSource receives the uevents the kernel sends for discovery log change AENs.
+// Only the initial network namespace receives them, so containers in their own network
+// namespace get none and WatchDiscovery relies on polling there.
+type ueventSource struct{}
+
+func (ueventSource) Events(ctx context.Context) (<-chan DiscoveryEvent, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: ueventGroupKernel}); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	// a non-blocking descriptor makes reads of the file return when it is closed
+	f := os.NewFile(uintptr(fd), "uevent")
+
+	events := make(chan DiscoveryEvent)
+	go func() {
+		<-ctx.Done()
+		_ = f.Close()
+	}()
+	go func() {
+		defer close(events)
+		buf := make([]byte, os.Getpagesize()*4)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			event, ok := parseDiscoveryUevent(buf[:n])
+			if !ok {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// parseDiscoveryUevent parses a uevent, an action@devpath header followed by KEY=VALUE
+// fields separated by NUL bytes, and reports whether it is a discovery log change event
+func parseDiscoveryUevent(msg []byte) (DiscoveryEvent, bool) {
+	env := make(map[string]string)
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		if key, value, ok := strings.Cut(string(field), "="); ok {
+			env[key] = value
+		}
+	}
+	if env["ACTION"] != "change" || env["SUBSYSTEM"] != "nvme" || env["NVME_EVENT"] != "discovery" {
+		return DiscoveryEvent{}, false
+	}
+	return DiscoveryEvent{
+		Controller: env["DEVNAME"],
+		Transport:  env["NVME_TRTYPE"],
+		TrAddr:     env["NVME_TRADDR"],
+		TrSvcID:    env["NVME_TRSVCID"],
+		HostTrAddr: env["NVME_HOST_TRADDR"],
+	}, true
+}
@@ -17,18 +17,26 @@
 package gonvme
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"regexp"
+	"net"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
 
-type sessionParser struct{}
+type sessionParser struct {
+	// v2 is set for the nvme-cli 2.x output, in which each subsystem lists its own paths.
+	// Otherwise the nvme-cli 1.x output is expected as well, which reports the paths of a
+	// subsystem in the object following it.
+	v2 bool
+}
 
-// Single subsystem object
-type subsystems struct {
+// SubSys is a subsystem object of the nvme list-subsys JSON output, with the Name,
+// Transport, Address and State of each path
+type SubSys struct {
 	Name  string
 	NQN   string
 	Paths []map[string]string `json:"Paths"`
@@ -36,9 +44,9 @@ type subsystems struct {
 
 // SubSysResponse of subsystems.
 type SubSysResponse struct {
-	HostNQN    string       `json:"HostNQN"`
-	HostID     string       `json:"HostID"`
-	Subsystems []subsystems `json:"Subsystems"`
+	HostNQN    string   `json:"HostNQN"`
+	HostID     string   `json:"HostID"`
+	Subsystems []SubSys `json:"Subsystems"`
 }
 
 func (sp *sessionParser) Parse(data []byte) []NVMESession {
@@ -54,37 +62,92 @@ func (sp *sessionParser) Parse(data []byte) []NVMESession {
 		return result
 	}
 	for _, resp := range response {
+		nqn := ""
 		for _, system := range resp.Subsystems {
-			session := NVMESession{}
-			session.Target = system.NQN
-			reAdd := `(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)(\.(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)){3}`
-			re := regexp.MustCompilePOSIX(reAdd)
+			if system.NQN != "" || sp.v2 {
+				nqn = system.NQN
+			}
 			for _, path := range system.Paths {
-				session.Name = path["Name"]
-				session.NVMETransportName = NVMETransportName(path["Transport"])
-				if path["Transport"] == NVMeTransportTypeFC {
-					session.Portal = strings.Split(strings.Fields(path["Address"])[0], "=")[1]
-				} else if path["Transport"] == NVMeTransportTypeTCP {
-					if re.MatchString(path["Address"]) {
-						ip := re.FindString(path["Address"])
-						portHolder := ""
-						for _, item := range strings.Split(path["Address"], ",") { // fmt: [traddr=10.230.1.1,trsvcid=4420,src=00]
-							if strings.Contains(item, "trsvcid") {
-								portHolder = item
-								break
-							}
-						}
-						port := strings.ReplaceAll(strings.Split(portHolder, "=")[1], "\"", "")
-						session.Portal = ip + ":" + port
-					}
-				} else {
+				session, ok := newNVMESession(nqn, path["Name"], path["Transport"], path["Address"], path["State"])
+				if !ok {
 					continue
 				}
-				session.NVMESessionState = NVMESessionState(path["State"])
 				result = append(result, session)
-
 			}
 		}
 	}
 	return result
 }
+
+// newNVMESession builds the session of a controller path as reported by nvme list-subsys or sysfs.
+// It returns false for transports gonvme does not manage.
+func newNVMESession(subsysNQN, name, transport, address, state string) (NVMESession, bool) {
+	session := NVMESession{
+		Target:            subsysNQN,
+		Name:              name,
+		Address:           address,
+		NVMESessionState:  NVMESessionState(state),
+		NVMETransportName: NVMETransportName(transport),
+	}
+	// fmt: traddr=10.230.1.1,trsvcid=4420,src_addr=10.230.1.4
+	// or:  traddr=nn-0x11aaa111a1111a11:pn-0x11aaa11111111a11 host_traddr=nn-0x...:pn-0x...
+	fields := parseAddressFields(address)
+	switch transport {
+	case NVMeTransportTypeFC:
+		session.Portal = fields["traddr"]
+	case NVMeTransportTypeTCP, NVMeTransportTypeRDMA:
+		// host:port, the form DiscoverNVMeTCPTargets accepts
+		session.Portal = fields["traddr"]
+		if session.Portal != "" && fields["trsvcid"] != "" {
+			session.Portal = net.JoinHostPort(session.Portal, fields["trsvcid"])
+		}
+	default:
+		return NVMESession{}, false
+	}
+	return session, true
+}
+
+// parseAddressFields splits a controller address into its key=value pairs,
+// which are separated by commas in sysfs and by commas or spaces in nvme-cli output
+func parseAddressFields(address string) map[string]string {
+	fields := make(map[string]string)
+	for _, item := range strings.FieldsFunc(address, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n'
+	}) {
+		key, value, found := strings.Cut(item, "=")
+		if found {
+			fields[key] = strings.ReplaceAll(value, "\"", "")
+		}
+	}
+	return fields
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() ([16]byte, error) {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return uuid, err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return uuid, nil
+}
+
+// parseUUID parses the canonical 8-4-4-4-12 form of a UUID
+func parseUUID(s string) ([16]byte, error) {
+	var uuid [16]byte
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return uuid, fmt.Errorf("invalid UUID %q", s)
+	}
+	b, err := hex.DecodeString(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36])
+	if err != nil {
+		return uuid, fmt.Errorf("invalid UUID %q", s)
+	}
+	copy(uuid[:], b)
+	return uuid, nil
+}
+
+// formatUUID returns the canonical 8-4-4-4-12 form of a UUID
+func formatUUID(uuid [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
@@ -0,0 +1,182 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+// Version is the version of nvme-cli or libnvme
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is major.minor or later
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// Capabilities lists what the installed nvme-cli supports
+type Capabilities struct {
+	// Version is the version of nvme-cli
+	Version Version
+	// LibNVMeVersion is the version of libnvme, zero for nvme-cli 1.x which does not use it
+	LibNVMeVersion Version
+	// DiscoverJSON is set when nvme discover supports -o json
+	DiscoverJSON bool
+	// ListJSON is set when nvme list supports -o json
+	ListJSON bool
+	// ListSubsysJSONV2 is set when nvme list-subsys -o json nests the subsystems below their
+	// host, instead of reporting each subsystem and its paths as separate objects
+	ListSubsysJSONV2 bool
+	// TLS is set when nvme connect and nvme discover support --tls
+	TLS bool
+	// DHCHAPSecret is set when nvme connect and nvme discover support --dhchap-secret
+	DHCHAPSecret bool
+	// Context is set when nvme-cli supports --context
+	Context bool
+}
+
+// Features the installed nvme-cli may not support, as reported by NotSupportedError
+const (
+	FeatureDiscoverJSON = "discover -o json"
+	FeatureListJSON     = "list -o json"
+	FeatureTLS          = "--tls"
+	FeatureDHCHAPSecret = "--dhchap-secret"
+	FeatureContext      = "--context"
+)
+
+// newCapabilities returns the capabilities of the given nvme-cli and libnvme versions
+func newCapabilities(version, libnvme Version) Capabilities {
+	return Capabilities{
+		Version:          version,
+		LibNVMeVersion:   libnvme,
+		DiscoverJSON:     version.AtLeast(1, 10),
+		ListJSON:         version.AtLeast(1, 0),
+		ListSubsysJSONV2: version.AtLeast(2, 0),
+		TLS:              version.AtLeast(2, 4),
+		DHCHAPSecret:     version.AtLeast(2, 0),
+		Context:          version.AtLeast(2, 6),
+	}
+}
+
+// Supports reports whether feature, one of the Feature constants, is supported
+func (c Capabilities) Supports(feature string) bool {
+	switch feature {
+	case FeatureDiscoverJSON:
+		return c.DiscoverJSON
+	case FeatureListJSON:
+		return c.ListJSON
+	case FeatureTLS:
+		return c.TLS
+	case FeatureDHCHAPSecret:
+		return c.DHCHAPSecret
+	case FeatureContext:
+		return c.Context
+	}
+	return false
+}
+
+var (
+	nvmeVersionRegexp    = regexp.MustCompile(`(?m)^nvme version v?(\d+)\.(\d+)(?:\.(\d+))?`)
+	libnvmeVersionRegexp = regexp.MustCompile(`(?m)^libnvme version v?(\d+)\.(\d+)(?:\.(\d+))?`)
+)
+
+// parseNVMeVersion parses the output of nvme version, which looks like
+//
+//	nvme version 2.8 (git 2.8)
+//	libnvme version 1.8 (git 1.8)
+//
+// or "nvme version 1.16" for nvme-cli 1.x
+func parseNVMeVersion(out []byte) (Version, Version, error) {
+	match := nvmeVersionRegexp.FindSubmatch(out)
+	if match == nil {
+		return Version{}, Version{}, fmt.Errorf("unexpected nvme version output: %q", out)
+	}
+	version := newVersion(match)
+	var libnvme Version
+	if match = libnvmeVersionRegexp.FindSubmatch(out); match != nil {
+		libnvme = newVersion(match)
+	}
+	return version, libnvme, nil
+}
+
+func newVersion(match [][]byte) Version {
+	var v Version
+	v.Major, _ = strconv.Atoi(string(match[1]))
+	v.Minor, _ = strconv.Atoi(string(match[2]))
+	v.Patch, _ = strconv.Atoi(string(match[3]))
+	return v
+}
+
+// GetNVMeCLICapabilities returns what the installed nvme-cli supports
+func (nvme *NVMe) GetNVMeCLICapabilities() (Capabilities, error) {
+	return nvme.GetNVMeCLICapabilitiesWithContext(context.Background())
+}
+
+// GetNVMeCLICapabilitiesWithContext returns what the installed nvme-cli supports.
+// nvme version is run once, its outcome is cached by the client.
+func (nvme *NVMe) GetNVMeCLICapabilitiesWithContext(ctx context.Context) (Capabilities, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.GetNVMeCLICapabilities")()
+	return nvme.getCapabilities(ctx)
+}
+
+func (nvme *NVMe) getCapabilities(ctx context.Context) (Capabilities, error) {
+	nvme.capabilitiesMu.Lock()
+	defer nvme.capabilitiesMu.Unlock()
+	if nvme.capabilities != nil {
+		return *nvme.capabilities, nil
+	}
+
+	// a failed probe is not cached, the next command tries again
+	result, err := nvme.runNVMeCommand(ctx, []string{NVMeCommand, "version"})
+	if err != nil {
+		logger.Debug(ctx, "Error probing the nvme-cli version: %v", err)
+		return Capabilities{}, err
+	}
+	version, libnvme, err := parseNVMeVersion(result.Stdout)
+	if err != nil {
+		logger.Debug(ctx, "Error probing the nvme-cli version: %v", err)
+		return Capabilities{}, err
+	}
+	capabilities := newCapabilities(version, libnvme)
+	logger.Info(ctx, "nvme-cli version %s, libnvme version %s", version, libnvme)
+	nvme.capabilities = &capabilities
+	return capabilities, nil
+}
+
+// requireCapability returns a NotSupportedError when the installed nvme-cli is known
+// not to support feature. A version which cannot be probed is not held against it.
+func (nvme *NVMe) requireCapability(ctx context.Context, feature string) error {
+	capabilities, err := nvme.getCapabilities(ctx)
+	if err != nil || capabilities.Supports(feature) {
+		return nil
+	}
+	return &NotSupportedError{Feature: feature, Version: capabilities.Version}
+}
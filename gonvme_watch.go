@@ -0,0 +1,355 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/dell/gonvme/internal/logger"
+	"github.com/dell/gonvme/internal/nvmetcp"
+	"github.com/dell/gonvme/internal/tracer"
+)
+
+// DefaultDiscoveryPollInterval is how often WatchDiscovery fetches the discovery log when
+// DiscoveryWatchOptions does not say otherwise
+const DefaultDiscoveryPollInterval = time.Minute
+
+// DiscoveryWatchOptions selects the discovery controller WatchDiscovery watches
+type DiscoveryWatchOptions struct {
+	// Transport of the discovery controller, NVMeTransportTypeTCP if not set
+	Transport string
+	// Address of the discovery controller: an IP address, optionally followed by a port, for
+	// NVMe/TCP and NVMe/RDMA, nn-<WWNN>:pn-<WWPN> for NVMe/FC
+	Address string
+	// HostTraddr is the local address the connection originates from, required for NVMe/FC
+	HostTraddr string
+	// PollInterval is how often the discovery log is fetched besides when an event reports a
+	// change, which catches changes whose events were missed or cannot be received.
+	// 0 selects DefaultDiscoveryPollInterval, a negative interval disables polling.
+	PollInterval time.Duration
+}
+
+// DiscoveryChange reports the targets a discovery log gained and lost
+type DiscoveryChange struct {
+	Added   []NVMeTarget
+	Removed []NVMeTarget
+	// GenCtr is the generation counter of the discovery log after the change
+	GenCtr uint64
+	// Err is set when fetching the discovery log failed, the watch goes on
+	Err error
+}
+
+// DiscoveryEvent reports that the discovery log of a discovery controller changed, as the
+// kernel does when a persistent discovery controller sends a discovery log change AEN
+type DiscoveryEvent struct {
+	Controller string // controller name, e.g. nvme3
+	Transport  string
+	TrAddr     string
+	TrSvcID    string
+	HostTrAddr string
+}
+
+// DiscoveryEventSource delivers the discovery log change events WatchDiscovery waits for
+type DiscoveryEventSource interface {
+	// Events returns a channel of the events until ctx is done, when it is closed
+	Events(ctx context.Context) (<-chan DiscoveryEvent, error)
+}
+
+// WithDiscoveryEventSource makes WatchDiscovery wait for the events of source instead of
+// the uevents of the kernel
+func WithDiscoveryEventSource(source DiscoveryEventSource) Option {
+	return func(nvme *NVMe) {
+		nvme.eventSource = source
+	}
+}
+
+// WatchDiscovery keeps a persistent connection to a discovery controller and reports the
+// changes of its discovery log until ctx is done, when the channel is closed. The first
+// change adds the targets the discovery log holds when the watch starts; an error fetching
+// it is returned instead. The discovery log is fetched again when the controller reports a
+// change, and every PollInterval. The discovery controller stays connected when the watch ends.
+func (nvme *NVMe) WatchDiscovery(ctx context.Context, options DiscoveryWatchOptions) (<-chan DiscoveryChange, error) {
+	defer tracer.TraceFuncCall(ctx, "gonvme.WatchDiscovery")()
+	return nvme.watchDiscovery(ctx, options)
+}
+
+// discoveryWatch is the state of a WatchDiscovery
+type discoveryWatch struct {
+	nvme    *NVMe
+	options DiscoveryWatchOptions
+	host    string
+	ports   []string
+	native  bool
+	// device is the persistent discovery controller the discovery log is fetched through
+	// once nvme discover connected it, so that fetching it again connects no other
+	device   string
+	targets  []NVMeTarget
+	genCtr   uint64
+	interval time.Duration
+}
+
+func (nvme *NVMe) watchDiscovery(ctx context.Context, options DiscoveryWatchOptions) (<-chan DiscoveryChange, error) {
+	w, err := nvme.newDiscoveryWatch(options)
+	if err != nil {
+		logger.Error(ctx, "Error watching discovery controller %s: %v", options.Address, err)
+		return nil, err
+	}
+	log, err := w.fetch(ctx)
+	if err != nil {
+		logger.Error(ctx, "Error discovering %s: %v", options.Address, err)
+		return nil, err
+	}
+	w.targets, w.genCtr = w.discovered(log), log.GenCtr
+
+	// the native client has no kernel controller sending events
+	var events <-chan DiscoveryEvent
+	if !w.native {
+		if events, err = nvme.eventSource.Events(ctx); err != nil {
+			logger.Info(ctx, "discovery log change events are not available, polling %s: %v", options.Address, err)
+			events = nil
+		}
+	}
+
+	changes := make(chan DiscoveryChange, 1)
+	changes <- DiscoveryChange{Added: w.targets, GenCtr: w.genCtr}
+	go w.run(ctx, events, changes)
+	return changes, nil
+}
+
+func (nvme *NVMe) newDiscoveryWatch(options DiscoveryWatchOptions) (*discoveryWatch, error) {
+	if options.Transport == "" {
+		options.Transport = NVMeTransportTypeTCP
+	}
+	if options.Address == "" {
+		return nil, errors.New("no discovery controller address")
+	}
+	w := &discoveryWatch{nvme: nvme, options: options, interval: options.PollInterval}
+	if w.interval == 0 {
+		w.interval = DefaultDiscoveryPollInterval
+	}
+	switch options.Transport {
+	case NVMeTransportTypeTCP:
+		w.host, w.ports = splitDiscoveryAddress(options.Address, NVMeDiscoveryPort, NVMePort)
+		w.native = nvme.options[DiscoveryBackend] == BackendNative
+		if hostSecret, ctrlSecret := nvme.dhchapSecrets(NVMeTarget{}); w.native && (hostSecret != "" || ctrlSecret != "") {
+			return nil, errors.New("the native discovery client does not support DH-HMAC-CHAP")
+		}
+	case NVMeTransportTypeRDMA:
+		w.host, w.ports = splitDiscoveryAddress(options.Address, NVMePort)
+	case NVMeTransportTypeFC:
+		if options.HostTraddr == "" {
+			return nil, errors.New("NVMe/FC discovery requires a host address")
+		}
+		w.host = options.Address
+	default:
+		return nil, fmt.Errorf("unknown transport %q", options.Transport)
+	}
+	return w, nil
+}
+
+// fetch returns the discovery log, trying the ports of the discovery controller in order
+// until one answers, which is used from then on
+func (w *discoveryWatch) fetch(ctx context.Context) (DiscoveryLog, error) {
+	if len(w.ports) == 0 {
+		return w.fetchPort(ctx, "")
+	}
+	var log DiscoveryLog
+	var err error
+	for i, port := range w.ports {
+		if log, err = w.fetchPort(ctx, port); err == nil {
+			w.ports = w.ports[i : i+1]
+			break
+		}
+		if !nextDiscoveryPort(ctx, err) {
+			break
+		}
+		logger.Debug(ctx, "discovery of %s on port %s failed: %v", w.host, port, err)
+	}
+	return log, err
+}
+
+func (w *discoveryWatch) fetchPort(ctx context.Context, port string) (DiscoveryLog, error) {
+	if w.native {
+		return w.nvme.nativeDiscoveryLog(ctx, net.JoinHostPort(w.host, port))
+	}
+	// nvme discover -t <transport> -a <traddr> [-s <trsvcid>] [-w <host_traddr>] --persistent
+	args := []string{"-t", w.options.Transport, "-a", w.host}
+	if port != "" {
+		args = append(args, "-s", port)
+	}
+	if w.options.HostTraddr != "" {
+		args = append(args, "-w", w.options.HostTraddr)
+	}
+	args = append(args, "--persistent")
+	if w.device != "" {
+		log, err := w.nvme.runNVMeDiscover(ctx, append(args, "--device="+w.device))
+		if err == nil || ctx.Err() != nil {
+			return log, err
+		}
+		// the controller may be gone, nvme discover connects a new one
+		logger.Debug(ctx, "discovery through %s failed: %v", w.device, err)
+		w.device = ""
+	}
+	log, err := w.nvme.runNVMeDiscover(ctx, args)
+	if err == nil {
+		w.device = w.discoveryController(port)
+	}
+	return log, err
+}
+
+// discoveryController returns the name of the live persistent discovery controller connected
+// to port of the watched discovery controller, "" if there is none
+func (w *discoveryWatch) discoveryController(port string) string {
+	controllers, err := filepath.Glob(w.nvme.sysfsPath(sysfsNVMeClass, "nvme*"))
+	if err != nil {
+		return ""
+	}
+	sortSysfsNames(controllers)
+	for _, controller := range controllers {
+		if readSysfsAttribute(filepath.Join(controller, "subsysnqn")) != nvmetcp.DiscoveryNQN ||
+			readSysfsAttribute(filepath.Join(controller, "transport")) != w.options.Transport ||
+			readSysfsAttribute(filepath.Join(controller, "state")) != string(NVMESessionStateLive) {
+			continue
+		}
+		fields := parseAddressFields(readSysfsAttribute(filepath.Join(controller, "address")))
+		if fields["traddr"] == w.host && (port == "" || fields["trsvcid"] == port) &&
+			(w.options.HostTraddr == "" || fields["host_traddr"] == w.options.HostTraddr) {
+			return filepath.Base(controller)
+		}
+	}
+	return ""
+}
+
+// discovered returns the targets of log reached through the watched discovery controller
+func (w *discoveryWatch) discovered(log DiscoveryLog) []NVMeTarget {
+	targets := log.targets(w.options.Transport)
+	if w.options.Transport != NVMeTransportTypeFC {
+		return targets
+	}
+	fcTargets := make([]NVMeTarget, 0, len(targets))
+	for _, target := range targets {
+		if target.Portal == w.host {
+			target.HostAdr = w.options.HostTraddr
+			fcTargets = append(fcTargets, target)
+		}
+	}
+	return fcTargets
+}
+
+// matches reports whether event is about the watched discovery controller
+func (w *discoveryWatch) matches(event DiscoveryEvent) bool {
+	if event.Transport != w.options.Transport || event.TrAddr != w.host {
+		return false
+	}
+	if len(w.ports) == 1 && event.TrSvcID != "" && event.TrSvcID != w.ports[0] {
+		return false
+	}
+	return w.options.HostTraddr == "" || event.HostTrAddr == "" || event.HostTrAddr == w.options.HostTraddr
+}
+
+func (w *discoveryWatch) run(ctx context.Context, events <-chan DiscoveryEvent, changes chan<- DiscoveryChange) {
+	defer close(changes)
+	var poll <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				logger.Info(ctx, "discovery log change events ended, polling %s", w.options.Address)
+				events = nil
+				continue
+			}
+			if !w.matches(event) {
+				continue
+			}
+			logger.Debug(ctx, "discovery log of %s changed", event.Controller)
+			if event.Controller != "" && !w.native {
+				w.device = event.Controller
+			}
+		case <-poll:
+		}
+
+		change, ok := w.update(ctx)
+		if !ok {
+			continue
+		}
+		select {
+		case changes <- change:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// update fetches the discovery log and returns how its targets changed, if they did
+func (w *discoveryWatch) update(ctx context.Context) (DiscoveryChange, bool) {
+	log, err := w.fetch(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return DiscoveryChange{}, false
+		}
+		logger.Error(ctx, "Error discovering %s: %v", w.options.Address, err)
+		return DiscoveryChange{Err: err}, true
+	}
+	if log.GenCtr == w.genCtr {
+		return DiscoveryChange{}, false
+	}
+	targets := w.discovered(log)
+	added, removed := diffTargets(w.targets, targets)
+	w.targets, w.genCtr = targets, log.GenCtr
+	if len(added) == 0 && len(removed) == 0 {
+		return DiscoveryChange{}, false
+	}
+	return DiscoveryChange{Added: added, Removed: removed, GenCtr: log.GenCtr}, true
+}
+
+// diffTargets returns the targets of current which are not in previous, and those of previous
+// which are not in current
+func diffTargets(previous, current []NVMeTarget) ([]NVMeTarget, []NVMeTarget) {
+	key := func(t NVMeTarget) string {
+		return t.TrType + " " + t.TargetNqn + " " + t.Portal + " " + t.TrsvcID + " " + t.HostAdr
+	}
+	before := make(map[string]bool, len(previous))
+	for _, target := range previous {
+		before[key(target)] = true
+	}
+	after := make(map[string]bool, len(current))
+	var added, removed []NVMeTarget
+	for _, target := range current {
+		after[key(target)] = true
+		if !before[key(target)] {
+			added = append(added, target)
+		}
+	}
+	for _, target := range previous {
+		if !after[key(target)] {
+			removed = append(removed, target)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,434 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package gonvmetest provides an in-process NVMe/TCP discovery controller for tests
+// of code which discovers NVMe over Fabrics targets, without hardware or network.
+package gonvmetest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dell/gonvme/internal/nvmetcp"
+)
+
+// DiscoveryNQN is the NQN hosts connect to on a discovery controller
+const DiscoveryNQN = nvmetcp.DiscoveryNQN
+
+// LogEntry describes one entry of the discovery log served by a DiscoveryController.
+// Names are the ones nvme discover prints, empty fields take the defaults listed.
+type LogEntry struct {
+	// TrType is "tcp", "fc", "rdma" or "loop", "tcp" by default
+	TrType string
+	// AdrFam is "ipv4", "ipv6", "fibre-channel", "infiniband" or "intra-host",
+	// by default derived from TrType and TrAddr
+	AdrFam string
+	// SubType is "nvme subsystem", "discovery subsystem referral" or
+	// "current discovery subsystem", "nvme subsystem" by default
+	SubType string
+	// Treq is "not specified", "required" or "not required", optionally followed by
+	// ", sq flow control disable supported", "not specified" by default
+	Treq string
+	// SecType is "none", "tls1.2" or "tls1.3", used by NVMe/TCP entries only, "none" by default
+	SecType string
+	PortID  uint16
+	// CntlID is 0xffff, the dynamic controller model, by default
+	CntlID uint16
+	// AsqSz is 32 by default
+	AsqSz uint16
+	// EFlags are the entry flags, see the EFlag constants
+	EFlags uint16
+	// TrSvcID is the port, "4420" for NVMe/TCP and NVMe/RDMA subsystems and
+	// "8009" for NVMe/TCP discovery subsystems by default
+	TrSvcID string
+	// SubNQN is DiscoveryNQN for referrals and current discovery subsystems by default
+	SubNQN string
+	TrAddr string
+}
+
+// Entry flags of a LogEntry
+const (
+	EFlagExplicitDiscoveryConnections = nvmetcp.EFlagExplicitDiscoveryConnections
+	EFlagDuplicateReturnedInformation = nvmetcp.EFlagDuplicateReturnedInformation
+	EFlagNoCDCConnectivity            = nvmetcp.EFlagNoCDCConnectivity
+)
+
+// TCPEntry returns an entry for the NVMe/TCP subsystem nqn at traddr:trsvcid
+func TCPEntry(nqn, traddr, trsvcid string) LogEntry {
+	return LogEntry{TrType: "tcp", SubNQN: nqn, TrAddr: traddr, TrSvcID: trsvcid}
+}
+
+// RDMAEntry returns an entry for the NVMe/RDMA subsystem nqn at traddr:trsvcid
+func RDMAEntry(nqn, traddr, trsvcid string) LogEntry {
+	return LogEntry{TrType: "rdma", SubNQN: nqn, TrAddr: traddr, TrSvcID: trsvcid}
+}
+
+// FCEntry returns an entry for the NVMe/FC subsystem nqn at the FC address traddr,
+// such as nn-0x58ccf090c9200c22:pn-0x58ccf091492b0c22
+func FCEntry(nqn, traddr string) LogEntry {
+	return LogEntry{TrType: "fc", SubNQN: nqn, TrAddr: traddr}
+}
+
+// ReferralEntry returns an entry referring to the NVMe/TCP discovery controller at traddr:trsvcid
+func ReferralEntry(traddr, trsvcid string) LogEntry {
+	return LogEntry{TrType: "tcp", SubType: "discovery subsystem referral", TrAddr: traddr, TrSvcID: trsvcid}
+}
+
+// toDiscoveryLogEntry applies the defaults and converts the names into their encoding
+func (e LogEntry) toDiscoveryLogEntry() (nvmetcp.DiscoveryLogEntry, error) {
+	entry := nvmetcp.DiscoveryLogEntry{
+		PortID:  e.PortID,
+		CntlID:  e.CntlID,
+		AsqSz:   e.AsqSz,
+		EFlags:  e.EFlags,
+		TrSvcID: e.TrSvcID,
+		SubNQN:  e.SubNQN,
+		TrAddr:  e.TrAddr,
+	}
+	var err error
+	if entry.TrType, err = parseOrDefault(nvmetcp.ParseTrType, e.TrType, "tcp"); err != nil {
+		return entry, fmt.Errorf("transport type: %w", err)
+	}
+	if entry.SubType, err = parseOrDefault(nvmetcp.ParseSubType, e.SubType, "nvme subsystem"); err != nil {
+		return entry, fmt.Errorf("subsystem type: %w", err)
+	}
+	if entry.Treq, err = parseOrDefault(nvmetcp.ParseTreq, e.Treq, "not specified"); err != nil {
+		return entry, fmt.Errorf("transport requirements: %w", err)
+	}
+	if entry.SecType, err = parseOrDefault(nvmetcp.ParseSecType, e.SecType, "none"); err != nil {
+		return entry, fmt.Errorf("security type: %w", err)
+	}
+	if entry.AdrFam, err = parseOrDefault(nvmetcp.ParseAdrFam, e.AdrFam, defaultAdrFam(entry.TrType, e.TrAddr)); err != nil {
+		return entry, fmt.Errorf("address family: %w", err)
+	}
+	if entry.CntlID == 0 {
+		entry.CntlID = 0xffff
+	}
+	if entry.AsqSz == 0 {
+		entry.AsqSz = 32
+	}
+	isDiscovery := entry.SubType != nvmetcp.SubTypeNVMe
+	if entry.SubNQN == "" && isDiscovery {
+		entry.SubNQN = DiscoveryNQN
+	}
+	if entry.TrSvcID == "" {
+		switch {
+		case entry.TrType == nvmetcp.TrTypeTCP && isDiscovery:
+			entry.TrSvcID = "8009"
+		case entry.TrType == nvmetcp.TrTypeTCP, entry.TrType == nvmetcp.TrTypeRDMA:
+			entry.TrSvcID = "4420"
+		}
+	}
+	return entry, nil
+}
+
+func parseOrDefault(parse func(string) (uint8, error), s, def string) (uint8, error) {
+	if s == "" {
+		s = def
+	}
+	return parse(s)
+}
+
+func defaultAdrFam(trType uint8, traddr string) string {
+	switch trType {
+	case nvmetcp.TrTypeFC:
+		return "fibre-channel"
+	case nvmetcp.TrTypeLoop:
+		return "intra-host"
+	}
+	if ip := net.ParseIP(traddr); ip != nil && ip.To4() == nil {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+// DiscoveryController is an NVMe/TCP discovery controller listening on 127.0.0.1.
+// It serves the discovery log to any host and is safe for concurrent use.
+type DiscoveryController struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu          sync.Mutex
+	closed      bool
+	log         nvmetcp.DiscoveryLog
+	delay       time.Duration
+	drop        bool
+	genCtrBumps int
+	conns       map[net.Conn]struct{}
+	hostNQNs    []string
+}
+
+// NewDiscoveryController starts a discovery controller serving entries
+// with a generation counter of 1
+func NewDiscoveryController(entries ...LogEntry) (*DiscoveryController, error) {
+	c := &DiscoveryController{conns: make(map[net.Conn]struct{})}
+	if err := c.SetEntries(entries...); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	c.listener = listener
+	c.wg.Add(1)
+	go c.serve()
+	return c, nil
+}
+
+// Address returns the host:port the controller listens on
+func (c *DiscoveryController) Address() string {
+	return c.listener.Addr().String()
+}
+
+// Host returns the IP address the controller listens on
+func (c *DiscoveryController) Host() string {
+	host, _, _ := net.SplitHostPort(c.Address())
+	return host
+}
+
+// Port returns the port the controller listens on
+func (c *DiscoveryController) Port() string {
+	_, port, _ := net.SplitHostPort(c.Address())
+	return port
+}
+
+// Close stops the controller, closes all connections and waits for them to finish
+func (c *DiscoveryController) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	err := c.listener.Close()
+	c.closeConnections()
+	c.wg.Wait()
+	return err
+}
+
+// SetEntries replaces the discovery log and increments its generation counter
+func (c *DiscoveryController) SetEntries(entries ...LogEntry) error {
+	log := make([]nvmetcp.DiscoveryLogEntry, 0, len(entries))
+	for i, e := range entries {
+		entry, err := e.toDiscoveryLogEntry()
+		if err != nil {
+			return fmt.Errorf("discovery log entry %d: %w", i, err)
+		}
+		log = append(log, entry)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log.Entries = log
+	c.log.NumRec = uint64(len(log))
+	c.log.GenCtr++
+	return nil
+}
+
+// GenCtr returns the generation counter of the discovery log
+func (c *DiscoveryController) GenCtr() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.log.GenCtr
+}
+
+// SetGenCtr sets the generation counter of the discovery log
+func (c *DiscoveryController) SetGenCtr(genCtr uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log.GenCtr = genCtr
+}
+
+// ChangeGenCtrOnRead increments the generation counter after each of the next n reads of
+// discovery log entries, as if the log changed while a host was reading it
+func (c *DiscoveryController) ChangeGenCtrOnRead(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.genCtrBumps = n
+}
+
+// SetDelay delays every response of the controller by delay
+func (c *DiscoveryController) SetDelay(delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delay = delay
+}
+
+// DropConnections closes all open connections and, while drop is true,
+// every new connection as soon as it is accepted
+func (c *DiscoveryController) DropConnections(drop bool) {
+	c.mu.Lock()
+	c.drop = drop
+	c.mu.Unlock()
+	if drop {
+		c.closeConnections()
+	}
+}
+
+// HostNQNs returns the NQNs of the hosts which connected, in order
+func (c *DiscoveryController) HostNQNs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.hostNQNs...)
+}
+
+func (c *DiscoveryController) closeConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for conn := range c.conns {
+		_ = conn.Close()
+	}
+}
+
+func (c *DiscoveryController) serve() {
+	defer c.wg.Done()
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		// a connection accepted while the controller closes is not served,
+		// closeConnections may have run before it was registered
+		c.mu.Lock()
+		if c.drop || c.closed {
+			c.mu.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		c.conns[conn] = struct{}{}
+		c.mu.Unlock()
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.serveConnection(conn)
+			c.mu.Lock()
+			delete(c.conns, conn)
+			c.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// serveConnection runs the admin queue of one host until it disconnects
+func (c *DiscoveryController) serveConnection(conn net.Conn) {
+	pdu, err := nvmetcp.ReadPDU(conn)
+	if err != nil || pdu.Type != nvmetcp.PDUTypeICReq {
+		return
+	}
+	if c.respond(conn, nvmetcp.NewICResp(nvmetcp.DiscoveryLogEntryLen)) != nil {
+		return
+	}
+
+	var cc uint64
+	for {
+		pdu, err := nvmetcp.ReadPDU(conn)
+		if err != nil || pdu.Type != nvmetcp.PDUTypeCapsuleCmd {
+			return
+		}
+		cmd, data, err := pdu.CapsuleCmd()
+		if err != nil {
+			return
+		}
+		cqe := nvmetcp.CQE{CID: cmd.CID()}
+
+		switch {
+		case cmd.Opcode() == nvmetcp.OpcodeFabrics && cmd.FCType() == nvmetcp.FCTypeConnect:
+			_, subNQN, hostNQN, err := nvmetcp.ParseConnectData(data)
+			if err != nil || subNQN != DiscoveryNQN {
+				cqe.Status = nvmetcp.StatusInvalidField
+				break
+			}
+			c.mu.Lock()
+			c.hostNQNs = append(c.hostNQNs, hostNQN)
+			c.mu.Unlock()
+			cqe.Result = 1
+		case cmd.Opcode() == nvmetcp.OpcodeFabrics && cmd.FCType() == nvmetcp.FCTypePropertySet:
+			if cmd.PropertyOffset() == nvmetcp.PropertyCC {
+				cc = cmd.PropertyValue()
+			}
+		case cmd.Opcode() == nvmetcp.OpcodeFabrics && cmd.FCType() == nvmetcp.FCTypePropertyGet:
+			cqe.Result = propertyValue(cmd.PropertyOffset(), cc)
+		case cmd.Opcode() == nvmetcp.OpcodeGetLogPage:
+			lid, offset, length := cmd.LogPage()
+			if lid != nvmetcp.LogPageDiscovery {
+				cqe.Status = nvmetcp.StatusInvalidField
+				break
+			}
+			if c.respond(conn, nvmetcp.NewC2HData(cqe.CID, 0, c.readLog(offset, length), true, true)) != nil {
+				return
+			}
+			continue
+		default:
+			cqe.Status = nvmetcp.StatusInvalidOpcode
+		}
+
+		if c.respond(conn, nvmetcp.NewCapsuleResp(cqe)) != nil {
+			return
+		}
+	}
+}
+
+// propertyValue returns the controller property at offset for the controller configuration cc
+func propertyValue(offset uint32, cc uint64) uint64 {
+	switch offset {
+	case nvmetcp.PropertyCAP:
+		// 32 entries queues, ready within 500ms, NVM command set
+		return 31 | 1<<24 | 1<<37
+	case nvmetcp.PropertyVS:
+		// NVMe 2.0
+		return 0x00020000
+	case nvmetcp.PropertyCC:
+		return cc
+	case nvmetcp.PropertyCSTS:
+		var csts uint64
+		if cc&1 != 0 {
+			csts |= 1
+		}
+		// shutdown complete
+		if cc&(3<<14) != 0 {
+			csts |= 2 << 2
+		}
+		return csts
+	}
+	return 0
+}
+
+// readLog returns length bytes of the discovery log from offset
+func (c *DiscoveryController) readLog(offset uint64, length uint32) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	page := c.log.Marshal()
+	data := make([]byte, length)
+	if offset < uint64(len(page)) {
+		copy(data, page[offset:])
+	}
+	if offset >= nvmetcp.DiscoveryLogHeaderLen && c.genCtrBumps > 0 {
+		c.genCtrBumps--
+		c.log.GenCtr++
+	}
+	return data
+}
+
+// respond writes pdu to the host after the configured delay
+func (c *DiscoveryController) respond(conn net.Conn, pdu nvmetcp.PDU) error {
+	c.mu.Lock()
+	delay := c.delay
+	c.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return nvmetcp.WritePDU(conn, pdu)
+}
@@ -0,0 +1,187 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gonvmetest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dell/gonvme/internal/nvmetcp"
+)
+
+const (
+	testTarget  = "nqn.1988-11.com.dell.mock:00:e6e2d5b871f1403E169D"
+	testHostNQN = "nqn.2014-08.org.nvmexpress:uuid:02a08600-57d6-4089-8736-bf1f7326990e"
+)
+
+func dial(t *testing.T, c *DiscoveryController) *nvmetcp.Client {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	client, err := nvmetcp.Dial(ctx, c.Address(), testHostNQN, [16]byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestDiscoveryController(t *testing.T) {
+	c, err := NewDiscoveryController(
+		TCPEntry(testTarget, "10.230.1.1", "4420"),
+		TCPEntry(testTarget, "fd00::1", ""),
+		FCEntry(testTarget, "nn-0x58ccf090c9200c22:pn-0x58ccf091492b0c22"),
+		RDMAEntry(testTarget, "10.230.2.1", ""),
+		ReferralEntry("10.230.1.3", ""),
+		LogEntry{TrAddr: "10.230.1.4", Treq: "required", SecType: "tls1.3"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Host() != "127.0.0.1" || c.Port() == "" {
+		t.Errorf("Unexpected address %s", c.Address())
+	}
+
+	log, err := dial(t, c).GetDiscoveryLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.GenCtr != 1 || log.NumRec != 6 || len(log.Entries) != 6 {
+		t.Fatalf("Unexpected discovery log %+v", log)
+	}
+	expected := []nvmetcp.DiscoveryLogEntry{
+		{TrType: nvmetcp.TrTypeTCP, AdrFam: nvmetcp.AdrFamIPv4, SubType: nvmetcp.SubTypeNVMe, CntlID: 0xffff, AsqSz: 32, TrSvcID: "4420", SubNQN: testTarget, TrAddr: "10.230.1.1"},
+		{TrType: nvmetcp.TrTypeTCP, AdrFam: nvmetcp.AdrFamIPv6, SubType: nvmetcp.SubTypeNVMe, CntlID: 0xffff, AsqSz: 32, TrSvcID: "4420", SubNQN: testTarget, TrAddr: "fd00::1"},
+		{TrType: nvmetcp.TrTypeFC, AdrFam: nvmetcp.AdrFamFC, SubType: nvmetcp.SubTypeNVMe, CntlID: 0xffff, AsqSz: 32, SubNQN: testTarget, TrAddr: "nn-0x58ccf090c9200c22:pn-0x58ccf091492b0c22"},
+		{TrType: nvmetcp.TrTypeRDMA, AdrFam: nvmetcp.AdrFamIPv4, SubType: nvmetcp.SubTypeNVMe, CntlID: 0xffff, AsqSz: 32, TrSvcID: "4420", SubNQN: testTarget, TrAddr: "10.230.2.1"},
+		{TrType: nvmetcp.TrTypeTCP, AdrFam: nvmetcp.AdrFamIPv4, SubType: nvmetcp.SubTypeReferral, CntlID: 0xffff, AsqSz: 32, TrSvcID: "8009", SubNQN: DiscoveryNQN, TrAddr: "10.230.1.3"},
+		{TrType: nvmetcp.TrTypeTCP, AdrFam: nvmetcp.AdrFamIPv4, SubType: nvmetcp.SubTypeNVMe, Treq: nvmetcp.TreqRequired, CntlID: 0xffff, AsqSz: 32, TrSvcID: "4420", TrAddr: "10.230.1.4", SecType: nvmetcp.SecTypeTLS13},
+	}
+	for i := range expected {
+		if log.Entries[i] != expected[i] {
+			t.Errorf("Expected entry %+v, but got %+v", expected[i], log.Entries[i])
+		}
+	}
+	if hosts := c.HostNQNs(); len(hosts) != 1 || hosts[0] != testHostNQN {
+		t.Errorf("Unexpected host NQNs %v", hosts)
+	}
+}
+
+func TestDiscoveryControllerInvalidEntry(t *testing.T) {
+	if _, err := NewDiscoveryController(LogEntry{TrType: "iscsi"}); err == nil {
+		t.Error("Expected an error for an unknown transport type")
+	}
+	if _, err := NewDiscoveryController(LogEntry{SecType: "tls9"}); err == nil {
+		t.Error("Expected an error for an unknown security type")
+	}
+}
+
+func TestDiscoveryControllerSetEntries(t *testing.T) {
+	c, err := NewDiscoveryController(TCPEntry(testTarget, "10.230.1.1", "4420"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	client := dial(t, c)
+
+	if err = c.SetEntries(); err != nil {
+		t.Fatal(err)
+	}
+	log, err := client.GetDiscoveryLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.GenCtr != 2 || log.NumRec != 0 {
+		t.Errorf("Unexpected discovery log %+v", log)
+	}
+
+	c.SetGenCtr(42)
+	if log, err = client.GetDiscoveryLog(); err != nil || log.GenCtr != 42 {
+		t.Errorf("Expected generation counter 42, but got %+v, %v", log, err)
+	}
+}
+
+func TestDiscoveryControllerFaults(t *testing.T) {
+	c, err := NewDiscoveryController(TCPEntry(testTarget, "10.230.1.1", "4420"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	client := dial(t, c)
+	c.ChangeGenCtrOnRead(1)
+	log, err := client.GetDiscoveryLog()
+	if err != nil || log.GenCtr != 2 {
+		t.Errorf("Expected the discovery log of generation 2, but got %+v, %v", log, err)
+	}
+
+	c.DropConnections(true)
+	if _, err = client.GetDiscoveryLog(); err == nil {
+		t.Error("Expected an error on a dropped connection")
+	}
+	if _, err = nvmetcp.Dial(context.Background(), c.Address(), testHostNQN, [16]byte{1}); err == nil {
+		t.Error("Expected connections to be dropped")
+	}
+	c.DropConnections(false)
+
+	c.SetDelay(20 * time.Millisecond)
+	start := time.Now()
+	dial(t, c)
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("Expected responses to be delayed")
+	}
+}
+
+func TestDiscoveryControllerCloseWhileConnecting(t *testing.T) {
+	c, err := NewDiscoveryController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hosts which connect and send nothing keep their connection open until it is closed
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if conn, err := net.Dial("tcp", c.Address()); err == nil {
+					defer conn.Close()
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected Close to return")
+	}
+	close(stop)
+	wg.Wait()
+}
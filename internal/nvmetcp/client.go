@@ -0,0 +1,306 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nvmetcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// adminQueueSize is the number of entries of the admin queue requested by Connect
+	adminQueueSize = 32
+
+	// logPageChunk bounds the size of a single Get Log Page transfer
+	logPageChunk = 4096
+
+	// maxGenCtrRetries bounds the re-reads of a discovery log which changes while it is read
+	maxGenCtrRetries = 10
+
+	ccEnable       = 1 << 0
+	ccShutdown     = 1 << 14
+	ccIOSQES       = 6 << 16
+	ccIOCQES       = 4 << 20
+	cstsReady      = 1 << 0
+	readyPollDelay = 10 * time.Millisecond
+)
+
+// IOTimeout bounds each exchange with the discovery controller, so that one which stops
+// answering does not block a caller whose context has no deadline
+var IOTimeout = 30 * time.Second
+
+// Client is a host connected to the admin queue of a discovery controller over NVMe/TCP
+type Client struct {
+	conn   net.Conn
+	cid    uint16
+	CntlID uint16
+	stop   func() bool
+
+	// mu guards err, the error of ctx once it is done, against arming the deadline after it
+	mu  sync.Mutex
+	err error
+}
+
+// Dial connects to the discovery controller at address, which is in host:port form,
+// as the host identified by hostNQN and hostID, and enables the controller.
+// The connection is bound by ctx until Close.
+func Dial(ctx context.Context, address, hostNQN string, hostID [16]byte) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn}
+	// unblock any pending I/O once ctx is done
+	c.stop = context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.err = ctx.Err()
+		_ = conn.SetDeadline(time.Now())
+	})
+
+	if err = c.initialize(); err == nil {
+		err = c.connect(hostNQN, hostID)
+	}
+	if err == nil {
+		err = c.enable(ctx)
+	}
+	if err != nil {
+		c.stop()
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close shuts the controller down and closes the connection
+func (c *Client) Close() error {
+	_ = c.PropertySet(PropertyCC, ccShutdown|ccIOSQES|ccIOCQES)
+	c.stop()
+	return c.conn.Close()
+}
+
+// arm bounds the next exchange with the controller by IOTimeout, or fails once ctx is done
+func (c *Client) arm() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.conn.SetDeadline(time.Now().Add(IOTimeout))
+}
+
+func (c *Client) initialize() error {
+	if err := c.arm(); err != nil {
+		return err
+	}
+	if err := WritePDU(c.conn, NewICReq()); err != nil {
+		return err
+	}
+	pdu, err := ReadPDU(c.conn)
+	if err != nil {
+		return err
+	}
+	if pdu.Type != PDUTypeICResp {
+		return fmt.Errorf("unexpected PDU %#x in response to ICReq", pdu.Type)
+	}
+	if pdu.Header[0] != 0 || pdu.Header[1] != 0 {
+		return fmt.Errorf("unsupported PDU format version %d", uint16(pdu.Header[0])|uint16(pdu.Header[1])<<8)
+	}
+	if pdu.Header[2] != 0 {
+		return fmt.Errorf("unsupported controller PDU data alignment %d", pdu.Header[2])
+	}
+	return nil
+}
+
+func (c *Client) connect(hostNQN string, hostID [16]byte) error {
+	cqe, _, err := c.submit("Connect", NewConnectCommand(adminQueueSize, 0), NewConnectData(hostID, DiscoveryNQN, hostNQN), 0)
+	if err != nil {
+		return err
+	}
+	c.CntlID = uint16(cqe.Result) // #nosec G115
+	return nil
+}
+
+func (c *Client) enable(ctx context.Context) error {
+	capabilities, err := c.PropertyGet(PropertyCAP, true)
+	if err != nil {
+		return err
+	}
+	if err = c.PropertySet(PropertyCC, ccEnable|ccIOSQES|ccIOCQES); err != nil {
+		return err
+	}
+	// CAP.TO is the worst case time to become ready in 500ms units
+	timeout := time.Duration((capabilities>>24)&0xff) * 500 * time.Millisecond
+	if timeout == 0 {
+		timeout = 500 * time.Millisecond
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		csts, err := c.PropertyGet(PropertyCSTS, false)
+		if err != nil {
+			return err
+		}
+		if csts&cstsReady != 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New("discovery controller did not become ready")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readyPollDelay):
+		}
+	}
+}
+
+// PropertyGet reads a 4 byte or, if wide, 8 byte controller property
+func (c *Client) PropertyGet(offset uint32, wide bool) (uint64, error) {
+	cqe, _, err := c.submit("Property Get", NewPropertyGetCommand(offset, wide), nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !wide {
+		return cqe.Result & 0xffffffff, nil
+	}
+	return cqe.Result, nil
+}
+
+// PropertySet writes a 4 byte controller property
+func (c *Client) PropertySet(offset uint32, value uint32) error {
+	_, _, err := c.submit("Property Set", NewPropertySetCommand(offset, value), nil, 0)
+	return err
+}
+
+// GetLogPage reads length bytes of the log page lid starting at offset
+func (c *Client) GetLogPage(lid uint8, offset uint64, length uint32) ([]byte, error) {
+	data := make([]byte, 0, length)
+	for uint32(len(data)) < length { // #nosec G115
+		chunk := length - uint32(len(data)) // #nosec G115
+		if chunk > logPageChunk {
+			chunk = logPageChunk
+		}
+		_, page, err := c.submit("Get Log Page", NewGetLogPageCommand(lid, offset+uint64(len(data)), chunk), nil, chunk)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, page...)
+	}
+	return data, nil
+}
+
+// GetDiscoveryLog reads the whole discovery log page, re-reading it if it changes in between
+func (c *Client) GetDiscoveryLog() (DiscoveryLog, error) {
+	for retry := 0; retry < maxGenCtrRetries; retry++ {
+		header, err := c.GetLogPage(LogPageDiscovery, 0, DiscoveryLogHeaderLen)
+		if err != nil {
+			return DiscoveryLog{}, err
+		}
+		log, err := UnmarshalDiscoveryLogHeader(header)
+		if err != nil {
+			return DiscoveryLog{}, err
+		}
+		if log.NumRec == 0 {
+			return log, nil
+		}
+		if log.NumRec > maxPDULen/DiscoveryLogEntryLen {
+			return DiscoveryLog{}, fmt.Errorf("discovery log with %d records is too large", log.NumRec)
+		}
+
+		entries, err := c.GetLogPage(LogPageDiscovery, DiscoveryLogHeaderLen, uint32(log.NumRec)*DiscoveryLogEntryLen) // #nosec G115
+		if err != nil {
+			return DiscoveryLog{}, err
+		}
+		header, err = c.GetLogPage(LogPageDiscovery, 0, DiscoveryLogHeaderLen)
+		if err != nil {
+			return DiscoveryLog{}, err
+		}
+		current, err := UnmarshalDiscoveryLogHeader(header)
+		if err != nil {
+			return DiscoveryLog{}, err
+		}
+		if current.GenCtr != log.GenCtr {
+			continue
+		}
+
+		for i := uint64(0); i < log.NumRec; i++ {
+			entry, err := UnmarshalDiscoveryLogEntry(entries[i*DiscoveryLogEntryLen:])
+			if err != nil {
+				return DiscoveryLog{}, err
+			}
+			log.Entries = append(log.Entries, entry)
+		}
+		return log, nil
+	}
+	return DiscoveryLog{}, errors.New("discovery log kept changing while it was read")
+}
+
+// submit sends cmd with its in-capsule data and waits for its completion,
+// collecting up to expect bytes the controller transfers to the host
+func (c *Client) submit(name string, cmd SQE, data []byte, expect uint32) (CQE, []byte, error) {
+	if err := c.arm(); err != nil {
+		return CQE{}, nil, err
+	}
+	c.cid++
+	cmd.SetCID(c.cid)
+	if err := WritePDU(c.conn, NewCapsuleCmd(cmd, data)); err != nil {
+		return CQE{}, nil, err
+	}
+
+	buf := make([]byte, expect)
+	for {
+		pdu, err := ReadPDU(c.conn)
+		if err != nil {
+			return CQE{}, nil, err
+		}
+		switch pdu.Type {
+		case PDUTypeC2HData:
+			cid, offset, err := pdu.C2HData()
+			if err != nil {
+				return CQE{}, nil, err
+			}
+			if cid != c.cid || uint64(offset)+uint64(len(pdu.Data)) > uint64(expect) {
+				return CQE{}, nil, fmt.Errorf("unexpected data for command %d at offset %d", cid, offset)
+			}
+			copy(buf[offset:], pdu.Data)
+			if pdu.Flags&FlagDataSuccess != 0 {
+				return CQE{CID: cid}, buf, nil
+			}
+		case PDUTypeCapsuleResp:
+			cqe, err := pdu.CapsuleResp()
+			if err != nil {
+				return CQE{}, nil, err
+			}
+			if cqe.CID != c.cid {
+				return CQE{}, nil, fmt.Errorf("unexpected completion for command %d", cqe.CID)
+			}
+			if cqe.Status != 0 {
+				return cqe, nil, &StatusError{Command: name, Status: cqe.Status}
+			}
+			return cqe, buf, nil
+		case PDUTypeC2HTermReq:
+			return CQE{}, nil, errors.New("discovery controller terminated the connection")
+		default:
+			return CQE{}, nil, fmt.Errorf("unexpected PDU %#x", pdu.Type)
+		}
+	}
+}
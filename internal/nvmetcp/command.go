@@ -0,0 +1,228 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nvmetcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Command opcodes
+const (
+	OpcodeGetLogPage uint8 = 0x02
+	OpcodeFabrics    uint8 = 0x7f
+)
+
+// Fabrics command types
+const (
+	FCTypePropertySet uint8 = 0x00
+	FCTypeConnect     uint8 = 0x01
+	FCTypePropertyGet uint8 = 0x04
+)
+
+// Controller properties
+const (
+	PropertyCAP  uint32 = 0x00
+	PropertyVS   uint32 = 0x08
+	PropertyCC   uint32 = 0x14
+	PropertyCSTS uint32 = 0x1c
+)
+
+// LogPageDiscovery is the log identifier of the discovery log page
+const LogPageDiscovery uint8 = 0x70
+
+// ConnectDataLen is the size of the data of a Connect command
+const ConnectDataLen = 1024
+
+const (
+	cqeLen = 16
+
+	// cmdFlagSGL selects SGLs for the data transfer of a command
+	cmdFlagSGL uint8 = 0x40
+	// sglInCapsule is an SGL data block descriptor addressing in-capsule data
+	sglInCapsule uint8 = 0x01
+	// sglTransport is a transport SGL data block descriptor addressing data transferred by the transport
+	sglTransport uint8 = 0x5a
+)
+
+// SQE is a 64 byte submission queue entry
+type SQE [64]byte
+
+// Opcode returns the opcode of the command
+func (s *SQE) Opcode() uint8 { return s[0] }
+
+// FCType returns the command type of a fabrics command
+func (s *SQE) FCType() uint8 { return s[4] }
+
+// CID returns the command identifier
+func (s *SQE) CID() uint16 { return binary.LittleEndian.Uint16(s[2:4]) }
+
+// SetCID sets the command identifier
+func (s *SQE) SetCID(cid uint16) { binary.LittleEndian.PutUint16(s[2:4], cid) }
+
+// CDW returns command dword n
+func (s *SQE) CDW(n int) uint32 { return binary.LittleEndian.Uint32(s[4*n : 4*n+4]) }
+
+// DataLength returns the length of the data addressed by the SGL of the command
+func (s *SQE) DataLength() uint32 { return binary.LittleEndian.Uint32(s[32:36]) }
+
+// PropertyOffset returns the offset of the property a Property Get or Set command accesses
+func (s *SQE) PropertyOffset() uint32 { return binary.LittleEndian.Uint32(s[44:48]) }
+
+// PropertyValue returns the value written by a Property Set command
+func (s *SQE) PropertyValue() uint64 { return binary.LittleEndian.Uint64(s[48:56]) }
+
+// LogPage returns the log identifier, offset and length of a Get Log Page command
+func (s *SQE) LogPage() (lid uint8, offset uint64, length uint32) {
+	numd := (s.CDW(10) >> 16) | (s.CDW(11)&0xffff)<<16
+	offset = uint64(s.CDW(12)) | uint64(s.CDW(13))<<32
+	return uint8(s.CDW(10) & 0xff), offset, (numd + 1) * 4 // #nosec G115
+}
+
+func (s *SQE) setSGL(descriptor uint8, length uint32) {
+	s[1] = cmdFlagSGL
+	binary.LittleEndian.PutUint32(s[32:36], length)
+	s[39] = descriptor
+}
+
+// NewConnectCommand returns a Connect command for the admin queue with sqsize entries
+// and a keep alive timeout of kato milliseconds. Its data is built by NewConnectData.
+func NewConnectCommand(sqsize uint16, kato uint32) SQE {
+	var s SQE
+	s[0] = OpcodeFabrics
+	s[4] = FCTypeConnect
+	s.setSGL(sglInCapsule, ConnectDataLen)
+	binary.LittleEndian.PutUint16(s[44:46], sqsize-1)
+	binary.LittleEndian.PutUint32(s[48:52], kato)
+	return s
+}
+
+// NewConnectData returns the data of a Connect command for a new dynamic controller
+func NewConnectData(hostID [16]byte, subNQN, hostNQN string) []byte {
+	data := make([]byte, ConnectDataLen)
+	copy(data[0:16], hostID[:])
+	binary.LittleEndian.PutUint16(data[16:18], 0xffff)
+	copy(data[256:512], subNQN)
+	copy(data[512:768], hostNQN)
+	return data
+}
+
+// ParseConnectData returns the host identifier, subsystem NQN and host NQN of Connect command data
+func ParseConnectData(data []byte) (hostID [16]byte, subNQN, hostNQN string, err error) {
+	if len(data) < ConnectDataLen {
+		return hostID, "", "", fmt.Errorf("short connect data: %d bytes", len(data))
+	}
+	copy(hostID[:], data[0:16])
+	return hostID, cString(data[256:512]), cString(data[512:768]), nil
+}
+
+// NewPropertyGetCommand returns a Property Get command for a 4 or 8 byte property
+func NewPropertyGetCommand(offset uint32, wide bool) SQE {
+	var s SQE
+	s[0] = OpcodeFabrics
+	s[4] = FCTypePropertyGet
+	if wide {
+		s[40] = 1
+	}
+	binary.LittleEndian.PutUint32(s[44:48], offset)
+	return s
+}
+
+// NewPropertySetCommand returns a Property Set command for a 4 byte property
+func NewPropertySetCommand(offset uint32, value uint32) SQE {
+	var s SQE
+	s[0] = OpcodeFabrics
+	s[4] = FCTypePropertySet
+	binary.LittleEndian.PutUint32(s[44:48], offset)
+	binary.LittleEndian.PutUint64(s[48:56], uint64(value))
+	return s
+}
+
+// NewGetLogPageCommand returns a Get Log Page command reading length bytes of log lid from offset
+func NewGetLogPageCommand(lid uint8, offset uint64, length uint32) SQE {
+	var s SQE
+	s[0] = OpcodeGetLogPage
+	numd := length/4 - 1
+	s.setSGL(sglTransport, length)
+	binary.LittleEndian.PutUint32(s[40:44], uint32(lid)|(numd&0xffff)<<16)
+	binary.LittleEndian.PutUint32(s[44:48], numd>>16)
+	binary.LittleEndian.PutUint32(s[48:52], uint32(offset))     // #nosec G115
+	binary.LittleEndian.PutUint32(s[52:56], uint32(offset>>32)) // #nosec G115
+	return s
+}
+
+// CQE is a completion queue entry
+type CQE struct {
+	// Result holds command specific dwords 0 and 1
+	Result uint64
+	SQHead uint16
+	SQID   uint16
+	CID    uint16
+	// Status is the status field without the phase tag, 0 on success
+	Status uint16
+}
+
+// Status codes used by a discovery controller
+const (
+	StatusInvalidOpcode uint16 = 0x01
+	StatusInvalidField  uint16 = 0x02
+	StatusInternalError uint16 = 0x06
+	// StatusConnectInvalidHost is the command specific status of a Connect command for a host
+	// that is not allowed to access the subsystem
+	StatusConnectInvalidHost uint16 = 0x1<<8 | 0x84
+)
+
+// Marshal returns the 16 byte wire format of the completion
+func (c CQE) Marshal() []byte {
+	b := make([]byte, cqeLen)
+	binary.LittleEndian.PutUint64(b[0:8], c.Result)
+	binary.LittleEndian.PutUint16(b[8:10], c.SQHead)
+	binary.LittleEndian.PutUint16(b[10:12], c.SQID)
+	binary.LittleEndian.PutUint16(b[12:14], c.CID)
+	binary.LittleEndian.PutUint16(b[14:16], c.Status<<1)
+	return b
+}
+
+// UnmarshalCQE decodes a completion from its wire format
+func UnmarshalCQE(b []byte) CQE {
+	return CQE{
+		Result: binary.LittleEndian.Uint64(b[0:8]),
+		SQHead: binary.LittleEndian.Uint16(b[8:10]),
+		SQID:   binary.LittleEndian.Uint16(b[10:12]),
+		CID:    binary.LittleEndian.Uint16(b[12:14]),
+		Status: binary.LittleEndian.Uint16(b[14:16]) >> 1,
+	}
+}
+
+// StatusError reports a command which completed with a non-zero status
+type StatusError struct {
+	Command string
+	Status  uint16
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s failed with status %#x (sct %d, sc %#x)", e.Command, e.Status, (e.Status>>8)&0x7, e.Status&0xff)
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,290 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nvmetcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// DiscoveryNQN is the well-known NQN of the discovery subsystem
+const DiscoveryNQN = "nqn.2014-08.org.nvmexpress.discovery"
+
+// DiscoveryLogHeaderLen and DiscoveryLogEntryLen are the sizes of the parts of the discovery log page
+const (
+	DiscoveryLogHeaderLen = 1024
+	DiscoveryLogEntryLen  = 1024
+)
+
+// Transport types
+const (
+	TrTypeRDMA uint8 = 1
+	TrTypeFC   uint8 = 2
+	TrTypeTCP  uint8 = 3
+	TrTypeLoop uint8 = 254
+)
+
+// Address families
+const (
+	AdrFamIPv4 uint8 = 1
+	AdrFamIPv6 uint8 = 2
+	AdrFamIB   uint8 = 3
+	AdrFamFC   uint8 = 4
+	AdrFamLoop uint8 = 254
+)
+
+// Subsystem types
+const (
+	SubTypeReferral  uint8 = 1
+	SubTypeNVMe      uint8 = 2
+	SubTypeCurrentDC uint8 = 3
+)
+
+// Transport requirements
+const (
+	TreqNotSpecified         uint8 = 0
+	TreqRequired             uint8 = 1
+	TreqNotRequired          uint8 = 2
+	TreqDisableSQFlowControl uint8 = 1 << 2
+)
+
+// Security types of the NVMe/TCP transport specific address subtype
+const (
+	SecTypeNone  uint8 = 0
+	SecTypeTLS12 uint8 = 1
+	SecTypeTLS13 uint8 = 2
+)
+
+// Entry flags
+const (
+	EFlagExplicitDiscoveryConnections uint16 = 1 << 0
+	EFlagDuplicateReturnedInformation uint16 = 1 << 1
+	EFlagNoCDCConnectivity            uint16 = 1 << 2
+)
+
+// DiscoveryLog is a decoded discovery log page
+type DiscoveryLog struct {
+	GenCtr  uint64
+	NumRec  uint64
+	RecFmt  uint16
+	Entries []DiscoveryLogEntry
+}
+
+// DiscoveryLogEntry is a decoded discovery log page entry
+type DiscoveryLogEntry struct {
+	TrType  uint8
+	AdrFam  uint8
+	SubType uint8
+	Treq    uint8
+	PortID  uint16
+	CntlID  uint16
+	AsqSz   uint16
+	EFlags  uint16
+	TrSvcID string
+	SubNQN  string
+	TrAddr  string
+	// SecType is the security type of an NVMe/TCP entry
+	SecType uint8
+}
+
+// Marshal returns the wire format of the whole discovery log page
+func (l DiscoveryLog) Marshal() []byte {
+	b := make([]byte, DiscoveryLogHeaderLen+len(l.Entries)*DiscoveryLogEntryLen)
+	binary.LittleEndian.PutUint64(b[0:8], l.GenCtr)
+	binary.LittleEndian.PutUint64(b[8:16], l.NumRec)
+	binary.LittleEndian.PutUint16(b[16:18], l.RecFmt)
+	for i, e := range l.Entries {
+		e.marshal(b[DiscoveryLogHeaderLen+i*DiscoveryLogEntryLen:])
+	}
+	return b
+}
+
+func (e DiscoveryLogEntry) marshal(b []byte) {
+	b[0] = e.TrType
+	b[1] = e.AdrFam
+	b[2] = e.SubType
+	b[3] = e.Treq
+	binary.LittleEndian.PutUint16(b[4:6], e.PortID)
+	binary.LittleEndian.PutUint16(b[6:8], e.CntlID)
+	binary.LittleEndian.PutUint16(b[8:10], e.AsqSz)
+	binary.LittleEndian.PutUint16(b[10:12], e.EFlags)
+	putPadded(b[32:64], e.TrSvcID)
+	copy(b[256:512], e.SubNQN)
+	putPadded(b[512:768], e.TrAddr)
+	if e.TrType == TrTypeTCP {
+		b[768] = e.SecType
+	}
+}
+
+// UnmarshalDiscoveryLogHeader decodes the generation counter, number of records
+// and record format from the header of a discovery log page
+func UnmarshalDiscoveryLogHeader(b []byte) (DiscoveryLog, error) {
+	if len(b) < 18 {
+		return DiscoveryLog{}, fmt.Errorf("short discovery log header: %d bytes", len(b))
+	}
+	return DiscoveryLog{
+		GenCtr: binary.LittleEndian.Uint64(b[0:8]),
+		NumRec: binary.LittleEndian.Uint64(b[8:16]),
+		RecFmt: binary.LittleEndian.Uint16(b[16:18]),
+	}, nil
+}
+
+// UnmarshalDiscoveryLogEntry decodes one entry of a discovery log page
+func UnmarshalDiscoveryLogEntry(b []byte) (DiscoveryLogEntry, error) {
+	if len(b) < DiscoveryLogEntryLen {
+		return DiscoveryLogEntry{}, fmt.Errorf("short discovery log entry: %d bytes", len(b))
+	}
+	e := DiscoveryLogEntry{
+		TrType:  b[0],
+		AdrFam:  b[1],
+		SubType: b[2],
+		Treq:    b[3],
+		PortID:  binary.LittleEndian.Uint16(b[4:6]),
+		CntlID:  binary.LittleEndian.Uint16(b[6:8]),
+		AsqSz:   binary.LittleEndian.Uint16(b[8:10]),
+		EFlags:  binary.LittleEndian.Uint16(b[10:12]),
+		TrSvcID: trimPadded(b[32:64]),
+		SubNQN:  cString(b[256:512]),
+		TrAddr:  trimPadded(b[512:768]),
+	}
+	if e.TrType == TrTypeTCP {
+		e.SecType = b[768]
+	}
+	return e, nil
+}
+
+// putPadded stores an ASCII string field, which the specification pads with spaces
+func putPadded(b []byte, s string) {
+	n := copy(b, s)
+	for i := n; i < len(b); i++ {
+		b[i] = ' '
+	}
+}
+
+func trimPadded(b []byte) string {
+	return strings.TrimRight(cString(b), " ")
+}
+
+var (
+	trTypeNames = map[uint8]string{
+		TrTypeRDMA: "rdma",
+		TrTypeFC:   "fc",
+		TrTypeTCP:  "tcp",
+		TrTypeLoop: "loop",
+	}
+	adrFamNames = map[uint8]string{
+		AdrFamIPv4: "ipv4",
+		AdrFamIPv6: "ipv6",
+		AdrFamIB:   "infiniband",
+		AdrFamFC:   "fibre-channel",
+		AdrFamLoop: "intra-host",
+	}
+	subTypeNames = map[uint8]string{
+		SubTypeReferral:  "discovery subsystem referral",
+		SubTypeNVMe:      "nvme subsystem",
+		SubTypeCurrentDC: "current discovery subsystem",
+	}
+	treqNames = map[uint8]string{
+		TreqNotSpecified: "not specified",
+		TreqRequired:     "required",
+		TreqNotRequired:  "not required",
+	}
+	secTypeNames = map[uint8]string{
+		SecTypeNone:  "none",
+		SecTypeTLS12: "tls1.2",
+		SecTypeTLS13: "tls1.3",
+	}
+)
+
+func name(names map[uint8]string, v uint8) string {
+	if s, ok := names[v]; ok {
+		return s
+	}
+	return "unrecognized"
+}
+
+func value(names map[uint8]string, s string) (uint8, error) {
+	for v, n := range names {
+		if n == s {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized value %q", s)
+}
+
+// TrTypeName returns the name nvme-cli prints for a transport type
+func TrTypeName(v uint8) string { return name(trTypeNames, v) }
+
+// ParseTrType returns the transport type with the given name
+func ParseTrType(s string) (uint8, error) { return value(trTypeNames, s) }
+
+// AdrFamName returns the name nvme-cli prints for an address family
+func AdrFamName(v uint8) string { return name(adrFamNames, v) }
+
+// ParseAdrFam returns the address family with the given name
+func ParseAdrFam(s string) (uint8, error) { return value(adrFamNames, s) }
+
+// SubTypeName returns the name nvme-cli prints for a subsystem type
+func SubTypeName(v uint8) string { return name(subTypeNames, v) }
+
+// ParseSubType returns the subsystem type with the given name
+func ParseSubType(s string) (uint8, error) { return value(subTypeNames, s) }
+
+// TreqName returns the text nvme-cli prints for the transport requirements
+func TreqName(v uint8) string {
+	s := name(treqNames, v&0x3)
+	if v&TreqDisableSQFlowControl != 0 {
+		s += ", sq flow control disable supported"
+	}
+	return s
+}
+
+// ParseTreq returns the transport requirements described by s
+func ParseTreq(s string) (uint8, error) {
+	var flags uint8
+	if base, found := strings.CutSuffix(s, ", sq flow control disable supported"); found {
+		s = base
+		flags = TreqDisableSQFlowControl
+	}
+	v, err := value(treqNames, s)
+	return v | flags, err
+}
+
+// SecTypeName returns the name nvme-cli prints for a security type
+func SecTypeName(v uint8) string { return name(secTypeNames, v) }
+
+// ParseSecType returns the security type with the given name
+func ParseSecType(s string) (uint8, error) { return value(secTypeNames, s) }
+
+// EFlagsName returns the text nvme-cli prints for the entry flags
+func EFlagsName(v uint16) string {
+	var flags []string
+	if v&EFlagExplicitDiscoveryConnections != 0 {
+		flags = append(flags, "explicit discovery connections")
+	}
+	if v&EFlagDuplicateReturnedInformation != 0 {
+		flags = append(flags, "duplicate discovery information")
+	}
+	if v&EFlagNoCDCConnectivity != 0 {
+		flags = append(flags, "no cdc connectivity")
+	}
+	if len(flags) == 0 {
+		return "none"
+	}
+	return strings.Join(flags, ", ")
+}
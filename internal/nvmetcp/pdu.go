@@ -0,0 +1,185 @@
+/*
+ *
+ * Copyright © 2026 Dell Inc. or its subsidiaries. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package nvmetcp implements the parts of the NVMe/TCP transport and the NVMe over Fabrics
+// command set needed to talk to a discovery controller, from either side of the connection.
+package nvmetcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NVMe/TCP PDU types
+const (
+	PDUTypeICReq       uint8 = 0x00
+	PDUTypeICResp      uint8 = 0x01
+	PDUTypeH2CTermReq  uint8 = 0x02
+	PDUTypeC2HTermReq  uint8 = 0x03
+	PDUTypeCapsuleCmd  uint8 = 0x04
+	PDUTypeCapsuleResp uint8 = 0x05
+	PDUTypeH2CData     uint8 = 0x06
+	PDUTypeC2HData     uint8 = 0x07
+	PDUTypeR2T         uint8 = 0x09
+)
+
+// NVMe/TCP PDU flags
+const (
+	FlagHeaderDigest uint8 = 1 << 0
+	FlagDataDigest   uint8 = 1 << 1
+	FlagDataLast     uint8 = 1 << 2
+	FlagDataSuccess  uint8 = 1 << 3
+)
+
+const (
+	commonHeaderLen  = 8
+	icLen            = 128
+	capsuleRespLen   = 24
+	c2hDataHeaderLen = 24
+
+	// maxPDULen bounds the PDUs accepted from the peer
+	maxPDULen = 1 << 20
+)
+
+// PDU is an NVMe/TCP protocol data unit without digests
+type PDU struct {
+	Type  uint8
+	Flags uint8
+	// Header holds the PDU specific header which follows the 8 byte common header
+	Header []byte
+	Data   []byte
+}
+
+// ReadPDU reads the next PDU from r
+func ReadPDU(r io.Reader) (PDU, error) {
+	ch := make([]byte, commonHeaderLen)
+	if _, err := io.ReadFull(r, ch); err != nil {
+		return PDU{}, err
+	}
+	pdu := PDU{Type: ch[0], Flags: ch[1]}
+	hlen := int(ch[2])
+	pdo := int(ch[3])
+	plen := int(binary.LittleEndian.Uint32(ch[4:8]))
+	if hlen < commonHeaderLen || plen < hlen || plen > maxPDULen {
+		return PDU{}, fmt.Errorf("invalid PDU: type %#x hlen %d plen %d", pdu.Type, hlen, plen)
+	}
+	if pdu.Flags&(FlagHeaderDigest|FlagDataDigest) != 0 {
+		return PDU{}, errors.New("PDU digests are not supported")
+	}
+
+	rest := make([]byte, plen-commonHeaderLen)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return PDU{}, err
+	}
+	pdu.Header = rest[:hlen-commonHeaderLen]
+	if plen > hlen {
+		if pdo < hlen {
+			pdo = hlen
+		}
+		if pdo > plen {
+			return PDU{}, fmt.Errorf("invalid PDU data offset %d", pdo)
+		}
+		pdu.Data = rest[pdo-commonHeaderLen:]
+	}
+	return pdu, nil
+}
+
+// WritePDU writes p to w, with the data directly following the header
+func WritePDU(w io.Writer, p PDU) error {
+	hlen := commonHeaderLen + len(p.Header)
+	plen := hlen + len(p.Data)
+	buf := make([]byte, plen)
+	buf[0] = p.Type
+	buf[1] = p.Flags
+	buf[2] = uint8(hlen) // #nosec G115 -- PDU headers are at most 128 bytes
+	if len(p.Data) > 0 {
+		buf[3] = uint8(hlen) // #nosec G115
+	}
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(plen)) // #nosec G115
+	copy(buf[commonHeaderLen:], p.Header)
+	copy(buf[hlen:], p.Data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// NewICReq returns the initialize connection request of a host which uses neither digests nor padding
+func NewICReq() PDU {
+	return PDU{Type: PDUTypeICReq, Header: make([]byte, icLen-commonHeaderLen)}
+}
+
+// NewICResp returns the initialize connection response of a controller which accepts
+// H2C data PDUs of up to maxH2CData bytes
+func NewICResp(maxH2CData uint32) PDU {
+	header := make([]byte, icLen-commonHeaderLen)
+	binary.LittleEndian.PutUint32(header[4:8], maxH2CData)
+	return PDU{Type: PDUTypeICResp, Header: header}
+}
+
+// NewCapsuleCmd returns a command capsule carrying cmd and its in-capsule data
+func NewCapsuleCmd(cmd SQE, data []byte) PDU {
+	return PDU{Type: PDUTypeCapsuleCmd, Header: cmd[:], Data: data}
+}
+
+// NewCapsuleResp returns a response capsule carrying cqe
+func NewCapsuleResp(cqe CQE) PDU {
+	return PDU{Type: PDUTypeCapsuleResp, Header: cqe.Marshal()}
+}
+
+// NewC2HData returns a PDU transferring data at offset of the buffer of command cid to the host.
+// last marks the final data PDU of the command, success additionally completes the command
+// without a response capsule.
+func NewC2HData(cid uint16, offset uint32, data []byte, last, success bool) PDU {
+	header := make([]byte, c2hDataHeaderLen-commonHeaderLen)
+	binary.LittleEndian.PutUint16(header[0:2], cid)
+	binary.LittleEndian.PutUint32(header[4:8], offset)
+	binary.LittleEndian.PutUint32(header[8:12], uint32(len(data))) // #nosec G115
+	pdu := PDU{Type: PDUTypeC2HData, Header: header, Data: data}
+	if last {
+		pdu.Flags |= FlagDataLast
+	}
+	if success {
+		pdu.Flags |= FlagDataLast | FlagDataSuccess
+	}
+	return pdu
+}
+
+// C2HData returns the command identifier and the data offset of a C2H data PDU
+func (p PDU) C2HData() (cid uint16, offset uint32, err error) {
+	if p.Type != PDUTypeC2HData || len(p.Header) < c2hDataHeaderLen-commonHeaderLen {
+		return 0, 0, fmt.Errorf("not a C2H data PDU: type %#x", p.Type)
+	}
+	return binary.LittleEndian.Uint16(p.Header[0:2]), binary.LittleEndian.Uint32(p.Header[4:8]), nil
+}
+
+// CapsuleCmd returns the command and the in-capsule data of a command capsule
+func (p PDU) CapsuleCmd() (SQE, []byte, error) {
+	var cmd SQE
+	if p.Type != PDUTypeCapsuleCmd || len(p.Header) < len(cmd) {
+		return cmd, nil, fmt.Errorf("not a command capsule: type %#x", p.Type)
+	}
+	copy(cmd[:], p.Header)
+	return cmd, p.Data, nil
+}
+
+// CapsuleResp returns the completion carried by a response capsule
+func (p PDU) CapsuleResp() (CQE, error) {
+	if p.Type != PDUTypeCapsuleResp || len(p.Header) < cqeLen {
+		return CQE{}, fmt.Errorf("not a response capsule: type %#x", p.Type)
+	}
+	return UnmarshalCQE(p.Header), nil
+}